@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+const thumbWidth = 320
+
+func init() {
+	registerCommand("analyze", cmdAnalyze)
+}
+
+// cmdAnalyze fills in the derived catalog fields (pHash, palette,
+// brightness, thumbnail). Each image is decoded once for all of them.
+func cmdAnalyze(args []string) error {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	missingOnly := flags.Bool("missing-only", false, "only compute fields an entry does not have yet")
+	workers := flags.Int("workers", runtime.NumCPU(), "images analyzed in parallel")
+	parseFlags(flags, args)
+
+	lock, err := lockLibrary(context.Background(), *outDir, "analyze", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	var todo []*catalogEntry
+	for _, e := range cat.Images {
+		if !*missingOnly || needsAnalysis(*outDir, e) {
+			todo = append(todo, e)
+		}
+	}
+	if len(todo) == 0 {
+		fmt.Println("nothing to analyze")
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir(*outDir), "thumbs"), 0o755); err != nil {
+		return err
+	}
+
+	type result struct {
+		e          *catalogEntry
+		phash      string
+		palette    []string
+		brightness float64
+		thumb      string
+		w, h       int
+		err        error
+	}
+	jobs := make(chan *catalogEntry)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for range max(*workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				r := result{e: e}
+				img, err := decodeImage(filepath.Join(*outDir, filepath.FromSlash(e.Path)))
+				if err != nil {
+					r.err = err
+					results <- r
+					continue
+				}
+				b := img.Bounds()
+				r.w, r.h = b.Dx(), b.Dy()
+				r.phash = formatPHash(pHashImage(img))
+				r.palette = dominantColors(img, 5)
+				r.brightness = meanLuma(img)
+				r.thumb, r.err = writeThumb(*outDir, e.SHA256, img)
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		for _, e := range todo {
+			jobs <- e
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	tty := isTerminal(os.Stdout)
+	var done, failed int
+	for r := range results {
+		done++
+		if r.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "\r%s: %v\n", r.e.Path, r.err)
+		} else {
+			// results are applied here, on one goroutine
+			e := r.e
+			e.Width, e.Height = r.w, r.h
+			if old := thumbFile(*outDir, e); old != "" && old != r.thumb {
+				os.Remove(old)
+			}
+			e.PHash, e.Palette, e.Brightness, e.Thumb = r.phash, r.palette, r.brightness, r.thumb
+		}
+		if tty {
+			fmt.Printf("\ranalyzed %d/%d %s", done, len(todo), bar(float64(done)/float64(len(todo)), 30))
+		}
+		if done%100 == 0 {
+			if err := cat.save(); err != nil {
+				return err
+			}
+		}
+	}
+	if tty {
+		fmt.Println()
+	}
+	fmt.Printf("analyzed %d images, %d failed\n", done-failed, failed)
+	return cat.save()
+}
+
+func needsAnalysis(outDir string, e *catalogEntry) bool {
+	return e.PHash == "" || len(e.Palette) == 0 || e.Brightness == 0 || e.Width == 0 ||
+		e.Thumb == "" || !exists(thumbFile(outDir, e))
+}
+
+// dominantColors buckets a sample of pixels into a 4-bit-per-channel
+// histogram and returns the average color of the n fullest buckets.
+func dominantColors(img image.Image, n int) []string {
+	type bucket struct{ r, g, b, count int }
+	var hist [4096]bucket
+	b := img.Bounds()
+	step := max(1, min(b.Dx(), b.Dy())/100)
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			k := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			hist[k].r += int(c.R)
+			hist[k].g += int(c.G)
+			hist[k].b += int(c.B)
+			hist[k].count++
+		}
+	}
+	buckets := slices.DeleteFunc(hist[:], func(b bucket) bool { return b.count == 0 })
+	slices.SortFunc(buckets, func(a, b bucket) int { return b.count - a.count })
+	var out []string
+	for _, bk := range buckets[:min(n, len(buckets))] {
+		out = append(out, fmt.Sprintf("#%02x%02x%02x", bk.r/bk.count, bk.g/bk.count, bk.b/bk.count))
+	}
+	return out
+}
+
+func meanLuma(img image.Image) float64 {
+	var px [32][32]float64
+	lumaGrid(img, &px)
+	var sum float64
+	for x := range px {
+		for y := range px[x] {
+			sum += px[x][y]
+		}
+	}
+	return sum / (32 * 32 * 255)
+}
+
+func thumbPath(outDir, sum string) string {
+	return filepath.Join(cacheDir(outDir), "thumbs", sum+".jpg")
+}
+
+// thumbFile resolves e.Thumb, which older versions stored relative to
+// outDir under .spotlightdl/thumbs.
+func thumbFile(outDir string, e *catalogEntry) string {
+	if e.Thumb == "" || filepath.IsAbs(e.Thumb) {
+		return e.Thumb
+	}
+	return filepath.Join(outDir, filepath.FromSlash(e.Thumb))
+}
+
+// ensureThumb returns the thumbnail of e, making it if analyze has not.
+func ensureThumb(outDir string, e *catalogEntry) (string, error) {
+	p := thumbFile(outDir, e)
+	if p == "" || !exists(p) {
+		p = thumbPath(outDir, e.SHA256)
+	}
+	if exists(p) {
+		return p, nil
+	}
+	img, err := decodeImage(filepath.Join(outDir, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	return writeThumb(outDir, e.SHA256, img)
+}
+
+// writeThumb stores a thumbWidth-wide JPEG in the cache directory and
+// returns its path.
+func writeThumb(outDir, sum string, img image.Image) (string, error) {
+	p := thumbPath(outDir, sum)
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	err = jpeg.Encode(f, scaleDown(img, thumbWidth), &jpeg.Options{Quality: 80})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return p, err
+}
+
+// scaleDown box-filters img to the given width, keeping the aspect ratio.
+func scaleDown(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for ty := 0; ty < height; ty++ {
+		y0, y1 := b.Min.Y+ty*b.Dy()/height, b.Min.Y+(ty+1)*b.Dy()/height
+		for tx := 0; tx < width; tx++ {
+			x0, x1 := b.Min.X+tx*b.Dx()/width, b.Min.X+(tx+1)*b.Dx()/width
+			var r, g, bl, a, n uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := img.At(x, y).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			dst.Set(tx, ty, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
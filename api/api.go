@@ -0,0 +1,91 @@
+// Package api holds the request and response types of the spotlightdl
+// daemon's HTTP API, and a typed client for it. The daemon encodes exactly
+// these types, so tools built on this package cannot drift from it.
+//
+// Endpoints, all under the daemon's socket or -listen address:
+//
+//	POST   /api/v1/trigger?action=fetch|wallpaper   Status
+//	GET    /api/v1/images?q=&favorite=true&limit=&offset=   ImageList
+//	GET    /api/v1/images/{sha}                     Image
+//	PUT    /api/v1/images/{sha}/favorite            Image
+//	DELETE /api/v1/images/{sha}/favorite            Image
+//	DELETE /api/v1/images/{sha}                     Status
+//	GET    /healthz                                 Health
+//	GET    /api/v1/schema                           Schema
+//
+// Errors come back as an Error body with a non-2xx status. schema.json
+// describes the same documents as JSON Schema for clients in other
+// languages.
+package api
+
+import (
+	_ "embed"
+	"time"
+)
+
+// Schema is the JSON Schema (draft 2020-12) of the documents below.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Image is one library image.
+type Image struct {
+	Path        string    `json:"path"` // relative to the library, slash-separated
+	URL         string    `json:"url,omitempty"`
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	PHash       string    `json:"phash,omitempty"`
+	Palette     []string  `json:"palette,omitempty"`    // dominant colors as #rrggbb, most common first
+	Brightness  float64   `json:"brightness,omitempty"` // mean luma, 0-1
+	Thumb       string    `json:"thumb,omitempty"`      // file on the daemon's machine
+	Title       string    `json:"title,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Copyright   string    `json:"copyright,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Locales     []string  `json:"locales,omitempty"`
+	Rating      int       `json:"rating,omitempty"` // 1-5, 0 = unrated
+	Favorite    bool      `json:"favorite,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Published   time.Time `json:"published,omitzero"`
+	Added       time.Time `json:"added"`
+}
+
+// ImageList is one page of a listing, newest first; Total counts every
+// match.
+type ImageList struct {
+	Total  int     `json:"total"`
+	Images []Image `json:"images"`
+}
+
+// ListOptions filter GET /api/v1/images. Zero values leave the server
+// defaults (50 per page).
+type ListOptions struct {
+	Query     string
+	Favorites bool
+	Tag       string // images with one of these comma-separated tags, and none prefixed with -
+	Limit     int
+	Offset    int
+}
+
+// Status acknowledges a trigger or a delete.
+type Status struct {
+	Status string `json:"status"`
+	Path   string `json:"path,omitempty"` // the deleted image
+}
+
+// Health is the daemon's judgement of its recent runs.
+type Health struct {
+	Status      string     `json:"status"` // ok, failing, stale or unknown (no run yet)
+	Running     bool       `json:"running,omitempty"`
+	LastRun     *time.Time `json:"lastRun,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// Error is the body of every failed request.
+type Error struct {
+	Message string `json:"error"`
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to one daemon. The zero value is not usable; use NewClient
+// or NewSocketClient.
+type Client struct {
+	BaseURL string // e.g. http://127.0.0.1:8765
+	Token   string // sent as a bearer token when set
+	HTTP    *http.Client
+}
+
+// NewClient returns a client for a daemon started with -listen. The token
+// is the daemon's $SPOTLIGHTDL_DAEMON_TOKEN.
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+// NewSocketClient returns a client for the daemon's unix socket, which
+// needs no token.
+func NewSocketClient(path string) *Client {
+	return &Client{
+		BaseURL: "http://daemon",
+		HTTP: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			}},
+		},
+	}
+}
+
+// StatusError is returned for a non-2xx response.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.Code)
+	}
+	return e.Message
+}
+
+// Trigger starts a fetch or changes the wallpaper.
+func (c *Client) Trigger(ctx context.Context, action string) (Status, error) {
+	var s Status
+	return s, c.do(ctx, http.MethodPost, "/api/v1/trigger?action="+url.QueryEscape(action), &s)
+}
+
+// Images lists the library.
+func (c *Client) Images(ctx context.Context, opts ListOptions) (ImageList, error) {
+	q := url.Values{}
+	if opts.Query != "" {
+		q.Set("q", opts.Query)
+	}
+	if opts.Favorites {
+		q.Set("favorite", "true")
+	}
+	if opts.Tag != "" {
+		q.Set("tag", opts.Tag)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	path := "/api/v1/images"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var l ImageList
+	return l, c.do(ctx, http.MethodGet, path, &l)
+}
+
+// Image looks up one image by SHA-256 or a unique prefix of at least 6
+// hex digits.
+func (c *Client) Image(ctx context.Context, sha string) (Image, error) {
+	var img Image
+	return img, c.do(ctx, http.MethodGet, "/api/v1/images/"+url.PathEscape(sha), &img)
+}
+
+// SetFavorite marks or unmarks an image as a favorite.
+func (c *Client) SetFavorite(ctx context.Context, sha string, on bool) (Image, error) {
+	method := http.MethodPut
+	if !on {
+		method = http.MethodDelete
+	}
+	var img Image
+	return img, c.do(ctx, method, "/api/v1/images/"+url.PathEscape(sha)+"/favorite", &img)
+}
+
+// Delete removes an image from the library.
+func (c *Client) Delete(ctx context.Context, sha string) (Status, error) {
+	var s Status
+	return s, c.do(ctx, http.MethodDelete, "/api/v1/images/"+url.PathEscape(sha), &s)
+}
+
+// Health fetches /healthz. A failing or stale daemon answers 503 with a
+// Health body; that is returned without an error.
+func (c *Client) Health(ctx context.Context) (Health, error) {
+	var h Health
+	err := c.do(ctx, http.MethodGet, "/healthz", &h)
+	if se, ok := err.(*StatusError); ok && se.Code == http.StatusServiceUnavailable && h.Status != "" {
+		err = nil
+	}
+	return h, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var e Error
+		json.Unmarshal(body, &e)
+		// /healthz reports its state in the body even when failing
+		json.Unmarshal(body, out)
+		return &StatusError{Code: resp.StatusCode, Message: e.Message}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return nil
+}
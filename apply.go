@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// desiredState is the document read by `apply -config`:
+//
+//	[archive]   path, locale, sources
+//	[scheduler] enabled, schedule, args
+//	[retention] keep_favorites, keep_rating, keep_last, keep_per_month,
+//	            older_than, max_size, trash_for
+//	[wallpaper] mode, interval, favorites_only, min_rating, tags
+type desiredState struct {
+	Path      string
+	Locale    string
+	Sources   []string
+	Enabled   bool
+	Schedule  string
+	Args      []string
+	Retention retentionPolicy
+	Wallpaper wallpaperPolicy
+}
+
+func init() {
+	registerCommand("apply", cmdApply)
+}
+
+func cmdApply(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	config := flags.String("config", "", "desired state file (TOML)")
+	dryRun := flags.Bool("dry-run", false, "report the changes without making them")
+	parseFlags(flags, args)
+	if *config == "" {
+		return errors.New("apply: -config is required")
+	}
+
+	b, err := os.ReadFile(*config)
+	if err != nil {
+		return err
+	}
+	st, err := parseDesiredState(string(b))
+	if err != nil {
+		return fmt.Errorf("apply: %s: %w", *config, err)
+	}
+
+	var changes int
+	report := func(mark, format string, a ...any) {
+		if mark != "=" {
+			changes++
+		}
+		fmt.Printf("%s "+format+"\n", append([]any{mark}, a...)...)
+	}
+
+	// archive
+	if _, err := os.Stat(st.Path); err == nil {
+		report("=", "archive %s", st.Path)
+	} else {
+		report("+", "archive %s", st.Path)
+		if !*dryRun {
+			if err := os.MkdirAll(st.Path, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+
+	prev, err := loadPolicy(st.Path)
+	if err != nil {
+		return err
+	}
+	next := libraryPolicy{Retention: st.Retention, Wallpaper: st.Wallpaper}
+
+	// scheduler
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	argv := append([]string{exe, "-outdir", st.Path}, st.runArgs()...)
+	schedule := ""
+	if st.Enabled {
+		schedule = st.Schedule
+		quoted := make([]string, len(argv))
+		for i, a := range argv {
+			quoted[i] = windowsQuote(a)
+		}
+		next.Scheduler = schedulerState{Schedule: schedule, Command: strings.Join(quoted, " ")}
+	}
+	changed, err := installSchedule(schedule, argv, prev.Scheduler, *dryRun)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !changed && schedule == "":
+		report("=", "scheduler disabled")
+	case !changed:
+		report("=", "scheduler %s", schedule)
+	case schedule == "":
+		report("-", "scheduler removed")
+	case prev.Scheduler.Schedule == "":
+		report("+", "scheduler %s", schedule)
+	default:
+		report("~", "scheduler %s -> %s", firstNonEmpty(prev.Scheduler.Schedule, "?"), schedule)
+	}
+
+	// policies
+	diffPolicy := func(name, from, to string) {
+		switch {
+		case from == to:
+			report("=", "%s %s", name, firstNonEmpty(to, "none"))
+		case from == "":
+			report("+", "%s %s", name, to)
+		case to == "":
+			report("-", "%s %s", name, from)
+		default:
+			report("~", "%s %s -> %s", name, from, to)
+		}
+	}
+	diffPolicy("retention", prev.Retention.String(), next.Retention.String())
+	diffPolicy("wallpaper", prev.Wallpaper.String(), next.Wallpaper.String())
+
+	if !*dryRun && next != prev {
+		if err := savePolicy(st.Path, next); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		fmt.Printf("%d change(s) pending\n", changes)
+	} else {
+		fmt.Printf("%d change(s) applied\n", changes)
+	}
+	return nil
+}
+
+// runArgs are the fetch flags the scheduled run is started with.
+func (st desiredState) runArgs() []string {
+	var a []string
+	if st.Locale != "" {
+		a = append(a, "-locale", st.Locale)
+	}
+	if len(st.Sources) > 0 {
+		a = append(a, "-source", strings.Join(st.Sources, ","))
+	}
+	return append(a, st.Args...)
+}
+
+func parseDesiredState(src string) (desiredState, error) {
+	var st desiredState
+	doc, err := parseTOML(src)
+	if err != nil {
+		return st, err
+	}
+	for k := range doc {
+		if !slices.Contains([]string{"archive", "scheduler", "retention", "wallpaper"}, k) {
+			return st, fmt.Errorf("unknown section %q", k)
+		}
+	}
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	archive, err := tomlTableAt(doc, "archive")
+	check(err)
+	st.Path, err = tomlString(archive, "path")
+	check(err)
+	st.Locale, err = tomlString(archive, "locale")
+	check(err)
+	st.Sources, err = tomlStrings(archive, "sources")
+	check(err)
+
+	sched, err := tomlTableAt(doc, "scheduler")
+	check(err)
+	st.Enabled, err = tomlBool(sched, "enabled")
+	check(err)
+	st.Schedule, err = tomlString(sched, "schedule")
+	check(err)
+	st.Args, err = tomlStrings(sched, "args")
+	check(err)
+
+	ret, err := tomlTableAt(doc, "retention")
+	check(err)
+	st.Retention.KeepFavorites, err = tomlBool(ret, "keep_favorites")
+	check(err)
+	rating, err := tomlInt(ret, "keep_rating")
+	check(err)
+	st.Retention.KeepRating = int(rating)
+	keep, err := tomlInt(ret, "keep_last")
+	check(err)
+	st.Retention.KeepLast = int(keep)
+	perMonth, err := tomlInt(ret, "keep_per_month")
+	check(err)
+	st.Retention.KeepPerMonth = int(perMonth)
+	st.Retention.OlderThan, err = tomlString(ret, "older_than")
+	check(err)
+	st.Retention.MaxSize, err = tomlString(ret, "max_size")
+	check(err)
+	st.Retention.TrashFor, err = tomlString(ret, "trash_for")
+	check(err)
+
+	wp, err := tomlTableAt(doc, "wallpaper")
+	check(err)
+	st.Wallpaper.Mode, err = tomlString(wp, "mode")
+	check(err)
+	st.Wallpaper.Interval, err = tomlString(wp, "interval")
+	check(err)
+	st.Wallpaper.FavoritesOnly, err = tomlBool(wp, "favorites_only")
+	check(err)
+	minRating, err := tomlInt(wp, "min_rating")
+	check(err)
+	st.Wallpaper.MinRating = int(minRating)
+	wpTags, err := tomlStrings(wp, "tags")
+	check(err)
+	st.Wallpaper.Tags = strings.Join(wpTags, ",")
+	if err := errors.Join(errs...); err != nil {
+		return st, err
+	}
+
+	if st.Path == "" {
+		return st, errors.New("archive.path is required")
+	}
+	if st.Path, err = filepath.Abs(expandHome(st.Path)); err != nil {
+		return st, err
+	}
+	if st.Enabled {
+		if st.Schedule == "" {
+			st.Schedule = "daily"
+		}
+		if _, err := cronSchedule(st.Schedule); err != nil {
+			return st, err
+		}
+	}
+	if keep < 0 || perMonth < 0 {
+		return st, errors.New("retention.keep_last and keep_per_month must not be negative")
+	}
+	if rating < 0 || rating > 5 {
+		return st, errors.New("retention.keep_rating must be between 1 and 5")
+	}
+	if st.Retention.OlderThan != "" {
+		if _, err := parseAge(st.Retention.OlderThan); err != nil {
+			return st, fmt.Errorf("retention.older_than: %w", err)
+		}
+	}
+	if st.Retention.MaxSize != "" {
+		if _, err := parseSize(st.Retention.MaxSize); err != nil {
+			return st, fmt.Errorf("retention.max_size: %w", err)
+		}
+	}
+	if st.Retention.TrashFor != "" {
+		if _, err := parseAge(st.Retention.TrashFor); err != nil {
+			return st, fmt.Errorf("retention.trash_for: %w", err)
+		}
+	}
+	switch st.Wallpaper.Mode {
+	case "", "off", "latest", "random":
+	default:
+		return st, fmt.Errorf("wallpaper.mode: unknown mode %q (want off, latest or random)", st.Wallpaper.Mode)
+	}
+	if st.Wallpaper.Interval != "" {
+		if _, err := parseAge(st.Wallpaper.Interval); err != nil {
+			return st, fmt.Errorf("wallpaper.interval: %w", err)
+		}
+	}
+	if minRating < 0 || minRating > 5 {
+		return st, errors.New("wallpaper.min_rating must be between 1 and 5")
+	}
+	return st, nil
+}
+
+func expandHome(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~"); ok && (rest == "" || rest[0] == '/' || rest[0] == '\\') {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + rest
+		}
+	}
+	return p
+}
+
+func (r retentionPolicy) String() string {
+	var parts []string
+	if r.KeepFavorites {
+		parts = append(parts, "keep_favorites")
+	}
+	if r.KeepRating > 0 {
+		parts = append(parts, fmt.Sprintf("keep_rating=%d", r.KeepRating))
+	}
+	if r.KeepLast > 0 {
+		parts = append(parts, fmt.Sprintf("keep_last=%d", r.KeepLast))
+	}
+	if r.KeepPerMonth > 0 {
+		parts = append(parts, fmt.Sprintf("keep_per_month=%d", r.KeepPerMonth))
+	}
+	if r.OlderThan != "" {
+		parts = append(parts, "older_than="+r.OlderThan)
+	}
+	if r.MaxSize != "" {
+		parts = append(parts, "max_size="+r.MaxSize)
+	}
+	if r.TrashFor != "" {
+		parts = append(parts, "trash_for="+r.TrashFor)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (w wallpaperPolicy) String() string {
+	if w.Mode == "" {
+		return ""
+	}
+	s := "mode=" + w.Mode
+	if w.Interval != "" {
+		s += " interval=" + w.Interval
+	}
+	if w.FavoritesOnly {
+		s += " favorites_only"
+	}
+	if w.MinRating > 0 {
+		s += fmt.Sprintf(" min_rating=%d", w.MinRating)
+	}
+	if w.Tags != "" {
+		s += " tags=" + w.Tags
+	}
+	return s
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The archive snapshot is the cheap half of change tracking: path, size,
+// mtime and hash of every image, so that only new or touched files need
+// hashing after a run. Each run's differences are appended to
+// history.jsonl, which `diff` reads.
+
+type snapshotFile struct {
+	SHA256 string    `json:"sha256"`
+	Size   int64     `json:"size"`
+	MTime  time.Time `json:"mtime"`
+}
+
+type archiveDiff struct {
+	Time    time.Time  `json:"time"`
+	Added   []diffFile `json:"added,omitempty"`
+	Removed []diffFile `json:"removed,omitempty"`
+	Changed []diffFile `json:"changed,omitempty"`
+}
+
+type diffFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Old    string `json:"old,omitempty"` // previous hash of a changed file
+}
+
+func (d *archiveDiff) empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Changed) == 0
+}
+
+var imageExts = []string{".jpg", ".jpeg", ".png", ".webp", ".avif"}
+
+func isImageFile(name string) bool {
+	return slices.Contains(imageExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// scanArchive lists the images under outDir, reusing hashes from prev for
+// files whose size and mtime have not changed.
+func scanArchive(outDir string, prev map[string]snapshotFile, linked map[string]bool) (map[string]snapshotFile, error) {
+	out := make(map[string]snapshotFile)
+	err := filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != outDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// the links of -store objects and -latest are not images of
+		// their own
+		if !isImageFile(d.Name()) || d.Type()&fs.ModeSymlink != 0 || isLatestFile(outDir, p) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if linked[rel] {
+			return nil
+		}
+		f := snapshotFile{Size: fi.Size(), MTime: fi.ModTime().UTC()}
+		if old, ok := prev[rel]; ok && old.Size == f.Size && old.MTime.Equal(f.MTime) {
+			f.SHA256 = old.SHA256
+		} else if f.SHA256, _, err = hashFile(p); err != nil {
+			return err
+		}
+		out[rel] = f
+		return nil
+	})
+	return out, err
+}
+
+func diffSnapshots(prev, cur map[string]snapshotFile) *archiveDiff {
+	d := &archiveDiff{Time: time.Now().UTC()}
+	for p, f := range cur {
+		old, ok := prev[p]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, diffFile{Path: p, SHA256: f.SHA256})
+		case old.SHA256 != f.SHA256:
+			d.Changed = append(d.Changed, diffFile{Path: p, SHA256: f.SHA256, Old: old.SHA256})
+		}
+	}
+	for p, f := range prev {
+		if _, ok := cur[p]; !ok {
+			d.Removed = append(d.Removed, diffFile{Path: p, SHA256: f.SHA256})
+		}
+	}
+	for _, l := range [][]diffFile{d.Added, d.Removed, d.Changed} {
+		slices.SortFunc(l, func(a, b diffFile) int { return strings.Compare(a.Path, b.Path) })
+	}
+	return d
+}
+
+// recordArchiveDiff rescans outDir, appends what changed since the last
+// snapshot to the history and stores the new snapshot. The very first
+// scan only sets the baseline. rehash ignores the cached hashes.
+func recordArchiveDiff(outDir string, rehash bool) (*archiveDiff, error) {
+	snapPath := filepath.Join(stateDir(outDir), "snapshot.json")
+	var prev map[string]snapshotFile
+	b, err := os.ReadFile(snapPath)
+	baseline := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !baseline {
+		return nil, err
+	}
+	if !baseline {
+		if err := json.Unmarshal(b, &prev); err != nil {
+			return nil, err
+		}
+	}
+
+	cache := prev
+	if rehash {
+		cache = nil
+	}
+	// hard links in other markets' folders are the same images again
+	var linked map[string]bool
+	if cat, err := openCatalog(outDir); err == nil {
+		linked = cat.linkedPaths()
+	}
+	cur, err := scanArchive(outDir, cache, linked)
+	if err != nil {
+		return nil, err
+	}
+	d := diffSnapshots(prev, cur)
+	if !baseline && !d.empty() {
+		line, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(filepath.Join(stateDir(outDir), "history.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(append(line, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b, err = json.Marshal(cur); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(stateDir(outDir), 0o755); err != nil {
+		return nil, err
+	}
+	return d, writeFileAtomic(snapPath, b)
+}
+
+// readHistory returns the recorded diffs at or after since, oldest first.
+func readHistory(outDir string, since time.Time) ([]*archiveDiff, error) {
+	f, err := os.Open(filepath.Join(stateDir(outDir), "history.jsonl"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []*archiveDiff
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var d archiveDiff
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			continue // a torn last line after a crash
+		}
+		if !d.Time.Before(since) {
+			out = append(out, &d)
+		}
+	}
+	return out, sc.Err()
+}
+
+func init() {
+	registerCommand("diff", cmdDiff)
+}
+
+func cmdDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	sinceFlag := flags.String("since", "last-week", "show changes since: a date, RFC 3339 time, duration like 7d, or today/yesterday/last-week/last-month")
+	asJSON := flags.Bool("json", false, "print the recorded diffs as a JSON array")
+	rescan := flags.Bool("rescan", false, "record changes made since the last run (e.g. by hand) first")
+	parseFlags(flags, args)
+
+	since, err := parseSince(*sinceFlag)
+	if err != nil {
+		return err
+	}
+	if *rescan {
+		if _, err := recordArchiveDiff(*outDir, false); err != nil {
+			return err
+		}
+	}
+	hist, err := readHistory(*outDir, since)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if hist == nil {
+			hist = []*archiveDiff{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(hist)
+	}
+	if len(hist) == 0 {
+		fmt.Printf("no changes since %s\n", since.Local().Format("2006-01-02 15:04"))
+		return nil
+	}
+	for _, d := range hist {
+		fmt.Printf("%s  +%d -%d ~%d\n", d.Time.Local().Format("2006-01-02 15:04"), len(d.Added), len(d.Removed), len(d.Changed))
+		for _, f := range d.Added {
+			fmt.Printf("  + %s  %.12s\n", f.Path, f.SHA256)
+		}
+		for _, f := range d.Removed {
+			fmt.Printf("  - %s  %.12s\n", f.Path, f.SHA256)
+		}
+		for _, f := range d.Changed {
+			fmt.Printf("  ~ %s  %.12s -> %.12s\n", f.Path, f.Old, f.SHA256)
+		}
+	}
+	return nil
+}
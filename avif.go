@@ -0,0 +1,31 @@
+//go:build avif
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	registerFeature(&feature{
+		name:  "avif",
+		desc:  "AVIF encoding (avifenc)",
+		tag:   "avif",
+		built: true,
+		check: lookTool("avifenc"),
+	})
+}
+
+// encodeAVIF converts src (JPEG or PNG) to AVIF at dst.
+func encodeAVIF(src, dst string, quality int) error {
+	if err := requireFeature("avif"); err != nil {
+		return err
+	}
+	out, err := exec.Command("avifenc", "-q", fmt.Sprint(quality), src, dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("avifenc: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !avif
+
+package main
+
+func init() {
+	registerFeature(&feature{name: "avif", desc: "AVIF encoding (avifenc)", tag: "avif"})
+}
+
+func encodeAVIF(src, dst string, quality int) error {
+	return requireFeature("avif")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	registerCommand("backfill", cmdBackfill)
+}
+
+// cmdBackfill downloads images listed in a mirror or URL dump, for the
+// years before this library existed. The discovery loop can only see what
+// the API serves today.
+func cmdBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	manifest := flags.String("manifest", "", "URL or file of the dump; {locale} is replaced by -locale")
+	format := flags.String("format", "lines", "manifest format: lines (URL [tab title]), json (array or one object per line) or csv (with header)")
+	urlField := flags.String("url-field", "url", "json/csv: field holding the image URL")
+	titleField := flags.String("title-field", "title", "json/csv: field holding the title")
+	copyrightField := flags.String("copyright-field", "copyright", "json/csv: field holding the copyright")
+	locale := flags.String("locale", "en-US", "locale recorded for the images and substituted into -manifest")
+	limit := flags.Int("limit", 0, "stop after this many new images (0 = no limit)")
+	verbose := flags.Bool("v", false, "verbose logging")
+	parseFlags(flags, args)
+	if *manifest == "" {
+		return errors.New("backfill: -manifest is required")
+	}
+
+	client, err := newHTTPClient(transportOptions{})
+	if err != nil {
+		return err
+	}
+	loc := strings.ReplaceAll(*manifest, "{locale}", *locale)
+	var data []byte
+	if strings.HasPrefix(loc, "http://") || strings.HasPrefix(loc, "https://") {
+		data, err = fetchBytes(client, loc, 256<<20)
+	} else {
+		data, err = os.ReadFile(loc)
+	}
+	if err != nil {
+		return err
+	}
+	imgs, err := parseManifest(data, *format, *urlField, *titleField, *copyrightField)
+	if err != nil {
+		return fmt.Errorf("backfill: %s: %w", loc, err)
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	lock, err := lockLibrary(context.Background(), *outDir, "backfill", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, e := range cat.Images {
+		known[e.URL] = true
+	}
+
+	var added, dupes, failed int
+	for _, im := range dedupe(imgs) {
+		if *limit > 0 && added >= *limit {
+			break
+		}
+		if known[im.URL] {
+			continue
+		}
+		name := fileNameFromURL(im.URL)
+		path := filepath.Join(*outDir, name)
+		if name == "" || exists(path) {
+			continue
+		}
+		sum, err := download(context.Background(), client, im.URL, path, false, nil)
+		if err != nil {
+			failed++
+			if *verbose {
+				fmt.Printf("download failed: %s: %v\n", im.URL, err)
+			}
+			continue
+		}
+		// mirrors often list the same picture under several URLs
+		if cat.bySHA(sum) != nil {
+			os.Remove(path)
+			dupes++
+			continue
+		}
+		im.Source, im.Locale = "backfill", *locale
+		recordDownload(cat, *outDir, path, sum, im)
+		fmt.Println(path)
+		added++
+		if added%20 == 0 {
+			if err := cat.save(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	fmt.Printf("backfill: %d new, %d duplicates, %d failed of %d listed\n", added, dupes, failed, len(imgs))
+	return nil
+}
+
+func parseManifest(data []byte, format, urlField, titleField, copyrightField string) ([]spotImage, error) {
+	var out []spotImage
+	add := func(u, title, copyright string) {
+		u = strings.TrimSpace(u)
+		if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
+			out = append(out, spotImage{URL: u, Title: strings.TrimSpace(title), Copyright: strings.TrimSpace(copyright)})
+		}
+	}
+
+	switch format {
+	case "lines":
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			u, title, _ := strings.Cut(line, "\t")
+			add(u, title, "")
+		}
+	case "json":
+		field := func(m map[string]any, k string) string {
+			s, _ := m[k].(string)
+			return s
+		}
+		trimmed := bytes.TrimSpace(data)
+		if bytes.HasPrefix(trimmed, []byte("[")) {
+			var rows []map[string]any
+			if err := json.Unmarshal(trimmed, &rows); err != nil {
+				return nil, err
+			}
+			for _, r := range rows {
+				add(field(r, urlField), field(r, titleField), field(r, copyrightField))
+			}
+			break
+		}
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		for {
+			var r map[string]any
+			if err := dec.Decode(&r); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			add(field(r, urlField), field(r, titleField), field(r, copyrightField))
+		}
+	case "csv":
+		rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		col := map[string]int{}
+		for i, h := range rows[0] {
+			col[strings.TrimSpace(h)] = i
+		}
+		ui, ok := col[urlField]
+		if !ok {
+			return nil, fmt.Errorf("no %q column", urlField)
+		}
+		get := func(r []string, name string) string {
+			if i, ok := col[name]; ok && i < len(r) {
+				return r[i]
+			}
+			return ""
+		}
+		for _, r := range rows[1:] {
+			if ui < len(r) {
+				add(r[ui], get(r, titleField), get(r, copyrightField))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q (want lines, json or csv)", format)
+	}
+	return out, nil
+}
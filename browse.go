@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func init() {
+	registerCommand("browse", cmdBrowse)
+}
+
+const browseHelp = "←/→ page  f favorite  0-5 rate  t tags  w wallpaper  d delete  q quit"
+
+// cmdBrowse is a small full-screen library browser. Thumbnails are drawn
+// inline on terminals that speak the kitty or iTerm2 image protocols.
+func cmdBrowse(args []string) error {
+	flags := flag.NewFlagSet("browse", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	favoritesOnly := flags.Bool("favorites-only", false, "only page through favorites")
+	parseFlags(flags, args)
+
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) || !enableVT(os.Stdout) {
+		return errors.New("browse: needs an interactive terminal")
+	}
+	lock, err := lockLibrary(context.Background(), *outDir, "browse", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	if len(cat.Images) == 0 {
+		return errors.New("browse: the library is empty")
+	}
+	// newest first
+	list := slices.Clone(cat.Images)
+	if *favoritesOnly {
+		list = slices.DeleteFunc(list, func(e *catalogEntry) bool { return !e.Favorite })
+		if len(list) == 0 {
+			return errors.New("browse: no favorites yet; star some or press f while browsing")
+		}
+	}
+	slices.SortStableFunc(list, func(a, b *catalogEntry) int { return b.Added.Compare(a.Added) })
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("browse: %w", err)
+	}
+	defer func() {
+		restore()
+		fmt.Print("\x1b[H\x1b[2J")
+	}()
+
+	i, status := 0, ""
+	key := make([]byte, 16)
+	for {
+		drawBrowse(*outDir, list, i, status)
+		status = ""
+		n, err := os.Stdin.Read(key)
+		if err != nil {
+			return err
+		}
+		e := list[i]
+		switch k := string(key[:n]); k {
+		case "q", "\x03", "\x1b":
+			return cat.save()
+		case "\x1b[C", "n", "l", " ":
+			i = min(i+1, len(list)-1)
+		case "\x1b[D", "p", "h":
+			i = max(i-1, 0)
+		case "g":
+			i = 0
+		case "G":
+			i = len(list) - 1
+		case "f":
+			e.Favorite = !e.Favorite
+			status = saveStatus(cat, "favorite updated")
+		case "0", "1", "2", "3", "4", "5":
+			e.Rating = int(k[0] - '0')
+			status = saveStatus(cat, "rated "+stars(e.Rating))
+			if err := syncXMPRating(filepath.Join(*outDir, filepath.FromSlash(e.Path)), e.Rating); err != nil {
+				status = err.Error()
+			}
+		case "t":
+			line, err := promptLine(restore, "tags (a, b, -c to remove): ")
+			if err != nil {
+				return err
+			}
+			e.Tags = editTags(e.Tags, line)
+			status = saveStatus(cat, "tags updated")
+			if err := syncXMPTags(filepath.Join(*outDir, filepath.FromSlash(e.Path)), e.Tags); err != nil {
+				status = err.Error()
+			}
+		case "w":
+			if err := checkFrozen(*outDir, "wallpaper"); err != nil {
+				status = err.Error()
+			} else if err := setWallpaper(filepath.Join(*outDir, filepath.FromSlash(e.Path))); err != nil {
+				status = err.Error()
+			} else {
+				status = "wallpaper set"
+			}
+		case "d":
+			line, err := promptLine(restore, "delete "+e.Path+"? [y/N] ")
+			if err != nil {
+				return err
+			}
+			if strings.EqualFold(strings.TrimSpace(line), "y") {
+				if err := deleteImage(cat, *outDir, e); err != nil {
+					status = err.Error()
+					break
+				}
+				list = slices.Delete(list, i, i+1)
+				if len(list) == 0 {
+					return nil
+				}
+				i = min(i, len(list)-1)
+				status = "deleted"
+			}
+		}
+	}
+}
+
+func saveStatus(cat *catalog, ok string) string {
+	if err := cat.save(); err != nil {
+		return err.Error()
+	}
+	return ok
+}
+
+// promptLine reads one line in cooked mode and goes back to raw mode.
+func promptLine(restore func(), prompt string) (string, error) {
+	restore()
+	fmt.Print("\r\n" + prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if _, rerr := makeRaw(os.Stdin); rerr != nil {
+		return "", rerr
+	}
+	return strings.TrimSpace(line), err
+}
+
+// editTags applies "a, b, -c": add a and b, remove c.
+func editTags(tags []string, spec string) []string {
+	for _, t := range strings.Split(spec, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if rm, ok := strings.CutPrefix(t, "-"); ok {
+			tags = slices.DeleteFunc(tags, func(x string) bool { return x == rm })
+		} else if t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// deleteImage removes an image, its sidecars and its catalog entry, and
+// leaves a tombstone so that it is not downloaded again.
+func deleteImage(cat *catalog, outDir string, e *catalogEntry) error {
+	if err := checkFrozen(outDir, "delete"); err != nil {
+		return err
+	}
+	p := filepath.Join(outDir, filepath.FromSlash(e.Path))
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(p + ".json")
+	os.Remove(xmpSidecarPath(p))
+	os.Remove(p + ".sha256")
+	removeLinks(outDir, e)
+	if e.Thumb != "" {
+		os.Remove(thumbFile(outDir, e))
+	}
+	cat.remove(e.Path)
+	if err := buryEntries(outDir, []*catalogEntry{e}, "deleted"); err != nil {
+		return err
+	}
+	return cat.save()
+}
+
+func drawBrowse(outDir string, list []*catalogEntry, i int, status string) {
+	e := list[i]
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "spotlightdl browse  %d/%d\r\n\r\n", i+1, len(list))
+	if img := inlineThumb(outDir, e); img != "" {
+		b.WriteString(img + "\r\n")
+	}
+	line := func(label, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "%-10s %s\r\n", label, v)
+		}
+	}
+	line("title", e.Title)
+	line("location", e.Location)
+	line("about", e.Description)
+	line("copyright", e.Copyright)
+	line("file", e.Path)
+	if e.Width > 0 {
+		line("size", fmt.Sprintf("%dx%d, %s", e.Width, e.Height, formatBytes(e.Size)))
+	}
+	line("source", strings.TrimSpace(e.Source+" "+strings.Join(e.Locales, ",")))
+	line("added", e.Added.Local().Format("2006-01-02 15:04"))
+	line("rating", stars(e.Rating))
+	if e.Favorite {
+		line("favorite", "yes")
+	}
+	line("tags", strings.Join(e.Tags, ", "))
+	fmt.Fprintf(&b, "\r\n%s\r\n", browseHelp)
+	if status != "" {
+		fmt.Fprintf(&b, "\x1b[1m%s\x1b[0m\r\n", status)
+	}
+	os.Stdout.WriteString(b.String())
+}
+
+// inlineThumb returns the escape sequence showing a thumbnail of e, or ""
+// if the terminal has no image support.
+func inlineThumb(outDir string, e *catalogEntry) string {
+	proto := ""
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty":
+		proto = "kitty"
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		proto = "iterm"
+	default:
+		return ""
+	}
+	src := thumbFile(outDir, e)
+	if src == "" || !exists(src) {
+		src = filepath.Join(outDir, filepath.FromSlash(e.Path))
+	}
+	img, err := decodeImage(src)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleDown(img, thumbWidth*2)); err != nil {
+		return ""
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	if proto == "iterm" {
+		return "\x1b]1337;File=inline=1;width=60;preserveAspectRatio=1:" + data + "\a"
+	}
+	// kitty wants the payload in chunks of at most 4096 bytes
+	var out strings.Builder
+	for first := true; data != ""; first = false {
+		chunk := data[:min(4096, len(data))]
+		data = data[len(chunk):]
+		more := 0
+		if data != "" {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&out, "\x1b_Ga=T,f=100,c=60,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(&out, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return out.String()
+}
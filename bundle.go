@@ -0,0 +1,455 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Bundles carry new images plus their catalog entries from an online
+// machine to an air-gapped one. Layout of the (uncompressed) tar:
+//
+//	manifest.json   bundleManifest, the catalog delta
+//	manifest.sig    base64 Ed25519 signature over manifest.json
+//	images/<sha256> one file per distinct image
+//
+// Applying is idempotent, so an interrupted apply is resumed by running it
+// again: images already in the catalog with their file present are skipped.
+
+const bundleVersion = 1
+
+type bundleManifest struct {
+	Version int             `json:"version"`
+	ID      string          `json:"id"`
+	Created time.Time       `json:"created"`
+	Entries []*catalogEntry `json:"entries"`
+}
+
+type bundleState struct {
+	LastCreated time.Time `json:"lastCreated"`
+}
+
+func init() {
+	registerCommand("bundle", cmdBundle)
+}
+
+func cmdBundle(args []string) error {
+	usage := errors.New("usage: spotlightdl bundle keygen|create|apply [flags]")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "keygen":
+		return bundleKeygen(args[1:])
+	case "create":
+		return bundleCreate(args[1:])
+	case "apply":
+		return bundleApply(args[1:])
+	}
+	return usage
+}
+
+func bundleKeygen(args []string) error {
+	flags := flag.NewFlagSet("bundle keygen", flag.ExitOnError)
+	keyPath := flags.String("key", "bundle.key", "private key file to create (public key goes to <key>.pub)")
+	parseFlags(flags, args)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if exists(*keyPath) {
+		return fmt.Errorf("%s already exists", *keyPath)
+	}
+	if err := os.WriteFile(*keyPath, []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*keyPath+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0o644); err != nil {
+		return err
+	}
+	fmt.Println(*keyPath + ".pub")
+	return nil
+}
+
+func bundleCreate(args []string) error {
+	flags := flag.NewFlagSet("bundle create", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	keyPath := flags.String("key", "", "private key from 'bundle keygen'")
+	out := flags.String("o", "", "bundle file to write")
+	since := flags.String("since", "", "include images added since a date (2006-01-02) or duration ago (720h); default: since the last bundle")
+	favoritesOnly := flags.Bool("favorites-only", false, "only include favorites; does not move the mark for the next bundle")
+	tags := flags.String("tag", "", "only include images with one of these tags, and none of those prefixed with -; does not move the mark either")
+	parseFlags(flags, args)
+	if *keyPath == "" || *out == "" {
+		return errors.New("bundle create: -key and -o are required")
+	}
+
+	priv, err := readKey(*keyPath, ed25519.PrivateKeySize)
+	if err != nil {
+		return err
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+
+	statePath := filepath.Join(stateDir(*outDir), "bundle.json")
+	var st bundleState
+	if b, err := os.ReadFile(statePath); err == nil {
+		json.Unmarshal(b, &st)
+	}
+	from := st.LastCreated
+	if *since != "" {
+		if from, err = parseSince(*since); err != nil {
+			return err
+		}
+	}
+
+	started := time.Now().UTC()
+	id := make([]byte, 8)
+	rand.Read(id)
+	m := bundleManifest{Version: bundleVersion, ID: hex.EncodeToString(id), Created: started, Entries: cat.since(from)}
+	filtered := *favoritesOnly || *tags != ""
+	if filtered {
+		tf := parseTagFilter(*tags)
+		m.Entries = slices.DeleteFunc(m.Entries, func(e *catalogEntry) bool {
+			return (*favoritesOnly && !e.Favorite) || !tf.admits(e.Tags)
+		})
+	}
+	// an image deleted by hand since is left out rather than failing the
+	// whole bundle
+	m.Entries = slices.DeleteFunc(m.Entries, func(e *catalogEntry) bool {
+		if _, err := os.Stat(filepath.Join(*outDir, filepath.FromSlash(e.Path))); err != nil {
+			fmt.Fprintf(os.Stderr, "bundle create: skipping %s: %v\n", e.Path, err)
+			return true
+		}
+		return false
+	})
+	if len(m.Entries) == 0 {
+		fmt.Println("nothing new to bundle")
+		return nil
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(ed25519.PrivateKey(priv), manifest))
+
+	tmp := *out + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = writeBundle(f, *outDir, manifest, []byte(sig), m.Entries)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+
+	// the other images are still to be bundled
+	if filtered {
+		fmt.Printf("%s: %d images\n", *out, len(m.Entries))
+		return nil
+	}
+	st.LastCreated = started
+	b, _ := json.Marshal(st)
+	if err := os.MkdirAll(stateDir(*outDir), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(statePath, b); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d images\n", *out, len(m.Entries))
+	return nil
+}
+
+func writeBundle(w io.Writer, outDir string, manifest, sig []byte, entries []*catalogEntry) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"manifest.json", manifest}, {"manifest.sig", sig}} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), ModTime: now}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+
+	written := make(map[string]bool)
+	for _, e := range entries {
+		if written[e.SHA256] {
+			continue
+		}
+		src, err := os.Open(filepath.Join(outDir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			return err
+		}
+		fi, err := src.Stat()
+		if err == nil {
+			err = tw.WriteHeader(&tar.Header{Name: "images/" + e.SHA256, Mode: 0o644, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		if err == nil {
+			_, err = io.Copy(tw, src)
+		}
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+		written[e.SHA256] = true
+	}
+	return tw.Close()
+}
+
+func bundleApply(args []string) error {
+	flags := flag.NewFlagSet("bundle apply", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	pubPath := flags.String("pubkey", "", "public key of the bundle signer")
+	in := flags.String("in", "", "bundle file to apply")
+	conflict := flags.String("conflict", "skip", "when a different file already has the same name: skip, rename or overwrite")
+	parseFlags(flags, args)
+	if *pubPath == "" || *in == "" {
+		return errors.New("bundle apply: -pubkey and -in are required")
+	}
+	switch *conflict {
+	case "skip", "rename", "overwrite":
+	default:
+		return fmt.Errorf("bundle apply: unknown -conflict %q", *conflict)
+	}
+
+	pub, err := readKey(*pubPath, ed25519.PublicKeySize)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+
+	manifest, err := readTarFile(tr, "manifest.json", 64<<20)
+	if err != nil {
+		return err
+	}
+	sig, err := readTarFile(tr, "manifest.sig", 1024)
+	if err != nil {
+		return err
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), manifest, rawSig) {
+		return errors.New("bundle signature does not verify")
+	}
+	var m bundleManifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return err
+	}
+	if m.Version != bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", m.Version)
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	lock, err := lockLibrary(context.Background(), *outDir, "bundle apply", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+
+	// plan where each image goes before reading the image stream
+	plan := make(map[string][]*catalogEntry)
+	planned := make(map[string]bool)
+	var skipped, conflicts int
+	for _, e := range m.Entries {
+		if !filepath.IsLocal(filepath.FromSlash(e.Path)) {
+			return fmt.Errorf("bundle entry escapes library: %s", e.Path)
+		}
+		if have := cat.bySHA(e.SHA256); have != nil && exists(filepath.Join(*outDir, filepath.FromSlash(have.Path))) {
+			skipped++
+			continue
+		}
+		target := *e
+		// links and thumbnails name files on the machine that made the
+		// bundle; the links are not carried, and thumbnails are made anew
+		target.Links, target.Thumb = nil, ""
+		dst := filepath.Join(*outDir, filepath.FromSlash(target.Path))
+		if exists(dst) {
+			if sum, _, err := hashFile(dst); err == nil && sum == e.SHA256 {
+				cat.add(&target)
+				skipped++
+				continue
+			}
+			conflicts++
+			switch *conflict {
+			case "skip":
+				fmt.Fprintf(os.Stderr, "conflict, skipped: %s\n", target.Path)
+				continue
+			case "rename":
+				ext := path.Ext(target.Path)
+				stem := strings.TrimSuffix(target.Path, ext) + "-" + e.SHA256[:8]
+				target.Path = stem + ext
+				for n := 2; planned[target.Path] || lexists(filepath.Join(*outDir, filepath.FromSlash(target.Path))); n++ {
+					target.Path = fmt.Sprintf("%s-%d%s", stem, n, ext)
+				}
+			}
+		}
+		planned[target.Path] = true
+		plan[e.SHA256] = append(plan[e.SHA256], &target)
+	}
+
+	var applied int
+	for len(plan) > 0 {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("bundle truncated: %d images missing", len(plan))
+		}
+		if err != nil {
+			return err
+		}
+		sum := strings.TrimPrefix(hdr.Name, "images/")
+		targets, ok := plan[sum]
+		if !ok {
+			continue
+		}
+		if err := extractImage(tr, *outDir, sum, targets); err != nil {
+			return err
+		}
+		for _, t := range targets {
+			cat.add(t)
+			fmt.Println(filepath.Join(*outDir, filepath.FromSlash(t.Path)))
+		}
+		delete(plan, sum)
+		applied++
+		// the catalog doubles as the resume journal
+		if applied%25 == 0 {
+			if err := cat.save(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "bundle %s: applied=%d skipped=%d conflicts=%d\n", m.ID, applied, skipped, conflicts)
+	return nil
+}
+
+func extractImage(r io.Reader, outDir, sum string, targets []*catalogEntry) error {
+	first := filepath.Join(outDir, filepath.FromSlash(targets[0].Path))
+	if err := os.MkdirAll(filepath.Dir(first), 0o755); err != nil {
+		return err
+	}
+	tmp := first + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("%s: checksum mismatch", targets[0].Path)
+	}
+	if err == nil {
+		err = os.Rename(tmp, first)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// the other targets (locale folders, say) get copies, through .part
+	// files like the first so that an interrupted apply leaves no torn
+	// image behind
+	for _, t := range targets[1:] {
+		p := filepath.Join(outDir, filepath.FromSlash(t.Path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := copyFile(first, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTarFile(tr *tar.Reader, name string, limit int64) ([]byte, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("bundle: reading %s: %w", name, err)
+	}
+	if hdr.Name != name {
+		return nil, fmt.Errorf("bundle: expected %s, found %s", name, hdr.Name)
+	}
+	return io.ReadAll(io.LimitReader(tr, limit))
+}
+
+func readKey(path string, size int) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != size {
+		return nil, fmt.Errorf("%s: not a valid key", path)
+	}
+	return key, nil
+}
+
+// parseSince accepts a date (2006-01-02), an RFC 3339 timestamp, a
+// duration meaning "that long ago" (36h, 7d, 2w), or today, yesterday,
+// last-week and last-month.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch s {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "last-week":
+		return today.AddDate(0, 0, -7), nil
+	case "last-month":
+		return today.AddDate(0, -1, 0), nil
+	}
+	if d, err := parseAge(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drzo1dberg/spotlightDlGo/api"
+)
+
+const catalogVersion = 1
+
+// catalog is the library index: one entry per image in the output
+// directory, stored as JSON in the state directory.
+type catalog struct {
+	path    string
+	Version int             `json:"version"`
+	Images  []*catalogEntry `json:"images"`
+}
+
+type catalogEntry struct {
+	Path         string    `json:"path"`            // relative to outdir, slash-separated
+	Links        []string  `json:"links,omitempty"` // hard links to the file in other folders, see linkCopy
+	URL          string    `json:"url,omitempty"`
+	SHA256       string    `json:"sha256"`
+	SourceSHA256 string    `json:"sourceSha256,omitempty"` // as downloaded, where -exif-date changed the file since
+	Size         int64     `json:"size"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	PHash        string    `json:"phash,omitempty"`
+	Palette      []string  `json:"palette,omitempty"`    // dominant colors as #rrggbb, most common first
+	Brightness   float64   `json:"brightness,omitempty"` // mean luma, 0-1
+	Thumb        string    `json:"thumb,omitempty"`      // in the cache directory; see thumbFile
+	Title        string    `json:"title,omitempty"`
+	Location     string    `json:"location,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	Copyright    string    `json:"copyright,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	Locales      []string  `json:"locales,omitempty"`
+	Rating       int       `json:"rating,omitempty"` // 1-5, 0 = unrated
+	Favorite     bool      `json:"favorite,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Published    time.Time `json:"published,omitzero"` // as the source gave it
+	Added        time.Time `json:"added"`
+}
+
+func stateDir(outDir string) string {
+	return filepath.Join(outDir, ".spotlightdl")
+}
+
+func openCatalog(outDir string) (*catalog, error) {
+	c := &catalog{path: filepath.Join(stateDir(outDir), "catalog.json")}
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// api converts an entry for the control API.
+func (e *catalogEntry) api() api.Image {
+	return api.Image{
+		Path: e.Path, URL: e.URL, SHA256: e.SHA256, Size: e.Size, Width: e.Width, Height: e.Height,
+		PHash: e.PHash, Palette: e.Palette, Brightness: e.Brightness, Thumb: e.Thumb,
+		Title: e.Title, Location: e.Location, Description: e.Description, Copyright: e.Copyright, Source: e.Source, Locales: e.Locales,
+		Rating: e.Rating, Favorite: e.Favorite, Tags: e.Tags, Published: e.Published, Added: e.Added,
+	}
+}
+
+// save, byPath and add treat a nil catalog (a -lite run) as empty and
+// discard what is added.
+func (c *catalog) save() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	c.Version = catalogVersion
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, b)
+}
+
+func (c *catalog) byPath(rel string) *catalogEntry {
+	if c == nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	for _, e := range c.Images {
+		if e.Path == rel {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *catalog) byURL(u string) *catalogEntry {
+	if c == nil || u == "" {
+		return nil
+	}
+	for _, e := range c.Images {
+		if e.URL == u {
+			return e
+		}
+	}
+	return nil
+}
+
+// byName finds an image by file name in whatever folder it is.
+func (c *catalog) byName(name string) *catalogEntry {
+	if c == nil {
+		return nil
+	}
+	for _, e := range c.Images {
+		if path.Base(e.Path) == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *catalog) bySHA(sum string) *catalogEntry {
+	if c == nil {
+		return nil
+	}
+	for _, e := range c.Images {
+		if e.SHA256 == sum || e.SourceSHA256 == sum && sum != "" {
+			return e
+		}
+	}
+	return nil
+}
+
+// lookup resolves an image given on the command line: a file path, a path
+// relative to outDir, or a unique SHA-256 prefix.
+func (c *catalog) lookup(outDir, ref string) (*catalogEntry, error) {
+	if rel, err := filepath.Rel(outDir, ref); err == nil && exists(ref) {
+		if e := c.byPath(rel); e != nil {
+			return e, nil
+		}
+	}
+	if e := c.byPath(ref); e != nil {
+		return e, nil
+	}
+	var found *catalogEntry
+	if len(ref) >= 6 {
+		for _, e := range c.Images {
+			if strings.HasPrefix(e.SHA256, strings.ToLower(ref)) {
+				if found != nil {
+					return nil, fmt.Errorf("%s: ambiguous hash prefix", ref)
+				}
+				found = e
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: not in the library catalog", ref)
+	}
+	return found, nil
+}
+
+// add inserts e, replacing any entry with the same path.
+func (c *catalog) add(e *catalogEntry) {
+	if c == nil {
+		return
+	}
+	e.Path = filepath.ToSlash(e.Path)
+	for i, old := range c.Images {
+		if old.Path == e.Path {
+			c.Images[i] = e
+			return
+		}
+	}
+	c.Images = append(c.Images, e)
+}
+
+// remove drops the entry with the given path.
+func (c *catalog) remove(rel string) {
+	rel = filepath.ToSlash(rel)
+	c.Images = slices.DeleteFunc(c.Images, func(e *catalogEntry) bool { return e.Path == rel })
+}
+
+// since returns the entries added at or after t.
+func (c *catalog) since(t time.Time) []*catalogEntry {
+	var out []*catalogEntry
+	for _, e := range c.Images {
+		if !e.Added.Before(t) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func imageSize(path string) (width, height int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
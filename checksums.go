@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// -checksums writes the SHA-256 of each download where standard tools
+// find it: a <file>.sha256 sidecar beside the image, checked with
+// `sha256sum -c` in its folder, and/or the SHA256SUMS file at the top of
+// the library, checked there. Both are in the format sha256sum writes.
+// SHA256SUMS grows as downloads complete, and at the end of a run it is
+// written afresh from the catalog, so that it leaves out what was
+// deleted, pruned or moved since.
+
+const checksumsFile = "SHA256SUMS"
+
+type checksumOptions struct {
+	sidecar bool
+	sums    bool
+}
+
+func parseChecksums(spec string) (checksumOptions, error) {
+	var o checksumOptions
+	for _, s := range splitList(spec) {
+		switch strings.ToLower(s) {
+		case "sidecar":
+			o.sidecar = true
+		case "sums":
+			o.sums = true
+		default:
+			return o, fmt.Errorf("-checksums: unknown %q (want sidecar, sums or both)", s)
+		}
+	}
+	return o, nil
+}
+
+func checksumLine(sum, name string) string {
+	return sum + "  " + name + "\n"
+}
+
+// record notes a new download at path, rel inside outDir.
+func (o checksumOptions) record(outDir, path, rel, sum string) error {
+	if o.sidecar {
+		if err := writeChecksumSidecar(path, sum); err != nil {
+			return err
+		}
+	}
+	if o.sums {
+		f, err := os.OpenFile(filepath.Join(outDir, checksumsFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(checksumLine(sum, filepath.ToSlash(rel)))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return nil
+}
+
+func writeChecksumSidecar(path, sum string) error {
+	return writeFileAtomic(path+".sha256", []byte(checksumLine(sum, filepath.Base(path))))
+}
+
+// renameChecksumSidecar rewrites the name in the sidecar of an image that
+// moved to path, if it has one.
+func renameChecksumSidecar(path string) {
+	b, err := os.ReadFile(path + ".sha256")
+	if err != nil {
+		return
+	}
+	if sum, _, ok := strings.Cut(string(b), " "); ok {
+		writeChecksumSidecar(path, sum)
+	}
+}
+
+// writeChecksums writes SHA256SUMS for the whole catalog, sorted by path.
+func writeChecksums(outDir string, cat *catalog) error {
+	lines := make([]string, 0, len(cat.Images))
+	for _, e := range cat.Images {
+		if e.SHA256 != "" {
+			lines = append(lines, checksumLine(e.SHA256, e.Path))
+		}
+	}
+	slices.SortFunc(lines, func(a, b string) int { return strings.Compare(a[64:], b[64:]) })
+	return writeFileAtomic(filepath.Join(outDir, checksumsFile), []byte(strings.Join(lines, "")))
+}
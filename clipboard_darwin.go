@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func copyImageToClipboard(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	class := "JPEG picture"
+	if imageMIME(path) == "image/png" {
+		class = "«class PNGf»"
+	}
+	script := `set the clipboard to (read (POSIX file "` + appleScriptQuote(abs) + `") as ` + class + `)`
+	out, err := exec.Command("osascript", "-e", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("osascript: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
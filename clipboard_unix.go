@@ -0,0 +1,38 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// copyImageToClipboard hands the file to wl-copy on Wayland or xclip on
+// X11; both keep serving the clipboard after we exit.
+func copyImageToClipboard(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var cmd *exec.Cmd
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		cmd = exec.Command("wl-copy", "--type", imageMIME(path))
+	case os.Getenv("DISPLAY") != "":
+		cmd = exec.Command("xclip", "-selection", "clipboard", "-t", imageMIME(path))
+	default:
+		return errors.New("no graphical session (neither WAYLAND_DISPLAY nor DISPLAY is set)")
+	}
+	cmd.Stdin = f
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procOpenClipboard    = moduser32.NewProc("OpenClipboard")
+	procCloseClipboard   = moduser32.NewProc("CloseClipboard")
+	procEmptyClipboard   = moduser32.NewProc("EmptyClipboard")
+	procSetClipboardData = moduser32.NewProc("SetClipboardData")
+
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procGlobalAlloc  = modkernel32.NewProc("GlobalAlloc")
+	procGlobalFree   = modkernel32.NewProc("GlobalFree")
+	procGlobalLock   = modkernel32.NewProc("GlobalLock")
+	procGlobalUnlock = modkernel32.NewProc("GlobalUnlock")
+	procMoveMemory   = modkernel32.NewProc("RtlMoveMemory")
+)
+
+const (
+	cfDIB         = 8
+	gmemMoveable  = 0x0002
+	bitmapInfoLen = 40
+)
+
+// copyImageToClipboard decodes the image and places it on the clipboard
+// as a CF_DIB, which every Windows application can paste.
+func copyImageToClipboard(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	dib := encodeDIB(img)
+
+	h, _, err := procGlobalAlloc.Call(gmemMoveable, uintptr(len(dib)))
+	if h == 0 {
+		return err
+	}
+	p, _, err := procGlobalLock.Call(h)
+	if p == 0 {
+		procGlobalFree.Call(h)
+		return err
+	}
+	procMoveMemory.Call(p, uintptr(unsafe.Pointer(&dib[0])), uintptr(len(dib)))
+	procGlobalUnlock.Call(h)
+
+	if r, _, err := procOpenClipboard.Call(0); r == 0 {
+		procGlobalFree.Call(h)
+		return err
+	}
+	defer procCloseClipboard.Call()
+	procEmptyClipboard.Call()
+	if r, _, err := procSetClipboardData.Call(cfDIB, h); r == 0 {
+		procGlobalFree.Call(h)
+		return errors.New("SetClipboardData: " + err.Error())
+	}
+	// the clipboard owns h now
+	return nil
+}
+
+// encodeDIB lays out a 24-bit bottom-up BITMAPINFOHEADER bitmap.
+func encodeDIB(img image.Image) []byte {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	stride := (w*3 + 3) &^ 3
+	buf := make([]byte, bitmapInfoLen+stride*h)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], bitmapInfoLen)
+	le.PutUint32(buf[4:], uint32(w))
+	le.PutUint32(buf[8:], uint32(h))
+	le.PutUint16(buf[12:], 1)  // planes
+	le.PutUint16(buf[14:], 24) // bits per pixel
+	le.PutUint32(buf[20:], uint32(stride*h))
+	for y := 0; y < h; y++ {
+		row := buf[bitmapInfoLen+(h-1-y)*stride:]
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			row[x*3], row[x*3+1], row[x*3+2] = byte(bl>>8), byte(g>>8), byte(r>>8)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The config file sets defaults for any flag of the fetch run: a key is
+// the flag name, with - or _ between words, and a table prefixes its keys
+// (log.level is -log-level). A table named after a subcommand, such as
+// [daemon] or [bundle.apply], holds that command's flags instead; the
+// command also takes outdir and the log settings from the top level. Flags given on the command
+// line win over environment variables (see applyEnv), which win over the
+// file.
+//
+//	outdir = "~/Pictures/Spotlight"
+//	source = ["spotlight", "wikimedia"]
+//	max_images = 5
+//
+//	[log]
+//	level = "info"
+//
+//	[daemon]
+//	interval = "1h"
+//
+//	[profile.phone-portrait]
+//	outdir = "~/Pictures/Phone"
+//
+// -profile picks one of the [profile.<name>] tables, whose settings win
+// over the top-level ones.
+
+// repeatableFlags take an array element by element instead of joined
+// with commas.
+var repeatableFlags = []string{"source-user-agent"}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "spotlightdl", "config.toml")
+}
+
+// loadConfigFile reads path, or the default location when path is empty.
+// Only an explicitly named file has to exist.
+func loadConfigFile(path string) (map[string]any, error) {
+	explicit := path != ""
+	if !explicit {
+		if path = defaultConfigPath(); path == "" {
+			return nil, nil
+		}
+	}
+	b, err := os.ReadFile(expandHome(path))
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseTOML(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// applyConfig sets each flag named in table that was not given on the
+// command line or by the environment. Tables named after subcommands are skipped; the command
+// applies its own with configSection.
+func applyConfig(flags *flag.FlagSet, table map[string]any, prefix string) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return applyConfigTable(flags, table, prefix, given, nil)
+}
+
+// applyConfigTable applies table; with only, just those flags, and
+// settings for others are passed over rather than unknown.
+func applyConfigTable(flags *flag.FlagSet, table map[string]any, prefix string, given map[string]bool, only []string) error {
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		name := prefix + strings.ReplaceAll(k, "_", "-")
+		if sub, ok := table[k].(map[string]any); ok {
+			if _, cmd := commands[k]; (cmd || k == "profile") && prefix == "" {
+				continue
+			}
+			if err := applyConfigTable(flags, sub, name+"-", given, only); err != nil {
+				return err
+			}
+			continue
+		}
+		if only != nil && (!slices.Contains(only, name) || flags.Lookup(name) == nil) {
+			continue
+		}
+		f := flags.Lookup(name)
+		if f == nil || name == "config" || name == "profile" {
+			return fmt.Errorf("config: unknown setting %q", name)
+		}
+		if given[name] {
+			continue
+		}
+		var values []string
+		if arr, ok := table[k].([]any); ok {
+			for _, v := range arr {
+				values = append(values, configString(v))
+			}
+			if !slices.Contains(repeatableFlags, name) {
+				values = []string{strings.Join(values, ",")}
+			}
+		} else {
+			values = []string{configString(table[k])}
+		}
+		for _, v := range values {
+			// through the FlagSet, so that the flag counts as given for
+			// the tables applied after this one
+			if err := flags.Set(name, v); err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configProfile returns the [profile.<name>] table.
+func configProfile(doc map[string]any, name string) (map[string]any, error) {
+	profiles, _ := doc["profile"].(map[string]any)
+	p, ok := profiles[name].(map[string]any)
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("config: no profile %q; the config file defines none", name)
+		}
+		return nil, fmt.Errorf("config: no profile %q (have %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// configSection returns a subcommand's table, if any: [prune] for prune,
+// [bundle.apply] for bundle apply.
+func configSection(doc map[string]any, command string) map[string]any {
+	t := doc
+	for _, name := range strings.Fields(command) {
+		t, _ = t[name].(map[string]any)
+	}
+	return t
+}
+
+func configString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// sharedFlags mean the same to every command, so a subcommand also takes
+// them from the run's variables: SPOTLIGHTDL_OUTDIR covers prune as well.
+var sharedFlags = []string{"outdir", "log-level", "log-format", "log-target", "log-file",
+	"log-max-size", "log-max-age", "log-keep"}
+
+// envName is SPOTLIGHTDL_ plus prefix and the flag name in upper case
+// with _ for - and spaces: SPOTLIGHTDL_MAX_IMAGES,
+// SPOTLIGHTDL_DAEMON_INTERVAL, SPOTLIGHTDL_BUNDLE_CREATE_SINCE.
+func envName(prefix, flagName string) string {
+	return "SPOTLIGHTDL_" + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(prefix+flagName))
+}
+
+// applyEnv sets every flag not given on the command line from its
+// environment variable. A repeatable flag takes one value per line.
+func applyEnv(flags *flag.FlagSet, prefix string) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || err != nil {
+			return
+		}
+		name := envName(prefix, f.Name)
+		v, ok := os.LookupEnv(name)
+		if !ok && prefix != "" && slices.Contains(sharedFlags, f.Name) {
+			name = envName("", f.Name)
+			v, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			return
+		}
+		values := []string{v}
+		if slices.Contains(repeatableFlags, f.Name) {
+			values = strings.FieldsFunc(v, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+		for _, v := range values {
+			if serr := flags.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid value %q for $%s: %w", v, name, serr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// parseFlags parses a subcommand's flags and fills in the rest from
+// SPOTLIGHTDL_<COMMAND>_<FLAG>, then from the config file: the command's
+// table, and the sharedFlags of the $SPOTLIGHTDL_PROFILE profile and the
+// top level. A command with a -config flag of its own, like the daemon,
+// reads the file itself. A bad value exits like a bad flag would.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	flags.Parse(args)
+	err := applyEnv(flags, flags.Name()+"_")
+	if err == nil && flags.Lookup("config") == nil {
+		err = applyCommandConfig(flags)
+	}
+	if err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		os.Exit(2)
+	}
+}
+
+func applyCommandConfig(flags *flag.FlagSet) error {
+	doc, err := loadConfigFile(os.Getenv("SPOTLIGHTDL_CONFIG"))
+	if err != nil || doc == nil {
+		return err
+	}
+	if err := applyConfig(flags, configSection(doc, flags.Name()), ""); err != nil {
+		return fmt.Errorf("[%s]: %w", strings.ReplaceAll(flags.Name(), " ", "."), err)
+	}
+	tables := []map[string]any{doc}
+	if name := os.Getenv("SPOTLIGHTDL_PROFILE"); name != "" {
+		p, err := configProfile(doc, name)
+		if err != nil {
+			return err
+		}
+		tables = []map[string]any{p, doc}
+	}
+	for _, t := range tables {
+		given := make(map[string]bool)
+		flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		if err := applyConfigTable(flags, t, "", given, sharedFlags); err != nil {
+			return err
+		}
+	}
+	if f := flags.Lookup("outdir"); f != nil {
+		f.Value.Set(expandHome(f.Value.String()))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Same probe Windows' NCSI uses; a captive portal either redirects it or
+// answers with its own login page. Any other answer, such as a corporate
+// proxy's 403, is not taken for one: the run goes ahead without waiting.
+const (
+	connectTestURL  = "http://www.msftconnecttest.com/connecttest.txt"
+	connectTestBody = "Microsoft Connect Test"
+)
+
+type captivePortalError struct {
+	Location string
+}
+
+func (e *captivePortalError) Error() string {
+	if e.Location != "" {
+		return "captive portal detected: sign in at " + e.Location
+	}
+	return "captive portal detected: network requires sign-in"
+}
+
+func isCaptivePortal(err error) bool {
+	var pe *captivePortalError
+	return errors.As(err, &pe)
+}
+
+// checkConnectivity returns nil when the probe comes back untouched, a
+// *captivePortalError when it was redirected or answered with another
+// page, and an ordinary error for anything else.
+func checkConnectivity(ctx context.Context, client *http.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	probe := *client
+	probe.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, connectTestURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := probe.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return &captivePortalError{Location: resp.Header.Get("Location")}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connectivity probe: %s", resp.Status)
+	}
+	if strings.TrimSpace(string(body)) != connectTestBody {
+		return &captivePortalError{}
+	}
+	return nil
+}
+
+// waitForPortal tells the user about the portal once and polls until the
+// probe passes or timeout expires.
+func waitForPortal(ctx context.Context, client *http.Client, notes *notifyRouter, portal error, timeout time.Duration) error {
+	notes.send(ctx, notification{Event: "portal", Title: "Spotlight download paused", Message: portal.Error()})
+	slog.Warn("waiting for captive portal sign-in", "err", portal, "timeout", timeout)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(15 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err := checkConnectivity(ctx, client)
+		if err == nil {
+			slog.Info("connectivity restored")
+			return nil
+		}
+		if !isCaptivePortal(err) {
+			slog.Debug("connectivity check", "err", err)
+		}
+	}
+	return portal
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestCheckConnectivity(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		location string
+		body     string
+		portal   bool
+		ok       bool
+	}{
+		{name: "untouched", status: 200, body: connectTestBody + "\n", ok: true},
+		{name: "redirect", status: 302, location: "http://login.hotel/", portal: true},
+		{name: "login page", status: 200, body: "<html>sign in</html>", portal: true},
+		{name: "proxy refuses", status: 403, body: "forbidden"},
+		{name: "server error", status: 503},
+	}
+	for _, tt := range tests {
+		client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			h := make(http.Header)
+			if tt.location != "" {
+				h.Set("Location", tt.location)
+			}
+			return &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: h,
+				Body: io.NopCloser(strings.NewReader(tt.body)), Request: r}, nil
+		})}
+		err := checkConnectivity(context.Background(), client)
+		if (err == nil) != tt.ok || isCaptivePortal(err) != tt.portal {
+			t.Errorf("%s: err = %v, want ok %v, portal %v", tt.name, err, tt.ok, tt.portal)
+		}
+		if tt.location != "" && !strings.Contains(err.Error(), tt.location) {
+			t.Errorf("%s: %v does not name %s", tt.name, err, tt.location)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/drzo1dberg/spotlightDlGo/api"
+)
+
+// The catalog half of the daemon's control API, speaking the types of the
+// api package:
+//
+//	GET    /api/v1/images?q=&favorite=true&tag=&limit=50&offset=0  (limit up to 1000)
+//	GET    /api/v1/images/{sha}
+//	PUT    /api/v1/images/{sha}/favorite
+//	DELETE /api/v1/images/{sha}/favorite
+//	DELETE /api/v1/images/{sha}
+//	GET    /api/v1/schema  (JSON Schema of the above, no token needed)
+//
+// {sha} may be a unique prefix of at least 6 characters. Changes are
+// refused with 409 while a fetch runs, since the fetch would write its own
+// copy of the catalog over them, and deletes with 423 while the library
+// is frozen.
+
+// maxPageSize caps ?limit; a larger one gets this many.
+const maxPageSize = 1000
+
+var errFetchRunning = errors.New("a fetch is running, try again when it is done")
+
+func (d *daemon) registerControl(mux *http.ServeMux, token string) {
+	handle := func(pattern string, fn func(http.ResponseWriter, *http.Request) error) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(r, token) {
+				writeJSON(w, http.StatusUnauthorized, api.Error{Message: "unauthorized"})
+				return
+			}
+			if err := fn(w, r); err != nil {
+				status := http.StatusInternalServerError
+				var he httpError
+				switch {
+				case errors.As(err, &he):
+					status = he.status
+				case errors.Is(err, errFetchRunning), errors.As(err, new(*lockedError)):
+					status = http.StatusConflict
+				case errors.As(err, new(*frozenError)):
+					status = http.StatusLocked
+				}
+				writeJSON(w, status, api.Error{Message: err.Error()})
+			}
+		})
+	}
+
+	// the schema is public, like /healthz
+	mux.HandleFunc("GET /api/v1/schema", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(api.Schema)
+	})
+
+	handle("GET /api/v1/images", func(w http.ResponseWriter, r *http.Request) error {
+		cat, err := d.lib.current()
+		if err != nil {
+			return err
+		}
+		q := r.URL.Query()
+		limit, offset := 50, 0
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+				return httpError{http.StatusBadRequest, "invalid limit " + v}
+			}
+			limit = min(limit, maxPageSize)
+		}
+		if v := q.Get("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				return httpError{http.StatusBadRequest, "invalid offset " + v}
+			}
+		}
+		favOnly := q.Get("favorite") == "true"
+		tags := parseTagFilter(q.Get("tag"))
+		text := strings.TrimSpace(q.Get("q"))
+		hits := []*catalogEntry{}
+		for _, e := range cat.Images {
+			if (!favOnly || e.Favorite) && tags.admits(e.Tags) && matchesQuery(e, text) {
+				hits = append(hits, e)
+			}
+		}
+		slices.SortStableFunc(hits, func(a, b *catalogEntry) int { return b.Added.Compare(a.Added) })
+		total := len(hits)
+		offset = min(offset, total)
+		hits = hits[offset : offset+min(limit, total-offset)]
+		list := api.ImageList{Total: total, Images: []api.Image{}}
+		for _, e := range hits {
+			list.Images = append(list.Images, e.api())
+		}
+		writeJSON(w, http.StatusOK, list)
+		return nil
+	})
+
+	handle("GET /api/v1/images/{sha}", func(w http.ResponseWriter, r *http.Request) error {
+		cat, err := d.lib.current()
+		if err != nil {
+			return err
+		}
+		e, err := lookupSHA(cat, r.PathValue("sha"))
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, e.api())
+		return nil
+	})
+
+	favorite := func(on bool) func(http.ResponseWriter, *http.Request) error {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			var out api.Image
+			err := d.change(func(cat *catalog) error {
+				e, err := lookupSHA(cat, r.PathValue("sha"))
+				if err != nil {
+					return err
+				}
+				e.Favorite = on
+				out = e.api()
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			writeJSON(w, http.StatusOK, out)
+			return nil
+		}
+	}
+	handle("PUT /api/v1/images/{sha}/favorite", favorite(true))
+	handle("DELETE /api/v1/images/{sha}/favorite", favorite(false))
+
+	handle("DELETE /api/v1/images/{sha}", func(w http.ResponseWriter, r *http.Request) error {
+		var path string
+		err := d.change(func(cat *catalog) error {
+			e, err := lookupSHA(cat, r.PathValue("sha"))
+			if err != nil {
+				return err
+			}
+			path = e.Path
+			// deleteImage saves; update saves again, which is harmless
+			return deleteImage(cat, d.outDir, e)
+		})
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, api.Status{Status: "deleted", Path: path})
+		return nil
+	})
+}
+
+// change runs fn on the catalog unless a fetch is in progress.
+func (d *daemon) change(fn func(*catalog) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fetching {
+		return errFetchRunning
+	}
+	return d.lib.update(fn)
+}
+
+// lookupSHA resolves a full hash or a unique prefix; unlike catalog.lookup
+// it never treats the reference as a file path.
+func lookupSHA(cat *catalog, ref string) (*catalogEntry, error) {
+	ref = strings.ToLower(ref)
+	if len(ref) < 6 || strings.Trim(ref, "0123456789abcdef") != "" {
+		return nil, httpError{http.StatusBadRequest, "expected a SHA-256 or a prefix of at least 6 hex digits"}
+	}
+	e, err := cat.lookup("", ref)
+	if err != nil {
+		return nil, httpError{http.StatusNotFound, err.Error()}
+	}
+	return e, nil
+}
+
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e httpError) Error() string { return e.msg }
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/drzo1dberg/spotlightDlGo/api"
+)
+
+func init() {
+	registerCommand("daemon", cmdDaemon)
+	registerCommand("trigger", cmdTrigger)
+}
+
+func daemonSocket(outDir string) string {
+	return filepath.Join(localStateDir(outDir), "control", "daemon.sock")
+}
+
+// daemon runs fetches on an interval and on demand. Everything after the
+// daemon's own flags is passed to each fetch run, which is a child process
+// so a crashing run never takes the daemon down.
+type daemon struct {
+	outDir    string
+	fetchArgs []string
+	rate      time.Duration
+	healthAge time.Duration
+
+	lib *library
+	ctx context.Context // done on SIGINT or SIGTERM, which triggered fetches stop on too
+
+	mu       sync.Mutex
+	fetching bool
+	fetches  sync.WaitGroup
+}
+
+// daemonOptions are the daemon's settings after flags, environment and
+// config file; SIGHUP resolves them again.
+type daemonOptions struct {
+	outDir    string
+	interval  time.Duration
+	listen    string
+	rate      time.Duration
+	healthAge time.Duration // 0: twice the interval
+	watch     bool
+	logging   *logFlags
+	fetchArgs []string
+}
+
+func parseDaemonOptions(args []string) (*daemonOptions, error) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	interval := flags.Duration("interval", 6*time.Hour, "time between scheduled fetches (0 = only on trigger)")
+	listen := flags.String("listen", "", "also serve the trigger API over HTTP on this address, e.g. 127.0.0.1:8765 (needs $SPOTLIGHTDL_DAEMON_TOKEN)")
+	rate := flags.Duration("trigger-rate", 30*time.Second, "minimum average time between accepted triggers")
+	healthAge := flags.Duration("health-max-age", 0, "report unhealthy on /healthz when no fetch succeeded for this long (default twice -interval)")
+	watch := flags.Bool("watch", false, "keep the catalog in sync with files added, moved or deleted by hand")
+	logging := addLogFlags(flags, "info")
+	configPath := flags.String("config", "", "config file; its [daemon] table sets these flags and the fetches read the rest")
+	profile := flags.String("profile", "", "config profile for the fetches; its outdir is the daemon's too")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl daemon [flags] [-- fetch flags]")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	doc, err := loadConfigFile(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	outDirGiven := false
+	flags.Visit(func(f *flag.Flag) { outDirGiven = outDirGiven || f.Name == "outdir" })
+	if err := applyConfig(flags, configSection(doc, "daemon"), ""); err != nil {
+		return nil, err
+	}
+	// the library is shared with the fetches' own setting
+	fetchConf := doc
+	if *profile != "" {
+		if fetchConf, err = configProfile(doc, *profile); err != nil {
+			return nil, err
+		}
+		if _, ok := fetchConf["outdir"]; !ok {
+			fetchConf = doc
+		}
+	}
+	if v, ok := fetchConf["outdir"].(string); ok && !outDirGiven && configSection(doc, "daemon")["outdir"] == nil {
+		*outDir = v
+	}
+	o := &daemonOptions{
+		outDir:    expandHome(*outDir),
+		interval:  *interval,
+		listen:    *listen,
+		rate:      *rate,
+		healthAge: *healthAge,
+		watch:     *watch,
+		logging:   logging,
+	}
+
+	// fetches log like the daemon unless their own flags say otherwise
+	o.fetchArgs = append([]string{"-outdir", o.outDir}, logging.args()...)
+	if *profile != "" {
+		o.fetchArgs = append(o.fetchArgs, "-profile", *profile)
+	}
+	if *configPath != "" {
+		o.fetchArgs = append(o.fetchArgs, "-config", *configPath)
+	}
+	o.fetchArgs = append(o.fetchArgs, flags.Args()...)
+	return o, nil
+}
+
+func cmdDaemon(args []string) error {
+	opts, err := parseDaemonOptions(args)
+	if err != nil {
+		return err
+	}
+	if err := opts.logging.setup(false); err != nil {
+		return err
+	}
+	d := &daemon{
+		outDir:    opts.outDir,
+		fetchArgs: opts.fetchArgs,
+		rate:      opts.rate,
+		lib:       newLibrary(opts.outDir),
+		healthAge: opts.healthAge,
+	}
+	if d.healthAge == 0 {
+		d.healthAge = 2 * opts.interval
+	}
+	if err := os.MkdirAll(localStateDir(opts.outDir), 0o755); err != nil {
+		return err
+	}
+
+	// SIGINT or SIGTERM passes on to a running fetch, which finishes
+	// cleanly, and the daemon exits once it has
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	d.ctx = ctx
+	errc := make(chan error, 3)
+
+	// IPC: a unix socket in the state directory; file permissions are the
+	// authentication, so no token is needed. It is made in a directory
+	// only we can enter, so it is never reachable by others, not even
+	// between Listen and Chmod.
+	sock := daemonSocket(opts.outDir)
+	if err := os.MkdirAll(filepath.Dir(sock), 0o700); err != nil {
+		return err
+	}
+	if err := os.Chmod(filepath.Dir(sock), 0o700); err != nil {
+		return err
+	}
+	os.Remove(sock)
+	ul, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sock)
+	if err := os.Chmod(sock, 0o600); err != nil {
+		return err
+	}
+	go func() { errc <- http.Serve(ul, d.handler("")) }()
+
+	if opts.listen != "" {
+		token := strings.TrimSpace(os.Getenv("SPOTLIGHTDL_DAEMON_TOKEN"))
+		if token == "" {
+			return errors.New("daemon: -listen needs a token in $SPOTLIGHTDL_DAEMON_TOKEN")
+		}
+		srv := &http.Server{Addr: opts.listen, Handler: d.handler(token), ReadHeaderTimeout: 10 * time.Second}
+		go func() { errc <- srv.ListenAndServe() }()
+	}
+
+	if opts.watch {
+		go func() { errc <- watchLibrary(opts.outDir, 2*time.Second, d.busy, false) }()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	slog.Info("daemon started", "outdir", opts.outDir, "socket", sock, "interval", opts.interval, "listen", opts.listen)
+	ticker := time.NewTicker(time.Hour)
+	ticker.Stop()
+	defer ticker.Stop()
+	if opts.interval > 0 {
+		ticker.Reset(opts.interval)
+		d.startFetch(ctx)
+	}
+	for {
+		select {
+		case <-ticker.C:
+			d.startFetch(ctx)
+		case <-hup:
+			next, err := d.reload(opts, args)
+			if err != nil {
+				slog.Error("daemon: reload failed, keeping the current settings", "err", err)
+				continue
+			}
+			if next.interval != opts.interval {
+				ticker.Stop()
+				if next.interval > 0 {
+					ticker.Reset(next.interval)
+				}
+			}
+			opts = next
+		case <-ctx.Done():
+			slog.Info("daemon stopping")
+			d.fetches.Wait()
+			return nil
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+// reload resolves the settings again for SIGHUP. Fetches read the config
+// file themselves, so new locales or sources apply from the next run;
+// the daemon itself takes a new interval, log settings and fetch flags.
+// Listeners, the library and the watcher stay as they were started.
+func (d *daemon) reload(cur *daemonOptions, args []string) (*daemonOptions, error) {
+	next, err := parseDaemonOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	for name, changed := range map[string]bool{
+		"outdir":         next.outDir != cur.outDir,
+		"listen":         next.listen != cur.listen,
+		"watch":          next.watch != cur.watch,
+		"trigger-rate":   next.rate != cur.rate,
+		"health-max-age": next.healthAge != cur.healthAge,
+	} {
+		if changed {
+			slog.Warn("daemon: setting changed, takes effect after a restart", "setting", name)
+		}
+	}
+	// keep what cannot change, so the next reload compares against it
+	next.outDir, next.listen, next.watch, next.rate, next.healthAge = cur.outDir, cur.listen, cur.watch, cur.rate, cur.healthAge
+	next.fetchArgs[1] = cur.outDir // fetchArgs start with -outdir
+	if !slices.Equal(next.logging.args(), cur.logging.args()) {
+		if err := next.logging.setup(false); err != nil {
+			return nil, err
+		}
+	}
+	d.mu.Lock()
+	d.fetchArgs = next.fetchArgs
+	d.mu.Unlock()
+	slog.Info("daemon: config reloaded", "interval", next.interval)
+	return next, nil
+}
+
+// busy reports whether a fetch is running; the watcher leaves the catalog
+// alone meanwhile and catches up on the next change.
+func (d *daemon) busy() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fetching
+}
+
+// startFetch launches a fetch run in the background unless one is
+// already going, and reports whether it did.
+func (d *daemon) startFetch(ctx context.Context) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fetching {
+		return false
+	}
+	d.fetching = true
+	d.fetches.Add(1)
+	go d.runFetch(ctx)
+	return true
+}
+
+func (d *daemon) runFetch(ctx context.Context) {
+	defer d.fetches.Done()
+	defer func() {
+		d.mu.Lock()
+		d.fetching = false
+		d.mu.Unlock()
+	}()
+	exe, err := os.Executable()
+	if err != nil {
+		slog.Error("daemon: cannot start fetch", "err", err)
+		return
+	}
+	d.mu.Lock()
+	args := d.fetchArgs
+	d.mu.Unlock()
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// on shutdown the fetch gets an interrupt, so it can clean up, and is
+	// killed if it has not exited after WaitDelay
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = 30 * time.Second
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		slog.Info("daemon: fetch interrupted")
+	case errors.As(err, &exit) && exit.ExitCode() == exitNoNew:
+	case errors.As(err, &exit) && exit.ExitCode() == exitPartial:
+		slog.Warn("daemon: some downloads failed")
+	case errors.As(err, &exit) && exit.ExitCode() == exitLocked:
+		slog.Info("daemon: fetch skipped, another run is working on the library")
+	default:
+		slog.Error("daemon: fetch failed", "err", err)
+	}
+}
+
+func (d *daemon) wallpaper() error {
+	if err := checkFrozen(d.outDir, "wallpaper"); err != nil {
+		return err
+	}
+	cat, err := openCatalog(d.outDir)
+	if err != nil {
+		return err
+	}
+	pol, err := loadPolicy(d.outDir)
+	if err != nil {
+		return err
+	}
+	w := pol.Wallpaper
+	if w.Mode == "" || w.Mode == "off" {
+		w.Mode = "random"
+	}
+	e := pickWallpaper(cat, d.outDir, "", w)
+	if e == nil {
+		return errors.New("no images in the library")
+	}
+	return setWallpaper(filepath.Join(d.outDir, filepath.FromSlash(e.Path)))
+}
+
+// handler serves the control API: POST /api/v1/trigger?action=fetch|wallpaper,
+// GET /metrics, GET /healthz and the catalog endpoints in controlapi.go. An empty token disables
+// authentication (for the socket). Each listener has its own rate limit.
+func (d *daemon) handler(token string) http.Handler {
+	limit := newRateLimiter(d.rate, 3)
+	// requests without the token have a bucket of their own, so they
+	// cannot use up the triggers of those with it
+	denied := newRateLimiter(d.rate, 3)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/trigger", func(w http.ResponseWriter, r *http.Request) {
+		bucket := limit
+		if !authorized(r, token) {
+			bucket = denied
+		}
+		if wait := bucket.take(); wait > 0 {
+			w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds()+1)))
+			writeJSON(w, http.StatusTooManyRequests, api.Error{Message: "rate limited"})
+			return
+		}
+		if bucket == denied {
+			writeJSON(w, http.StatusUnauthorized, api.Error{Message: "unauthorized"})
+			return
+		}
+		switch action := firstNonEmpty(r.URL.Query().Get("action"), "fetch"); action {
+		case "fetch":
+			if d.startFetch(d.ctx) {
+				writeJSON(w, http.StatusAccepted, api.Status{Status: "fetch started"})
+			} else {
+				writeJSON(w, http.StatusAccepted, api.Status{Status: "fetch already running"})
+			}
+		case "wallpaper":
+			if err := d.wallpaper(); err != nil {
+				status := http.StatusInternalServerError
+				if errors.As(err, new(*frozenError)) {
+					status = http.StatusLocked
+				}
+				writeJSON(w, status, api.Error{Message: err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, api.Status{Status: "wallpaper changed"})
+		default:
+			writeJSON(w, http.StatusBadRequest, api.Error{Message: "unknown action " + action})
+		}
+	})
+	// liveness probes rarely carry credentials, and the report holds no secrets
+	mux.HandleFunc("GET /healthz", healthHandler(d.outDir, d.healthAge, d.busy))
+	metrics := metricsHandler(d.lib, d.busy)
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			writeJSON(w, http.StatusUnauthorized, api.Error{Message: "unauthorized"})
+			return
+		}
+		metrics(w, r)
+	})
+	d.registerControl(mux, token)
+	return mux
+}
+
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// rateLimiter is a token bucket: burst triggers at once, then one per
+// interval on average.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	return &rateLimiter{interval: interval, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// take consumes a token, or reports how long until one is available.
+func (l *rateLimiter) take() time.Duration {
+	if l.interval <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	l.last = now
+	if l.tokens < 1 {
+		return time.Duration((1 - l.tokens) * float64(l.interval))
+	}
+	l.tokens--
+	return 0
+}
+
+// cmdTrigger is the local client for the daemon's socket.
+func cmdTrigger(args []string) error {
+	flags := flag.NewFlagSet("trigger", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory of the running daemon")
+	action := flags.String("action", "fetch", "fetch or wallpaper")
+	parseFlags(flags, args)
+
+	client := api.NewSocketClient(daemonSocket(*outDir))
+	st, err := client.Trigger(context.Background(), *action)
+	var se *api.StatusError
+	if errors.As(err, &se) {
+		return fmt.Errorf("trigger: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("trigger: is the daemon running? %w", err)
+	}
+	fmt.Println(st.Status)
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dedupe cleans up a library that collected the same picture more than
+// once, from before the download check existed, from imports or from
+// copying folders around. Byte-identical files are found by SHA-256;
+// with -similar, near-duplicates (re-encodes, other sizes) by perceptual
+// hash. One copy stays and the others go to the trash like pruned images,
+// their ratings, tags and locales merged into the one that stays.
+
+func init() {
+	registerCommand("dedupe", cmdDedupe)
+}
+
+func cmdDedupe(args []string) error {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	dryRun := flags.Bool("dry-run", false, "show the duplicates without touching anything")
+	link := flags.Bool("link", false, "replace byte-identical copies with hard links instead of removing them")
+	similar := flags.Int("similar", 0, "also collapse near-duplicates whose perceptual hashes differ in at most this many bits (try 4), keeping the highest resolution")
+	parseFlags(flags, args)
+
+	if *similar < 0 || *similar > 32 {
+		return fmt.Errorf("dedupe: -similar must be between 0 and 32")
+	}
+	if !*dryRun {
+		lock, err := lockLibrary(context.Background(), *outDir, "dedupe", *lockWait)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+		if err := checkFrozen(*outDir, "dedupe"); err != nil {
+			return err
+		}
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	trash, err := loadTrash(*outDir)
+	if err != nil {
+		return err
+	}
+	var prev map[string]snapshotFile
+	if b, err := os.ReadFile(filepath.Join(stateDir(*outDir), "snapshot.json")); err == nil {
+		json.Unmarshal(b, &prev)
+	}
+	// hard links of -organize locale are the catalog's own
+	files, err := scanArchive(*outDir, prev, cat.linkedPaths())
+	if err != nil {
+		return err
+	}
+
+	// every file gets an entry; files the catalog does not know get a
+	// stand-in, so that the trash can give them back
+	now := time.Now()
+	var entries []*catalogEntry
+	untracked := make(map[*catalogEntry]bool)
+	for rel, f := range files {
+		e := cat.byPath(rel)
+		if e == nil {
+			e = &catalogEntry{Path: rel, SHA256: f.SHA256, Size: f.Size, Added: f.MTime}
+			untracked[e] = true
+		}
+		entries = append(entries, e)
+	}
+	// the catalog's copy wins, so that nothing it knows is lost
+	prefer := func(a, b *catalogEntry) int {
+		if untracked[a] != untracked[b] {
+			if untracked[a] {
+				return 1
+			}
+			return -1
+		}
+		return preferEntry(a, b)
+	}
+	slices.SortFunc(entries, func(a, b *catalogEntry) int { return strings.Compare(a.Path, b.Path) })
+
+	var removed, linked int
+	var freed int64
+	drop := func(keep, dup *catalogEntry, why string) error {
+		if !linkedCopies(*outDir, keep, dup) {
+			freed += dup.Size
+		}
+		if *link && why == "identical" {
+			linked++
+			fmt.Printf("= %s -> %s\n", dup.Path, keep.Path)
+			if *dryRun {
+				return nil
+			}
+			return linkDuplicate(*outDir, keep, dup)
+		}
+		removed++
+		fmt.Printf("- %s (%s to %s)\n", dup.Path, why, keep.Path)
+		if *dryRun {
+			return nil
+		}
+		mergeEntry(keep, dup)
+		if trash, err = trashImage(*outDir, cat, trash, dup, now); err != nil {
+			return err
+		}
+		removeEmptyDirs(*outDir, filepath.Dir(filepath.Join(*outDir, filepath.FromSlash(dup.Path))))
+		return nil
+	}
+
+	// by what is on disk now, which the catalog may not have caught up with
+	bySum := make(map[string][]*catalogEntry)
+	for _, e := range entries {
+		sum := files[e.Path].SHA256
+		bySum[sum] = append(bySum[sum], e)
+	}
+	var left []*catalogEntry // one per content, for -similar
+	for _, e := range entries {
+		sum := files[e.Path].SHA256
+		group := bySum[sum]
+		if group == nil {
+			continue
+		}
+		delete(bySum, sum)
+		keep := slices.MinFunc(group, prefer)
+		left = append(left, keep)
+		for _, dup := range group {
+			if dup == keep || (*link && linkedCopies(*outDir, keep, dup)) {
+				continue
+			}
+			if err := drop(keep, dup, "identical"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *similar > 0 {
+		for _, group := range similarGroups(*outDir, left, *similar) {
+			keep := slices.MinFunc(group, func(a, b *catalogEntry) int {
+				if d := b.Width*b.Height - a.Width*a.Height; d != 0 {
+					return d
+				}
+				return prefer(a, b)
+			})
+			for _, dup := range group {
+				if dup != keep {
+					if err := drop(keep, dup, "similar"); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("%s %d duplicate(s)", verb, removed)
+	if *link {
+		fmt.Printf(", link %d", linked)
+	}
+	fmt.Printf(", freeing %s\n", formatBytes(freed))
+	if *dryRun || removed+linked == 0 {
+		return nil
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	return saveTrash(*outDir, trash)
+}
+
+// preferEntry orders copies of one picture by which to keep: the one
+// with the user's attention (favorite, rating), then the one that has
+// been there longest, then by path.
+func preferEntry(a, b *catalogEntry) int {
+	if a.Favorite != b.Favorite {
+		if a.Favorite {
+			return -1
+		}
+		return 1
+	}
+	if a.Rating != b.Rating {
+		return b.Rating - a.Rating
+	}
+	if c := a.Added.Compare(b.Added); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// mergeEntry carries what the user and the sources said about dup over
+// to keep.
+func mergeEntry(keep, dup *catalogEntry) {
+	keep.Favorite = keep.Favorite || dup.Favorite
+	keep.Rating = max(keep.Rating, dup.Rating)
+	for _, t := range dup.Tags {
+		if !slices.Contains(keep.Tags, t) {
+			keep.Tags = append(keep.Tags, t)
+		}
+	}
+	for _, l := range dup.Locales {
+		addLocale(keep, l)
+	}
+	keep.Title = firstNonEmpty(keep.Title, dup.Title)
+	keep.Location = firstNonEmpty(keep.Location, dup.Location)
+	keep.Description = firstNonEmpty(keep.Description, dup.Description)
+	keep.Copyright = firstNonEmpty(keep.Copyright, dup.Copyright)
+}
+
+// linkedCopies reports whether a and b are hard links to one file.
+func linkedCopies(outDir string, a, b *catalogEntry) bool {
+	fa, err1 := os.Stat(filepath.Join(outDir, filepath.FromSlash(a.Path)))
+	fb, err2 := os.Stat(filepath.Join(outDir, filepath.FromSlash(b.Path)))
+	return err1 == nil && err2 == nil && os.SameFile(fa, fb)
+}
+
+// linkDuplicate replaces dup with a hard link to keep, via a temporary
+// name so that dup is never missing.
+func linkDuplicate(outDir string, keep, dup *catalogEntry) error {
+	target := filepath.Join(outDir, filepath.FromSlash(dup.Path))
+	tmp := target + ".link"
+	if err := os.Link(filepath.Join(outDir, filepath.FromSlash(keep.Path)), tmp); err != nil {
+		return fmt.Errorf("dedupe: %w (hard links need both files on one file system)", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// similarGroups clusters images whose perceptual hashes are within
+// maxDist bits, computing the hashes analyze has not stored yet.
+func similarGroups(outDir string, entries []*catalogEntry, maxDist int) [][]*catalogEntry {
+	type hashed struct {
+		e *catalogEntry
+		h uint64
+	}
+	var hs []hashed
+	for _, e := range entries {
+		if h, err := strconv.ParseUint(e.PHash, 16, 64); err == nil && e.PHash != "" && e.Width > 0 {
+			hs = append(hs, hashed{e, h})
+			continue
+		}
+		img, err := decodeImage(filepath.Join(outDir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			continue
+		}
+		b := img.Bounds()
+		e.Width, e.Height = b.Dx(), b.Dy()
+		e.PHash = formatPHash(pHashImage(img))
+		h, _ := strconv.ParseUint(e.PHash, 16, 64)
+		hs = append(hs, hashed{e, h})
+	}
+
+	// union-find over all close pairs
+	parent := make([]int, len(hs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range hs {
+		for j := i + 1; j < len(hs); j++ {
+			if bits.OnesCount64(hs[i].h^hs[j].h) <= maxDist {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	groups := make(map[int][]*catalogEntry)
+	var order []int
+	for i, x := range hs {
+		r := find(i)
+		if groups[r] == nil {
+			order = append(order, r)
+		}
+		groups[r] = append(groups[r], x.e)
+	}
+	var out [][]*catalogEntry
+	for _, r := range order {
+		if len(groups[r]) > 1 {
+			out = append(out, groups[r])
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Where things live. The library's own records (catalog, history, trash,
+// policy) stay in <outdir>/.spotlightdl and travel with the images. What
+// only matters on this machine goes to the platform's usual places:
+//
+//	config   $XDG_CONFIG_HOME   ~/Library/Application Support   %AppData%
+//	cache    $XDG_CACHE_HOME    ~/Library/Caches                %LocalAppData%
+//	state    $XDG_STATE_HOME    ~/Library/Application Support   %LocalAppData%
+//
+// each under spotlightdl/, with a directory per library for the cache
+// (thumbnails) and state (usage statistics, the daemon's socket).
+
+// userStateDir is os.UserConfigDir for state, which the standard library
+// has no function for.
+func userStateDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return os.UserCacheDir()
+	case "darwin", "ios":
+		return os.UserConfigDir()
+	}
+	// the spec says to ignore a relative path
+	if d := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(d) {
+		return d, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// cacheDir holds what can be rebuilt from the library, like thumbnails.
+func cacheDir(outDir string) string {
+	base, err := os.UserCacheDir()
+	return perLibraryDir(base, err, outDir)
+}
+
+// localStateDir holds this machine's state about the library.
+func localStateDir(outDir string) string {
+	base, err := userStateDir()
+	return perLibraryDir(base, err, outDir)
+}
+
+// perLibraryDir falls back to the library's .spotlightdl when the user
+// directory is unknown, e.g. for a service account without a home.
+func perLibraryDir(base string, err error, outDir string) string {
+	if err != nil || base == "" {
+		return stateDir(outDir)
+	}
+	return filepath.Join(base, "spotlightdl", libraryKey(outDir))
+}
+
+// libraryKey names a library by its directory and a hash of the full
+// path, so that two libraries called Spotlight do not share a directory.
+func libraryKey(outDir string) string {
+	abs, err := filepath.Abs(outDir)
+	if err != nil {
+		abs = outDir
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := filepath.Base(abs)
+	if name == string(filepath.Separator) || name == "." {
+		name = "root"
+	}
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// event is one line of the -events ndjson stream.
+type event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // fetch-start, image-found, download-progress, download-done, error, run-done
+	Source  string    `json:"source,omitempty"`
+	URL     string    `json:"url,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Total   int64     `json:"total,omitempty"`
+	New     *int      `json:"new,omitempty"`     // run-done
+	Stopped string    `json:"stopped,omitempty"` // run-done
+	Error   string    `json:"error,omitempty"`
+}
+
+// eventStream writes events as newline-delimited JSON. A nil stream
+// discards them, so callers need not check whether -events is on.
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w)}
+}
+
+func (s *eventStream) emit(ev event) {
+	if s == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(ev)
+}
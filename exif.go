@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"time"
+)
+
+// -exif-date writes the date a source published an image into the JPEG
+// as EXIF DateTimeOriginal, which photo managers sort by. It only adds an
+// Exif segment to a JPEG that has none, and leaves the image data as it
+// is. The file then no longer hashes to what was downloaded; the catalog
+// keeps both hashes, so an image from another market, or a blocked one,
+// is still recognized.
+
+// exifSegment is an APP1 Exif segment with DateTimeOriginal and
+// OffsetTimeOriginal, the one IFD0 entry pointing to the Exif IFD.
+func exifSegment(t time.Time) []byte {
+	date := t.UTC().Format("2006:01:02 15:04:05") + "\x00" // 20 bytes
+	offset := "+00:00\x00"                                 // 7 bytes
+
+	var tiff bytes.Buffer
+	be := binary.BigEndian
+	put16 := func(v uint16) { binary.Write(&tiff, be, v) }
+	put32 := func(v uint32) { binary.Write(&tiff, be, v) }
+	entry := func(tag, typ uint16, count, value uint32) {
+		put16(tag)
+		put16(typ)
+		put32(count)
+		put32(value)
+	}
+	const (
+		ifd0     = 8
+		exifIFD  = ifd0 + 2 + 12 + 4
+		dataAt   = exifIFD + 2 + 2*12 + 4
+		asciiTyp = 2
+		longTyp  = 4
+	)
+	tiff.WriteString("MM")
+	put16(42)
+	put32(ifd0)
+	put16(1)
+	entry(0x8769, longTyp, 1, exifIFD) // ExifIFDPointer
+	put32(0)
+	put16(2)
+	entry(0x9003, asciiTyp, uint32(len(date)), dataAt)                     // DateTimeOriginal
+	entry(0x9011, asciiTyp, uint32(len(offset)), dataAt+uint32(len(date))) // OffsetTimeOriginal
+	put32(0)
+	tiff.WriteString(date)
+	tiff.WriteString(offset)
+
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	seg = append(seg, "Exif\x00\x00"...)
+	seg = append(seg, tiff.Bytes()...)
+	be.PutUint16(seg[2:], uint16(len(seg)-2))
+	return seg
+}
+
+// setEXIFDate adds the Exif segment to the JPEG at path, after its JFIF
+// segment if it has one. It reports whether it did: not for other
+// formats, nor for a JPEG with Exif data of its own.
+func setEXIFDate(path string, t time.Time) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return false, nil
+	}
+	at := 2
+	// the APPn segments before the image data; Exif would be one of them
+	for i := 2; i+4 <= len(b) && b[i] == 0xFF && b[i+1] >= 0xE0 && b[i+1] <= 0xEF; {
+		n := int(binary.BigEndian.Uint16(b[i+2:]))
+		if b[i+1] == 0xE1 && bytes.HasPrefix(b[i+4:], []byte("Exif\x00")) {
+			return false, nil
+		}
+		if b[i+1] == 0xE0 && i == 2 {
+			at = i + 2 + n
+		}
+		i += 2 + n
+	}
+	if at > len(b) {
+		return false, nil
+	}
+	out := make([]byte, 0, len(b)+128)
+	out = append(out, b[:at]...)
+	out = append(out, exifSegment(t)...)
+	out = append(out, b[at:]...)
+	return true, writeFileAtomic(path, out)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// export writes the library, or a selection of it, in forms meant for
+// somewhere else: `export html` is a static gallery that needs no server
+// and no spotlightdl to look at, `export feed` an Atom feed (feed.go) and
+// `export manifest` a list of every image and its hash (manifest.go),
+// `export markdown` an index for a Git forge (markdown.go) and `export
+// photoprism` an originals folder for PhotoPrism (photoprism.go).
+
+func init() {
+	registerCommand("export", cmdExport)
+}
+
+func cmdExport(args []string) error {
+	usage := errors.New("usage: spotlightdl export html|feed|manifest|markdown|photoprism [flags]")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "html":
+		return exportHTML(args[1:])
+	case "feed":
+		return exportFeed(args[1:])
+	case "manifest":
+		return exportManifest(args[1:])
+	case "markdown":
+		return exportMarkdown(args[1:])
+	case "photoprism":
+		return exportPhotoPrism(args[1:])
+	}
+	return usage
+}
+
+// exportSelection is the flags the exports share for choosing images.
+type exportSelection struct {
+	favoritesOnly *bool
+	minRating     *int
+	tags          *string
+}
+
+func addSelectionFlags(flags *flag.FlagSet) *exportSelection {
+	return &exportSelection{
+		favoritesOnly: flags.Bool("favorites-only", false, "only export favorites"),
+		minRating:     flags.Int("min-rating", 0, "only export images rated at least this, 1-5"),
+		tags:          flags.String("tag", "", "only export images with one of these tags, and none of those prefixed with -"),
+	}
+}
+
+func (s *exportSelection) admits(e *catalogEntry) bool {
+	return (!*s.favoritesOnly || e.Favorite) && e.Rating >= *s.minRating && parseTagFilter(*s.tags).admits(e.Tags)
+}
+
+// entries returns the selected images, newest first.
+func (s *exportSelection) entries(cat *catalog) []*catalogEntry {
+	var sel []*catalogEntry
+	for _, e := range cat.Images {
+		if s.admits(e) {
+			sel = append(sel, e)
+		}
+	}
+	slices.SortStableFunc(sel, func(a, b *catalogEntry) int { return imageDate(b).Compare(imageDate(a)) })
+	return sel
+}
+
+// htmlImage is an image as the static gallery shows it.
+type htmlImage struct {
+	*catalogEntry
+	ID, Prev, Next string
+	Date           time.Time
+	Src, Thumb     template.URL
+}
+
+func exportHTML(args []string) error {
+	flags := flag.NewFlagSet("export html", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	out := flags.String("o", "", "directory to write the gallery to (required)")
+	title := flags.String("title", "spotlightdl gallery", "the gallery's title")
+	link := flags.Bool("link", false, "hard-link the images instead of copying them, where the file system allows")
+	sel := addSelectionFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl export html [flags] -o <dir>")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *out == "" {
+		flags.Usage()
+		return errors.New("export html: need -o")
+	}
+	// an export inside the library would be taken for images by reindex
+	if lib, err := filepath.Abs(*outDir); err == nil {
+		if dst, err := filepath.Abs(*out); err == nil {
+			if rel, err := filepath.Rel(lib, dst); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("export html: %s is inside the library; write the gallery somewhere else", *out)
+			}
+		}
+	}
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	entries := sel.entries(cat)
+
+	keep := make(map[string]bool)
+	var images []*htmlImage
+	var copied int
+	for _, e := range entries {
+		src := filepath.Join(*outDir, filepath.FromSlash(e.Path))
+		if !exists(src) {
+			fmt.Printf("%s: missing, left out\n", e.Path)
+			continue
+		}
+		img := &htmlImage{catalogEntry: e, ID: "i" + e.SHA256[:12], Date: imageDate(e)}
+		dst := filepath.Join(*out, "images", filepath.FromSlash(e.Path))
+		keep[dst] = true
+		if fresh, err := exportFile(src, dst, *link); err != nil {
+			return fmt.Errorf("export html: %w", err)
+		} else if fresh {
+			copied++
+		}
+		img.Src = relURL("images/" + e.Path)
+		img.Thumb = img.Src
+		// without a thumbnail (a format this build cannot decode) the
+		// browser scales the image itself
+		if th, err := ensureThumb(*outDir, e); err == nil {
+			dst := filepath.Join(*out, "thumbs", e.SHA256+".jpg")
+			keep[dst] = true
+			if _, err := exportFile(th, dst, false); err != nil {
+				return fmt.Errorf("export html: %w", err)
+			}
+			img.Thumb = relURL("thumbs/" + e.SHA256 + ".jpg")
+		}
+		images = append(images, img)
+	}
+	for i, img := range images {
+		if i > 0 {
+			img.Prev = images[i-1].ID
+		}
+		if i < len(images)-1 {
+			img.Next = images[i+1].ID
+		}
+	}
+
+	var b strings.Builder
+	err = staticGalleryTmpl.Execute(&b, struct {
+		Title     string
+		Generated time.Time
+		Images    []*htmlImage
+	}{*title, time.Now(), images})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(*out, "index.html"), []byte(b.String())); err != nil {
+		return err
+	}
+	// images dropped from the selection since the last export go too
+	var removed int
+	for _, dir := range []string{"images", "thumbs"} {
+		root := filepath.Join(*out, dir)
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && !keep[p] && os.Remove(p) == nil {
+				removeEmptyDirs(root, filepath.Dir(p))
+				removed++
+			}
+			return nil
+		})
+	}
+	fmt.Printf("exported %d images to %s (%d new, %d removed)\n", len(images), filepath.Join(*out, "index.html"), copied, removed)
+	return nil
+}
+
+// exportFile puts a copy of src at dst unless one of the same size is
+// already there, and reports whether it had to.
+func exportFile(src, dst string, link bool) (bool, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if di, err := os.Stat(dst); err == nil && di.Size() == fi.Size() {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return false, err
+	}
+	os.Remove(dst)
+	if link && os.Link(src, dst) == nil {
+		return true, nil
+	}
+	return true, copyFile(src, dst)
+}
+
+// relURL escapes a slash-separated relative path for use in a link.
+func relURL(p string) template.URL {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		parts[i] = url.PathEscape(s)
+	}
+	return template.URL(strings.Join(parts, "/"))
+}
+
+// The lightbox is CSS :target, so the gallery works with scripts off; the
+// script only adds the arrow keys and Escape.
+var staticGalleryTmpl = template.Must(template.New("static").Funcs(tmplFuncs).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width">
+<title>{{.Title}}</title>` + galleryStyle + `<style>
+.box{display:none;position:fixed;inset:0;background:rgba(0,0,0,.92);z-index:1;flex-direction:column;align-items:center;justify-content:center}
+.box:target{display:flex}
+.box img{max-width:96vw;max-height:84vh;object-fit:contain}
+.box p{margin:10px 20px 0;text-align:center;color:#bbb;font-size:14px}.box p b{color:#eee}
+.box .close{position:absolute;top:10px;right:20px;font-size:28px}
+.box .prev,.box .next{position:absolute;top:50%;font-size:40px;padding:0 16px}
+.box .prev{left:0}.box .next{right:0}
+</style></head><body>
+<header><b>{{.Title}}</b><span>{{len .Images}} images</span><span>{{date .Generated}}</span></header>
+<div class="grid">{{range .Images}}
+<a href="#{{.ID}}"><img loading="lazy" src="{{.Thumb}}" alt="{{.Title}}"><span>{{or .Title .Path}}</span></a>
+{{end}}</div>
+{{range .Images}}<div class="box" id="{{.ID}}">
+<a class="close" href="#" title="close">×</a>
+{{with .Prev}}<a class="prev" href="#{{.}}" title="previous">‹</a>{{end}}
+{{with .Next}}<a class="next" href="#{{.}}" title="next">›</a>{{end}}
+<a href="{{.Src}}"><img loading="lazy" src="{{.Src}}" alt="{{.Title}}"></a>
+<p>{{with .Title}}<b>{{.}}</b><br>{{end}}{{with .Location}}{{.}} · {{end}}{{if .Width}}{{.Width}}×{{.Height}} · {{end}}{{date .Date}}{{with .Description}}<br>{{.}}{{end}}{{with .Copyright}}<br>{{.}}{{end}}</p>
+</div>
+{{end}}<script>
+document.addEventListener("keydown", function (ev) {
+	var box = location.hash.length > 1 && document.getElementById(location.hash.slice(1));
+	if (!box) return;
+	var a = {ArrowLeft: ".prev", ArrowRight: ".next", Escape: ".close"}[ev.key];
+	var link = a && box.querySelector(a);
+	if (link) { location.hash = link.getAttribute("href"); ev.preventDefault(); }
+});
+</script>
+</body></html>`))
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault injection exercises the error paths on purpose: -fault-inject
+// dns:0.1,http500:0.05,slow:0.2 makes every request through newHTTPClient
+// fail (or crawl) with those probabilities. It is a development and
+// staging aid, so the flag stays out of -help.
+
+// faultKinds in the order they are rolled for each request.
+var faultKinds = []string{"dns", "reset", "http500", "http429", "slow", "truncate"}
+
+type faultPlan struct {
+	prob map[string]float64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// parseFaults reads kind:probability pairs; seed:N makes the sequence of
+// faults repeatable.
+func parseFaults(spec string) (*faultPlan, error) {
+	p := &faultPlan{prob: make(map[string]float64)}
+	seed := uint64(time.Now().UnixNano())
+	for _, part := range splitList(spec) {
+		kind, val, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("-fault-inject: %q is not kind:probability", part)
+		}
+		if kind == "seed" {
+			n, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("-fault-inject: invalid seed %q", val)
+			}
+			seed = n
+			continue
+		}
+		if !slices.Contains(faultKinds, kind) {
+			return nil, fmt.Errorf("-fault-inject: unknown fault %q (want %s)", kind, strings.Join(faultKinds, ", "))
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("-fault-inject: %s: probability must be between 0 and 1", kind)
+		}
+		p.prob[kind] = f
+	}
+	p.rnd = rand.New(rand.NewPCG(seed, seed>>1|1))
+	return p, nil
+}
+
+func (p *faultPlan) roll(kind string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rnd.Float64() < p.prob[kind]
+}
+
+type faultTransport struct {
+	base http.RoundTripper
+	plan *faultPlan
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	injected := func(kind string) {
+		slog.Debug("fault injected", "fault", kind, "url", req.URL.String())
+	}
+	if t.plan.roll("dns") {
+		injected("dns")
+		return nil, &net.DNSError{Err: "no such host (injected)", Name: host, IsNotFound: true}
+	}
+	if t.plan.roll("reset") {
+		injected("reset")
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	for _, kind := range []string{"http500", "http429"} {
+		if t.plan.roll(kind) {
+			injected(kind)
+			return faultResponse(req, kind), nil
+		}
+	}
+	if t.plan.roll("slow") {
+		injected("slow")
+		t.plan.mu.Lock()
+		d := time.Second + time.Duration(t.plan.rnd.Int64N(int64(4*time.Second)))
+		t.plan.mu.Unlock()
+		if err := sleepCtx(req.Context(), d); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && t.plan.roll("truncate") {
+		injected("truncate")
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, left: max(resp.ContentLength/2, 1)}
+	}
+	return resp, err
+}
+
+func faultResponse(req *http.Request, kind string) *http.Response {
+	status := http.StatusInternalServerError
+	h := http.Header{"Content-Type": {"text/plain"}}
+	if kind == "http429" {
+		status = http.StatusTooManyRequests
+		h.Set("Retry-After", "1")
+	}
+	body := "injected fault: " + kind
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// truncatedBody ends the transfer early, like a dropped connection.
+type truncatedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hideFlags leaves the named flags out of the usage message.
+func hideFlags(flags *flag.FlagSet, names ...string) {
+	flags.Usage = func() {
+		visible := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+		visible.SetOutput(flags.Output())
+		flags.VisitAll(func(f *flag.Flag) {
+			if !slices.Contains(names, f.Name) {
+				visible.Var(f.Value, f.Name, f.Usage)
+				visible.Lookup(f.Name).DefValue = f.DefValue
+			}
+		})
+		fmt.Fprintf(flags.Output(), "Usage of %s:\n", flags.Name())
+		visible.PrintDefaults()
+	}
+}
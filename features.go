@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"slices"
+)
+
+// feature is an optional capability. Heavy ones are compiled in only with
+// their build tag (go build -tags avif,video,saliency) so the default
+// binary stays small; any of them can still be unusable at runtime, e.g.
+// when an external encoder is not installed.
+type feature struct {
+	name  string
+	desc  string
+	tag   string       // build tag that compiles it in; empty if always built
+	built bool         // compiled into this binary
+	check func() error // runtime capability detection; nil means usable
+}
+
+var featureRegistry = map[string]*feature{}
+
+func registerFeature(f *feature) {
+	featureRegistry[f.name] = f
+}
+
+func init() {
+	registerFeature(&feature{
+		name:  "sandbox",
+		desc:  "-sandbox (Linux Landlock)",
+		built: true,
+		check: sandboxSupported,
+	})
+	registerCommand("features", cmdFeatures)
+}
+
+// requireFeature explains why a feature cannot be used, or returns nil.
+func requireFeature(name string) error {
+	f, ok := featureRegistry[name]
+	if !ok {
+		return fmt.Errorf("%s: unknown feature", name)
+	}
+	if !f.built {
+		return fmt.Errorf("%s: not included in this build (rebuild with -tags %s)", name, f.tag)
+	}
+	if f.check != nil {
+		if err := f.check(); err != nil {
+			return fmt.Errorf("%s: unavailable: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lookTool is a check for features that drive an external program.
+func lookTool(name string) func() error {
+	return func() error {
+		if _, err := exec.LookPath(name); err != nil {
+			return errors.New(name + " not found in PATH")
+		}
+		return nil
+	}
+}
+
+func cmdFeatures(args []string) error {
+	flags := flag.NewFlagSet("features", flag.ExitOnError)
+	parseFlags(flags, args)
+
+	var names []string
+	for n := range featureRegistry {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	for _, n := range names {
+		f := featureRegistry[n]
+		status := "yes"
+		if err := requireFeature(n); err != nil {
+			status = "no"
+			if !f.built {
+				status = "no (build tag " + f.tag + ")"
+			} else if f.check != nil {
+				status = "no (" + f.check().Error() + ")"
+			}
+		}
+		fmt.Printf("%-10s %-32s %s\n", n, f.desc, status)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Atom feed of the newest downloads lets people follow their own
+// archive in a feed reader. serve has it at /feed.xml; `export feed`
+// writes it to a file for a library published on a plain web server,
+// to be written again after each run.
+
+const feedSize = 50
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    atomText       `xml:"content"`
+}
+
+// feedLinks says where a feed entry's page and image are.
+type feedLinks func(e *catalogEntry) (page, img string)
+
+// newFeed makes a feed of the images that arrived last. self is the
+// feed's own URL and serves as its id.
+func newFeed(cat *catalog, sel func(*catalogEntry) bool, title, self string, limit int, links feedLinks) (*atomFeed, error) {
+	var recent []*catalogEntry
+	for _, e := range cat.Images {
+		if sel(e) {
+			recent = append(recent, e)
+		}
+	}
+	slices.SortStableFunc(recent, func(a, b *catalogEntry) int { return b.Added.Compare(a.Added) })
+	if limit > 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+
+	f := &atomFeed{
+		Title:     title,
+		ID:        self,
+		Updated:   time.Now().UTC().Format(time.RFC3339),
+		Author:    atomPerson{Name: "spotlightdl"},
+		Generator: userAgent,
+		Links:     []atomLink{{Rel: "self", Type: "application/atom+xml", Href: self}},
+	}
+	if len(recent) > 0 {
+		f.Updated = recent[0].Added.UTC().Format(time.RFC3339)
+	}
+	for _, e := range recent {
+		page, img := links(e)
+		var content strings.Builder
+		if err := feedContentTmpl.Execute(&content, struct {
+			*catalogEntry
+			Img string
+		}{e, img}); err != nil {
+			return nil, err
+		}
+		entry := atomEntry{
+			Title:   firstNonEmpty(e.Title, filepath.Base(e.Path)),
+			ID:      "urn:sha256:" + e.SHA256,
+			Updated: e.Added.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Type: "text/html", Href: page},
+				{Rel: "enclosure", Type: imageMIME(e.Path), Href: img},
+			},
+			Summary: strings.Join(nonEmpty(e.Location, e.Copyright), " · "),
+			Content: atomText{Type: "html", Body: content.String()},
+		}
+		if page == img {
+			entry.Links = []atomLink{{Rel: "alternate", Type: imageMIME(e.Path), Href: img}}
+		}
+		if !e.Published.IsZero() {
+			entry.Published = e.Published.UTC().Format(time.RFC3339)
+		}
+		for _, t := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: t})
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	return f, nil
+}
+
+func (f *atomFeed) encode() ([]byte, error) {
+	b, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+var feedContentTmpl = template.Must(template.New("feed").Parse(`<p><img src="{{.Img}}" alt="{{.Title}}"></p>
+{{with .Location}}<p>{{.}}</p>{{end}}{{with .Description}}<p>{{.}}</p>{{end}}{{with .Copyright}}<p>{{.}}</p>{{end}}`))
+
+func nonEmpty(s ...string) []string {
+	return slices.DeleteFunc(s, func(s string) bool { return s == "" })
+}
+
+// feedHandler serves the feed for serve's gallery, with links back to it.
+func feedHandler(lib *library, favoritesOnly bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cat, err := lib.current()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		if p := r.Header.Get("X-Forwarded-Proto"); p == "http" || p == "https" {
+			scheme = p
+		}
+		base := scheme + "://" + r.Host
+		limit := feedSize
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+			limit = n
+		}
+		f, err := newFeed(cat, func(e *catalogEntry) bool { return !favoritesOnly || e.Favorite },
+			"spotlightdl", base+"/feed.xml", limit, func(e *catalogEntry) (string, string) {
+				return base + "/image/" + e.SHA256, base + "/raw/" + e.SHA256
+			})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b, err := f.encode()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Write(b)
+	}
+}
+
+func exportFeed(args []string) error {
+	flags := flag.NewFlagSet("export feed", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	out := flags.String("o", "", "file to write the feed to (default stdout)")
+	baseURL := flags.String("base-url", "", "URL the library's images are published under (required)")
+	title := flags.String("title", "spotlightdl", "the feed's title")
+	limit := flags.Int("limit", feedSize, "number of images in the feed, newest first")
+	sel := addSelectionFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl export feed [flags] -base-url <url> [-o feed.xml]")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *baseURL == "" {
+		flags.Usage()
+		return errors.New("export feed: need -base-url, as feed readers want absolute links")
+	}
+	base := strings.TrimSuffix(*baseURL, "/") + "/"
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	self := base + "feed.xml"
+	if *out != "" {
+		self = base + filepath.Base(*out)
+	}
+	f, err := newFeed(cat, sel.admits, *title, self, *limit, func(e *catalogEntry) (string, string) {
+		u := base + string(relURL(e.Path))
+		return u, u
+	})
+	if err != nil {
+		return err
+	}
+	b, err := f.encode()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return writeFileAtomic(*out, b)
+}
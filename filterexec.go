@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// -filter-exec and filter plugins decide which images to download. A
+// filter gets each candidate's metadata as a JSON object on stdin, before
+// the download, and answers on stdout with {"accept": false, "reason":
+// "..."} or, more simply, a line
+//
+//	accept
+//	reject [reason]
+//
+// An exit status of 1 also rejects, and 0 with nothing printed accepts.
+// Anything else is an error: the image is left for the next run rather
+// than taken or dropped on a whim of a broken filter.
+
+const filterTimeout = 30 * time.Second
+
+// pluginImage is an image as filters see it and source plugins describe
+// it.
+type pluginImage struct {
+	Protocol    int       `json:"protocol,omitempty"` // set for filters
+	URL         string    `json:"url"`
+	FileName    string    `json:"fileName"`
+	Path        string    `json:"path"` // where it would be saved
+	Title       string    `json:"title,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Copyright   string    `json:"copyright,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	License     string    `json:"license,omitempty"`
+	LicenseURL  string    `json:"licenseUrl,omitempty"`
+	PageURL     string    `json:"pageUrl,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Locale      string    `json:"locale,omitempty"`
+	Published   time.Time `json:"published,omitzero"`
+}
+
+func newFilterCandidate(path, name string, im spotImage) pluginImage {
+	return pluginImage{
+		Protocol:    pluginProtocol,
+		URL:         im.URL,
+		FileName:    name,
+		Path:        path,
+		Title:       im.Title,
+		Location:    im.Location,
+		Description: im.Description,
+		Copyright:   im.Copyright,
+		Author:      im.Author,
+		License:     im.License,
+		LicenseURL:  im.LicenseURL,
+		PageURL:     im.PageURL,
+		Source:      im.Source,
+		Locale:      im.Locale,
+		Published:   im.Published,
+	}
+}
+
+// imageFilter runs the -filter-exec command or a filter plugin.
+type imageFilter struct {
+	name string // for messages
+	argv []string
+}
+
+func newImageFilter(line string) (*imageFilter, error) {
+	argv, err := splitCommand(line)
+	if err != nil {
+		return nil, fmt.Errorf("-filter-exec: %w", err)
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("-filter-exec: empty command")
+	}
+	return &imageFilter{name: "-filter-exec", argv: argv}, nil
+}
+
+// admit asks the filter about an image and returns whether to download
+// it, and the filter's reason if it said no.
+func (f *imageFilter) admit(ctx context.Context, c pluginImage) (bool, string, error) {
+	if f == nil {
+		return true, "", nil
+	}
+	in, err := json.Marshal(c)
+	if err != nil {
+		return false, "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, filterTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, f.argv[0], f.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(append(in, '\n'))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return false, strings.TrimSpace(strings.TrimPrefix(firstLine(out), "reject")), nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("%s: %w", f.name, err)
+	}
+	if out = bytes.TrimSpace(out); len(out) > 0 && out[0] == '{' {
+		var answer struct {
+			Accept *bool  `json:"accept"`
+			Reason string `json:"reason"`
+		}
+		if err := json.Unmarshal(out, &answer); err != nil || answer.Accept == nil {
+			return false, "", fmt.Errorf("%s: bad answer %.100q", f.name, out)
+		}
+		return *answer.Accept, answer.Reason, nil
+	}
+	answer := firstLine(out)
+	verdict, reason, _ := strings.Cut(answer, " ")
+	switch verdict {
+	case "", "accept":
+		return true, "", nil
+	case "reject":
+		return false, strings.TrimSpace(reason), nil
+	}
+	return false, "", fmt.Errorf("%s: answered %q, want accept or reject", f.name, answer)
+}
+
+func firstLine(b []byte) string {
+	line, _, _ := strings.Cut(string(b), "\n")
+	return strings.TrimSpace(line)
+}
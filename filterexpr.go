@@ -0,0 +1,562 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// -filter takes an expression over an image's metadata, such as
+//
+//	width >= 3840 && !contains(title, "city")
+//
+// with the usual operators (|| && ! == != < <= > >= + - * / %),
+// parentheses, numbers, "strings" and true/false. The expression is
+// parsed and type-checked once, up front, into a tree of closures, so a
+// typo is an error at startup rather than a silent miss on every image.
+// Most variables are known before the download; width, height, aspect
+// and size only after it, so an expression using them is evaluated then.
+
+type exprType int
+
+const (
+	exprBool exprType = iota
+	exprNum
+	exprStr
+)
+
+func (t exprType) String() string {
+	return [...]string{"bool", "number", "string"}[t]
+}
+
+// exprVars are the variables an expression can use, with their types and
+// whether they are only known once the image is downloaded.
+var exprVars = map[string]struct {
+	typ  exprType
+	post bool
+}{
+	"title":       {exprStr, false},
+	"location":    {exprStr, false},
+	"description": {exprStr, false},
+	"copyright":   {exprStr, false},
+	"author":      {exprStr, false},
+	"license":     {exprStr, false},
+	"source":      {exprStr, false},
+	"locale":      {exprStr, false},
+	"url":         {exprStr, false},
+	"name":        {exprStr, false},
+	"published":   {exprStr, false}, // 2006-01-02, "" if unknown
+	"year":        {exprNum, false}, // 0 if unknown
+	"width":       {exprNum, true},
+	"height":      {exprNum, true},
+	"aspect":      {exprNum, true}, // width / height
+	"size":        {exprNum, true}, // bytes
+}
+
+// exprEnv holds the variables' values: strings and float64s.
+type exprEnv map[string]any
+
+type exprNode struct {
+	typ  exprType
+	eval func(exprEnv) any
+}
+
+// filterExpr is a parsed -filter.
+type filterExpr struct {
+	root exprNode
+	post bool // uses variables known only after the download
+}
+
+func (f *filterExpr) admit(env exprEnv) bool {
+	return f == nil || f.root.eval(env).(bool)
+}
+
+func parseFilterExpr(src string) (*filterExpr, error) {
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("-filter: %w", err)
+	}
+	p := &exprParser{toks: toks}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected %s", p.peek())
+	}
+	if err == nil && root.typ != exprBool {
+		err = fmt.Errorf("the expression is a %s, not true or false", root.typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("-filter: %w", err)
+	}
+	return &filterExpr{root: root, post: p.post}, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind tokKind
+	text string // the operator, identifier or string's value
+	num  float64
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokStr:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+func lexExpr(s string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9' || r == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == '_') {
+				j++
+			}
+			n, err := strconv.ParseFloat(strings.ReplaceAll(s[i:j], "_", ""), 64)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: bad number %s", i+1, s[i:j])
+			}
+			toks = append(toks, exprToken{kind: tokNum, text: s[i:j], num: n, pos: i})
+			i = j
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && rune(s[j]) != r; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return nil, fmt.Errorf("at %d: unterminated string", i+1)
+			}
+			toks = append(toks, exprToken{kind: tokStr, text: b.String(), pos: i})
+			i = j + 1
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				j += size
+			}
+			toks = append(toks, exprToken{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			i0 := i
+			for _, op := range exprOps {
+				if strings.HasPrefix(s[i:], op) {
+					toks = append(toks, exprToken{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					break
+				}
+			}
+			if i == i0 {
+				return nil, fmt.Errorf("at %d: unexpected %q", i+1, r)
+			}
+		}
+	}
+	return append(toks, exprToken{kind: tokEOF, pos: len(s)}), nil
+}
+
+type exprParser struct {
+	toks []exprToken
+	i    int
+	post bool
+}
+
+func (p *exprParser) peek() exprToken { return p.toks[p.i] }
+
+func (p *exprParser) next() exprToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the operator if it comes next.
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) or() (exprNode, error) {
+	return p.logical("||", p.and, func(a, b func(exprEnv) any) func(exprEnv) any {
+		return func(env exprEnv) any { return a(env).(bool) || b(env).(bool) }
+	})
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	return p.logical("&&", p.cmp, func(a, b func(exprEnv) any) func(exprEnv) any {
+		return func(env exprEnv) any { return a(env).(bool) && b(env).(bool) }
+	})
+}
+
+func (p *exprParser) logical(op string, operand func() (exprNode, error), join func(a, b func(exprEnv) any) func(exprEnv) any) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return left, err
+	}
+	for p.accept(op) {
+		right, err := operand()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, p.errorf("%s needs true or false on both sides", op)
+		}
+		left = exprNode{exprBool, join(left.eval, right.eval)}
+	}
+	return left, nil
+}
+
+func (p *exprParser) cmp() (exprNode, error) {
+	left, err := p.add()
+	if err != nil {
+		return left, err
+	}
+	t := p.peek()
+	if t.kind != tokOp || !slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, t.text) {
+		return left, nil
+	}
+	p.next()
+	right, err := p.add()
+	if err != nil {
+		return right, err
+	}
+	if left.typ != right.typ {
+		return left, fmt.Errorf("at %d: cannot compare a %s with a %s", t.pos+1, left.typ, right.typ)
+	}
+	if left.typ == exprBool && t.text != "==" && t.text != "!=" {
+		return left, fmt.Errorf("at %d: %s does not apply to true and false", t.pos+1, t.text)
+	}
+	a, b := left.eval, right.eval
+	compare := func(env exprEnv) int {
+		switch x := a(env).(type) {
+		case float64:
+			return cmp.Compare(x, b(env).(float64))
+		case string:
+			return strings.Compare(x, b(env).(string))
+		case bool:
+			if x == b(env).(bool) {
+				return 0
+			}
+		}
+		return 1
+	}
+	test := map[string]func(int) bool{
+		"==": func(c int) bool { return c == 0 },
+		"!=": func(c int) bool { return c != 0 },
+		"<":  func(c int) bool { return c < 0 },
+		"<=": func(c int) bool { return c <= 0 },
+		">":  func(c int) bool { return c > 0 },
+		">=": func(c int) bool { return c >= 0 },
+	}[t.text]
+	return exprNode{exprBool, func(env exprEnv) any { return test(compare(env)) }}, nil
+}
+
+func (p *exprParser) add() (exprNode, error) {
+	left, err := p.mul()
+	if err != nil {
+		return left, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("+") && !p.accept("-") {
+			return left, nil
+		}
+		right, err := p.mul()
+		if err != nil {
+			return right, err
+		}
+		a, b := left.eval, right.eval
+		switch {
+		case t.text == "+" && left.typ == exprStr && right.typ == exprStr:
+			left = exprNode{exprStr, func(env exprEnv) any { return a(env).(string) + b(env).(string) }}
+		case left.typ == exprNum && right.typ == exprNum:
+			if t.text == "+" {
+				left = exprNode{exprNum, func(env exprEnv) any { return a(env).(float64) + b(env).(float64) }}
+			} else {
+				left = exprNode{exprNum, func(env exprEnv) any { return a(env).(float64) - b(env).(float64) }}
+			}
+		default:
+			return left, fmt.Errorf("at %d: %s does not apply to a %s and a %s", t.pos+1, t.text, left.typ, right.typ)
+		}
+	}
+}
+
+func (p *exprParser) mul() (exprNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return left, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("*") && !p.accept("/") && !p.accept("%") {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprNum || right.typ != exprNum {
+			return left, fmt.Errorf("at %d: %s needs numbers", t.pos+1, t.text)
+		}
+		a, b := left.eval, right.eval
+		op := map[string]func(x, y float64) float64{
+			"*": func(x, y float64) float64 { return x * y },
+			"/": func(x, y float64) float64 { return x / y },
+			"%": math.Mod,
+		}[t.text]
+		left = exprNode{exprNum, func(env exprEnv) any { return op(a(env).(float64), b(env).(float64)) }}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	t := p.peek()
+	switch {
+	case p.accept("!"):
+		x, err := p.unary()
+		if err != nil {
+			return x, err
+		}
+		if x.typ != exprBool {
+			return x, fmt.Errorf("at %d: ! needs true or false, not a %s", t.pos+1, x.typ)
+		}
+		return exprNode{exprBool, func(env exprEnv) any { return !x.eval(env).(bool) }}, nil
+	case p.accept("-"):
+		x, err := p.unary()
+		if err != nil {
+			return x, err
+		}
+		if x.typ != exprNum {
+			return x, fmt.Errorf("at %d: - needs a number, not a %s", t.pos+1, x.typ)
+		}
+		return exprNode{exprNum, func(env exprEnv) any { return -x.eval(env).(float64) }}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		return exprNode{exprNum, func(exprEnv) any { return t.num }}, nil
+	case tokStr:
+		return exprNode{exprStr, func(exprEnv) any { return t.text }}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return x, err
+			}
+			if !p.accept(")") {
+				return x, p.errorf("missing )")
+			}
+			return x, nil
+		}
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			v := t.text == "true"
+			return exprNode{exprBool, func(exprEnv) any { return v }}, nil
+		}
+		if p.accept("(") {
+			return p.call(t)
+		}
+		v, ok := exprVars[t.text]
+		if !ok {
+			names := make([]string, 0, len(exprVars))
+			for n := range exprVars {
+				names = append(names, n)
+			}
+			slices.Sort(names)
+			return exprNode{}, fmt.Errorf("at %d: unknown variable %s (want one of %s)", t.pos+1, t.text, strings.Join(names, ", "))
+		}
+		p.post = p.post || v.post
+		name := t.text
+		return exprNode{v.typ, func(env exprEnv) any { return env[name] }}, nil
+	}
+	if t.kind != tokEOF {
+		p.i-- // to report where the token is
+	}
+	return exprNode{}, p.errorf("unexpected %s", t)
+}
+
+// exprFuncs are the functions an expression can call. The string tests
+// ignore case; matches takes a regular expression, which has to be a
+// literal so that it is checked up front.
+var exprFuncs = map[string]struct {
+	args []exprType
+	ret  exprType
+	fn   func(args []any) any
+}{
+	"contains": {[]exprType{exprStr, exprStr}, exprBool, func(a []any) any {
+		return strings.Contains(strings.ToLower(a[0].(string)), strings.ToLower(a[1].(string)))
+	}},
+	"startsWith": {[]exprType{exprStr, exprStr}, exprBool, func(a []any) any {
+		return strings.HasPrefix(strings.ToLower(a[0].(string)), strings.ToLower(a[1].(string)))
+	}},
+	"endsWith": {[]exprType{exprStr, exprStr}, exprBool, func(a []any) any {
+		return strings.HasSuffix(strings.ToLower(a[0].(string)), strings.ToLower(a[1].(string)))
+	}},
+	"lower":   {[]exprType{exprStr}, exprStr, func(a []any) any { return strings.ToLower(a[0].(string)) }},
+	"len":     {[]exprType{exprStr}, exprNum, func(a []any) any { return float64(utf8.RuneCountInString(a[0].(string))) }},
+	"matches": {[]exprType{exprStr, exprStr}, exprBool, nil},
+}
+
+func (p *exprParser) call(name exprToken) (exprNode, error) {
+	f, ok := exprFuncs[name.text]
+	if !ok {
+		names := make([]string, 0, len(exprFuncs))
+		for n := range exprFuncs {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return exprNode{}, fmt.Errorf("at %d: unknown function %s (want one of %s)", name.pos+1, name.text, strings.Join(names, ", "))
+	}
+	var args []exprNode
+	var lit *exprToken // the last argument, if it is a lone string
+	for !p.accept(")") {
+		if len(args) > 0 && !p.accept(",") {
+			return exprNode{}, p.errorf("want , or ) in the call of %s", name.text)
+		}
+		start := p.i
+		x, err := p.or()
+		if err != nil {
+			return x, err
+		}
+		args = append(args, x)
+		lit = nil
+		if p.i == start+1 && p.toks[start].kind == tokStr {
+			lit = &p.toks[start]
+		}
+	}
+	if len(args) != len(f.args) {
+		return exprNode{}, fmt.Errorf("at %d: %s takes %d arguments, not %d", name.pos+1, name.text, len(f.args), len(args))
+	}
+	for i, a := range args {
+		if a.typ != f.args[i] {
+			return exprNode{}, fmt.Errorf("at %d: argument %d of %s is a %s, want a %s", name.pos+1, i+1, name.text, a.typ, f.args[i])
+		}
+	}
+	fn := f.fn
+	if name.text == "matches" {
+		if lit == nil {
+			return exprNode{}, fmt.Errorf("at %d: the pattern of matches has to be a quoted string", name.pos+1)
+		}
+		re, err := regexp.Compile(lit.text)
+		if err != nil {
+			return exprNode{}, fmt.Errorf("at %d: %w", lit.pos+1, err)
+		}
+		fn = func(a []any) any { return re.MatchString(a[0].(string)) }
+	}
+	return exprNode{f.ret, func(env exprEnv) any {
+		vals := make([]any, len(args))
+		for i, a := range args {
+			vals[i] = a.eval(env)
+		}
+		return fn(vals)
+	}}, nil
+}
+
+// exprEnvFor holds what is known about an image before the download.
+func exprEnvFor(name string, im spotImage) exprEnv {
+	env := exprEnv{
+		"title":       im.Title,
+		"location":    im.Location,
+		"description": im.Description,
+		"copyright":   im.Copyright,
+		"author":      im.Author,
+		"license":     im.License,
+		"source":      im.Source,
+		"locale":      im.Locale,
+		"url":         im.URL,
+		"name":        name,
+		"published":   "",
+		"year":        0.0,
+	}
+	if !im.Published.IsZero() {
+		env["published"] = im.Published.Format("2006-01-02")
+		env["year"] = float64(im.Published.Year())
+	}
+	return env
+}
+
+// addFileVars adds what the downloaded file tells. An image whose size
+// cannot be read counts as 0x0.
+func (env exprEnv) addFileVars(path string) {
+	w, h, _ := imageSize(path)
+	env["width"], env["height"], env["aspect"], env["size"] = float64(w), float64(h), 0.0, 0.0
+	if h > 0 {
+		env["aspect"] = float64(w) / float64(h)
+	}
+	if fi, err := os.Stat(path); err == nil {
+		env["size"] = float64(fi.Size())
+	}
+}
+
+// parseAspects reads -aspect: ratios like 16:9 or 1.78, comma-separated.
+func parseAspects(spec string) ([]float64, error) {
+	var ratios []float64
+	for _, s := range splitList(spec) {
+		w, h, ok := strings.Cut(s, ":")
+		if !ok {
+			h = "1"
+		}
+		x, err1 := strconv.ParseFloat(w, 64)
+		y, err2 := strconv.ParseFloat(h, 64)
+		if err1 != nil || err2 != nil || x <= 0 || y <= 0 {
+			return nil, fmt.Errorf("-aspect: bad ratio %q (want e.g. 16:9 or 1.78)", s)
+		}
+		ratios = append(ratios, x/y)
+	}
+	return ratios, nil
+}
+
+// fitsAspect reports whether a w by h image is within tolerance, relative,
+// of one of the ratios.
+func fitsAspect(w, h int, ratios []float64, tolerance float64) bool {
+	if h == 0 {
+		return false
+	}
+	r := float64(w) / float64(h)
+	return slices.ContainsFunc(ratios, func(want float64) bool {
+		return math.Abs(r/want-1) <= tolerance
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string // the tokens' String, without the end
+		err  string
+	}{
+		{src: "", want: nil},
+		{src: "  \t", want: nil},
+		{src: "width>=3_840", want: []string{"'width'", "'>='", "'3_840'"}},
+		{src: `title == "a \"b\""`, want: []string{"'title'", "'=='", `"a \"b\""`}},
+		{src: `'it''`, err: "at 5: unterminated string"},
+		{src: "!contains(x,'y')", want: []string{"'!'", "'contains'", "'('", "'x'", "','", `"y"`, "')'"}},
+		{src: "a&&b||c", want: []string{"'a'", "'&&'", "'b'", "'||'", "'c'"}},
+		{src: "größe", want: []string{"'größe'"}},
+		{src: "1.2.3", err: "at 1: bad number 1.2.3"},
+		{src: "a & b", err: `at 3: unexpected '&'`},
+		{src: `"open`, err: "at 1: unterminated string"},
+	}
+	for _, tt := range tests {
+		toks, err := lexExpr(tt.src)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("lexExpr(%q) error = %v, want %q", tt.src, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("lexExpr(%q): %v", tt.src, err)
+			continue
+		}
+		if last := toks[len(toks)-1]; last.kind != tokEOF || last.pos != len(tt.src) {
+			t.Errorf("lexExpr(%q) ends with %v at %d", tt.src, last, last.pos)
+		}
+		var got []string
+		for _, tok := range toks[:len(toks)-1] {
+			got = append(got, tok.String())
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("lexExpr(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterExpr(t *testing.T) {
+	env := exprEnv{
+		"title": "Lake Bled", "location": "Slovenia", "description": "", "copyright": "© Jane Doe",
+		"author": "", "license": "", "source": "spotlight", "locale": "en-US", "url": "https://example.com/a.jpg",
+		"name": "Lake Bled.jpg", "published": "2024-03-03", "year": 2024.0,
+		"width": 3840.0, "height": 2160.0, "aspect": 3840.0 / 2160, "size": 1e6,
+	}
+	tests := []struct {
+		src  string
+		want bool
+		post bool
+	}{
+		{src: "true", want: true},
+		{src: "!true || false", want: false},
+		{src: `contains(title, "bled")`, want: true},
+		{src: `startsWith(lower(title), "lake") && endsWith(name, ".JPG")`, want: true},
+		{src: `matches(title, "^L.*d$")`, want: true},
+		{src: `len(title) == 9`, want: true},
+		{src: "year >= 2024 && published != ''", want: true},
+		{src: "1 + 2 * 3 == 7 && (1 + 2) * 3 == 9", want: true},
+		{src: "7 % 4 == 3 && -2 < 0", want: true},
+		{src: "width >= 3840 && aspect > 1.7", want: true, post: true},
+		{src: "size < 1_000", want: false, post: true},
+		{src: `title < "M"`, want: true},
+	}
+	for _, tt := range tests {
+		f, err := parseFilterExpr(tt.src)
+		if err != nil {
+			t.Errorf("parseFilterExpr(%q): %v", tt.src, err)
+			continue
+		}
+		if got := f.admit(env); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.src, got, tt.want)
+		}
+		if f.post != tt.post {
+			t.Errorf("%q post = %v, want %v", tt.src, f.post, tt.post)
+		}
+	}
+}
+
+func TestParseFilterExprErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"", "-filter: at 1: unexpected end of expression"},
+		{" ", "-filter: at 2: unexpected end of expression"},
+		{"width >=", "-filter: at 9: unexpected end of expression"},
+		{"(true", "-filter: at 6: missing )"},
+		{"true)", "-filter: at 5: unexpected ')'"},
+		{"true true", "-filter: at 6: unexpected 'true'"},
+		{"widht > 1", "-filter: at 1: unknown variable widht"},
+		{"nope(title)", "-filter: at 1: unknown function nope"},
+		{"contains(title)", "-filter: at 1: contains takes 2 arguments, not 1"},
+		{"contains(title, 1)", "-filter: at 1: argument 2 of contains is a number, want a string"},
+		{"contains(title", "-filter: at 15: want , or ) in the call of contains"},
+		{"matches(title, lower('x'))", "-filter: at 1: the pattern of matches has to be a quoted string"},
+		{"matches(title, '(')", "-filter: at 16: error parsing regexp"},
+		{"width", "-filter: the expression is a number, not true or false"},
+		{`title == 1`, "-filter: at 7:"},
+		{"!width", "-filter: at 1:"},
+		{"'a' && true", "-filter: at 12: && needs true or false on both sides"},
+	}
+	for _, tt := range tests {
+		_, err := parseFilterExpr(tt.src)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("parseFilterExpr(%q) error = %v, want %q...", tt.src, err, tt.err)
+		}
+	}
+}
+
+func FuzzParseFilterExpr(f *testing.F) {
+	for _, s := range []string{" ", `width >= 3840 && !contains(title, "city")`, "matches(url, 'x+')", "(1+2)*-3 % 4 < 5 || false"} {
+		f.Add(s)
+	}
+	env := exprEnvFor("a.jpg", spotImage{Title: "t"})
+	env["width"], env["height"], env["aspect"], env["size"] = 1.0, 1.0, 1.0, 1.0
+	f.Fuzz(func(t *testing.T, src string) {
+		if fe, err := parseFilterExpr(src); err == nil {
+			fe.admit(env)
+		}
+	})
+}
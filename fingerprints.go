@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fingerprint export lets people study what Spotlight publishes without
+// redistributing the images. Columns are append-only: new fields go at the
+// end and fingerprintSchema is bumped, so old parsers keep working.
+const fingerprintSchema = 1
+
+var fingerprintColumns = []string{"schema", "sha256", "first_seen", "locales", "phash", "width", "height", "title", "copyright"}
+
+type fingerprint struct {
+	Schema    int      `json:"schema"`
+	SHA256    string   `json:"sha256"`
+	FirstSeen string   `json:"first_seen"`
+	Locales   []string `json:"locales"`
+	PHash     string   `json:"phash"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	Title     string   `json:"title"`
+	Copyright string   `json:"copyright"`
+}
+
+func init() {
+	registerCommand("export-fingerprints", cmdExportFingerprints)
+}
+
+func cmdExportFingerprints(args []string) error {
+	flags := flag.NewFlagSet("export-fingerprints", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	format := flags.String("format", "csv", "csv or jsonl (one JSON object per line)")
+	out := flags.String("o", "", "output file (default stdout)")
+	incremental := flags.Bool("incremental", false, "append only images not already in -o")
+	favoritesOnly := flags.Bool("favorites-only", false, "only export favorites")
+	tags := flags.String("tag", "", "only export images with one of these tags, and none of those prefixed with -")
+	parseFlags(flags, args)
+	if *format != "csv" && *format != "jsonl" {
+		return fmt.Errorf("export-fingerprints: unknown -format %q", *format)
+	}
+	if *incremental && *out == "" {
+		return errors.New("export-fingerprints: -incremental needs -o")
+	}
+
+	lock, err := lockLibrary(context.Background(), *outDir, "export-fingerprints", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+
+	done := make(map[string]bool)
+	if *incremental {
+		if done, err = exportedHashes(*out, *format); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	writeHeader := !*incremental || len(done) == 0
+	if *out != "" {
+		mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if *incremental {
+			mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(*out, mode, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	var cw *csv.Writer
+	if *format == "csv" {
+		cw = csv.NewWriter(bw)
+		defer cw.Flush()
+		if writeHeader {
+			cw.Write(fingerprintColumns)
+		}
+	}
+	enc := json.NewEncoder(bw)
+
+	entries := slices.Clone(cat.Images)
+	slices.SortStableFunc(entries, func(a, b *catalogEntry) int { return a.Added.Compare(b.Added) })
+
+	tf := parseTagFilter(*tags)
+	dirty := false
+	for _, e := range entries {
+		if done[e.SHA256] || (*favoritesOnly && !e.Favorite) || !tf.admits(e.Tags) {
+			continue
+		}
+		done[e.SHA256] = true
+		if e.PHash == "" || e.Width == 0 {
+			p := filepath.Join(*outDir, filepath.FromSlash(e.Path))
+			if h, err := pHash(p); err == nil {
+				e.PHash = formatPHash(h)
+				dirty = true
+			}
+			if e.Width == 0 {
+				e.Width, e.Height, _ = imageSize(p)
+			}
+		}
+		fp := fingerprint{
+			Schema:    fingerprintSchema,
+			SHA256:    e.SHA256,
+			FirstSeen: e.Added.UTC().Format(time.RFC3339),
+			Locales:   append([]string{}, e.Locales...),
+			PHash:     e.PHash,
+			Width:     e.Width,
+			Height:    e.Height,
+			Title:     e.Title,
+			Copyright: e.Copyright,
+		}
+		if cw != nil {
+			err = cw.Write([]string{strconv.Itoa(fp.Schema), fp.SHA256, fp.FirstSeen, strings.Join(fp.Locales, ";"),
+				fp.PHash, strconv.Itoa(fp.Width), strconv.Itoa(fp.Height), fp.Title, fp.Copyright})
+		} else {
+			err = enc.Encode(fp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// computed hashes are kept so the next export is cheap
+	if dirty {
+		return cat.save()
+	}
+	return nil
+}
+
+func exportedHashes(path, format string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "csv" {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(rec) > 1 && rec[0] != "schema" {
+				done[rec[1]] = true
+			}
+		}
+		return done, nil
+	}
+	dec := json.NewDecoder(f)
+	for {
+		var fp fingerprint
+		err := dec.Decode(&fp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		done[fp.SHA256] = true
+	}
+	return done, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A freeze keeps the library exactly as it is until a date, e.g. while a
+// kiosk shows it at an exhibition: nothing is pruned or deleted and the
+// wallpaper stays put. New downloads still land. The state lives in
+// .spotlightdl/freeze.json, so it holds for every command and for the
+// daemon alike.
+
+type freezeState struct {
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// frozenError is returned by anything a freeze suspends.
+type frozenError struct {
+	what  string
+	state *freezeState
+}
+
+func (e *frozenError) Error() string {
+	msg := fmt.Sprintf("%s: library is frozen until %s", e.what, e.state.Until.Local().Format("2006-01-02 15:04"))
+	if e.state.Reason != "" {
+		msg += " (" + e.state.Reason + ")"
+	}
+	return msg + "; `freeze -lift` ends it early"
+}
+
+func freezePath(outDir string) string {
+	return filepath.Join(stateDir(outDir), "freeze.json")
+}
+
+// activeFreeze returns the freeze in force, or nil. An expired freeze is
+// simply ignored.
+func activeFreeze(outDir string) (*freezeState, error) {
+	b, err := os.ReadFile(freezePath(outDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st freezeState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("%s: %w", freezePath(outDir), err)
+	}
+	if !time.Now().Before(st.Until) {
+		return nil, nil
+	}
+	return &st, nil
+}
+
+// checkFrozen fails with a *frozenError while a freeze is in force. what
+// names the suspended action for the message.
+func checkFrozen(outDir, what string) error {
+	st, err := activeFreeze(outDir)
+	if err != nil {
+		return err
+	}
+	if st != nil {
+		return &frozenError{what: what, state: st}
+	}
+	return nil
+}
+
+func init() {
+	registerCommand("freeze", cmdFreeze)
+}
+
+func cmdFreeze(args []string) error {
+	flags := flag.NewFlagSet("freeze", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	until := flags.String("until", "", "freeze until this date or RFC 3339 time")
+	period := flags.String("for", "", "freeze for this long, e.g. 14d")
+	reason := flags.String("reason", "", "note shown whenever the freeze refuses something")
+	lift := flags.Bool("lift", false, "end the freeze now")
+	parseFlags(flags, args)
+
+	if *lift {
+		if err := os.Remove(freezePath(*outDir)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Println("library is not frozen")
+		return nil
+	}
+	if *until == "" && *period == "" {
+		st, err := activeFreeze(*outDir)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			fmt.Println("library is not frozen")
+			return nil
+		}
+		fmt.Printf("library frozen since %s until %s", st.Since.Local().Format("2006-01-02 15:04"), st.Until.Local().Format("2006-01-02 15:04"))
+		if st.Reason != "" {
+			fmt.Printf(" (%s)", st.Reason)
+		}
+		fmt.Println()
+		return nil
+	}
+	if *until != "" && *period != "" {
+		return errors.New("freeze: -until and -for are mutually exclusive")
+	}
+
+	now := time.Now()
+	st := freezeState{Reason: *reason, Since: now}
+	if *until != "" {
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			// a bare date ends the freeze as that day begins
+			if t, err = time.ParseInLocation("2006-01-02", *until, time.Local); err != nil {
+				return fmt.Errorf("freeze: invalid -until %q (want 2006-01-02 or RFC 3339)", *until)
+			}
+		}
+		st.Until = t
+	} else {
+		d, err := parseAge(*period)
+		if err != nil {
+			return fmt.Errorf("freeze: -for: %w", err)
+		}
+		st.Until = now.Add(d)
+	}
+	if !st.Until.After(now) {
+		return fmt.Errorf("freeze: %s is in the past", st.Until.Local().Format("2006-01-02 15:04"))
+	}
+	if prev, err := activeFreeze(*outDir); err == nil && prev != nil {
+		st.Since = prev.Since
+	}
+	if err := os.MkdirAll(stateDir(*outDir), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(freezePath(*outDir), append(b, '\n')); err != nil {
+		return err
+	}
+	fmt.Printf("library frozen until %s\n", st.Until.Local().Format("2006-01-02 15:04"))
+	return nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Full-text search over the catalog, with the query syntax of SQLite's
+// FTS5 so that it is familiar: words must all match (AND is implied), OR
+// and NOT combine them, parentheses group, "a phrase" matches words in a
+// row, word* matches a prefix and title:word looks in one field only.
+// Matching ignores case and accents, so sao paulo finds São Paulo.
+//
+// The matcher scans the catalog, tokenizing on every search: the library
+// is small enough, and there is no index file that could go stale. Hits
+// rank by a weighted count of matches rather than FTS5's bm25.
+
+type searchField struct {
+	name   string
+	weight float64
+	text   func(e *catalogEntry) []string
+}
+
+// searchFields are the fields a query looks in, most telling first; the
+// weights rank an image whose title matches above one whose credit does.
+var searchFields = []searchField{
+	{"title", 4, func(e *catalogEntry) []string { return []string{e.Title} }},
+	{"location", 3, func(e *catalogEntry) []string { return []string{e.Location} }},
+	{"tags", 2, func(e *catalogEntry) []string { return e.Tags }},
+	{"description", 1, func(e *catalogEntry) []string { return []string{e.Description} }},
+	{"copyright", 1, func(e *catalogEntry) []string { return []string{e.Copyright} }},
+	{"locale", 0.5, func(e *catalogEntry) []string { return e.Locales }},
+	{"source", 0.5, func(e *catalogEntry) []string { return []string{e.Source} }},
+	{"path", 0.5, func(e *catalogEntry) []string { return []string{e.Path} }},
+}
+
+// searchDoc is an entry's fields as tokens, in searchFields order. Values
+// of a list field are kept apart so a phrase cannot span two tags.
+type searchDoc [][][]string
+
+func newSearchDoc(e *catalogEntry) searchDoc {
+	doc := make(searchDoc, len(searchFields))
+	for i, f := range searchFields {
+		for _, s := range f.text(e) {
+			if toks := tokenize(s); len(toks) > 0 {
+				doc[i] = append(doc[i], toks)
+			}
+		}
+	}
+	return doc
+}
+
+// tokenize splits s into lower-case words without accents.
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for i, w := range words {
+		words[i] = strings.Map(foldRune, w)
+	}
+	return words
+}
+
+const (
+	latin1Fold   = "AAAAAAACEEEEIIIIDNOOOOOxOUUUUYTsaaaaaaaceeeeiiiidnooooo/ouuuuyty"
+	latinExtFold = "AaAaAaCcCcCcCcDdDdEeEeEeEeEeGgGgGgGgHhHhIiIiIiIiIiIiJjKkkLlLlLlLlLlNnNnNnnNnOoOoOoOoRrRrRrSsSsSsSsTtTtTtUuUuUuUuUuUuWwYyyZzZzZzs"
+)
+
+// foldRune lower-cases r and strips accents from Latin letters.
+func foldRune(r rune) rune {
+	switch {
+	case r >= 0xc0 && r <= 0xff:
+		r = rune(latin1Fold[r-0xc0])
+	case r >= 0x100 && r <= 0x17f:
+		r = rune(latinExtFold[r-0x100])
+	}
+	return unicode.ToLower(r)
+}
+
+// queryNode is a parsed search query.
+type queryNode struct {
+	op     string // and, or, not, phrase
+	kids   []*queryNode
+	field  int      // for phrase: index into searchFields, -1 for all
+	tokens []string // for phrase
+	prefix bool     // for phrase: the last token is a prefix
+}
+
+// parseQuery parses a query; an empty one matches everything.
+func parseQuery(s string) (*queryNode, error) {
+	p := &queryParser{}
+	if err := p.lex(s); err != nil {
+		return nil, err
+	}
+	if len(p.toks) == 0 {
+		return &queryNode{op: "and"}, nil
+	}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q in the query", p.toks[p.pos].text)
+	}
+	return n, nil
+}
+
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+type queryParser struct {
+	toks []queryToken
+	pos  int
+}
+
+func (p *queryParser) lex(s string) error {
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			p.toks = append(p.toks, queryToken{text: s[i : i+1]})
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return errors.New("unterminated phrase in the query")
+			}
+			p.toks = append(p.toks, queryToken{text: s[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n()\"", rune(s[j])) {
+				j++
+			}
+			p.toks = append(p.toks, queryToken{text: s[i:j]})
+			i = j
+		}
+	}
+	return nil
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.toks) {
+		return queryToken{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *queryParser) keyword(k string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && t.text == k {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) or() (*queryNode, error) {
+	n, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		m, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		n = &queryNode{op: "or", kids: []*queryNode{n, m}}
+	}
+	return n, nil
+}
+
+func (p *queryParser) and() (*queryNode, error) {
+	n := &queryNode{op: "and"}
+	for {
+		t, ok := p.peek()
+		if !ok || (!t.quoted && (t.text == ")" || t.text == "OR")) {
+			break
+		}
+		p.keyword("AND")
+		not := p.keyword("NOT")
+		m, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		if not {
+			m = &queryNode{op: "not", kids: []*queryNode{m}}
+		}
+		n.kids = append(n.kids, m)
+	}
+	if len(n.kids) == 0 {
+		return nil, errors.New("incomplete query")
+	}
+	if len(n.kids) == 1 && n.kids[0].op != "not" {
+		return n.kids[0], nil
+	}
+	return n, nil
+}
+
+func (p *queryParser) primary() (*queryNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("incomplete query")
+	}
+	p.pos++
+	if !t.quoted && t.text == "(" {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, errors.New("missing ) in the query")
+		}
+		return n, nil
+	}
+	n := &queryNode{op: "phrase", field: -1}
+	text := t.text
+	if !t.quoted {
+		// field:word, but not 10:30
+		if name, rest, ok := strings.Cut(text, ":"); ok && name != "" && strings.IndexFunc(name, func(r rune) bool { return !unicode.IsLetter(r) }) < 0 {
+			n.field = slices.IndexFunc(searchFields, func(f searchField) bool { return f.name == strings.ToLower(name) })
+			if n.field < 0 {
+				return nil, fmt.Errorf("unknown search field %q (want %s)", name, searchFieldNames())
+			}
+			text = rest
+			if text == "" {
+				// field:"a phrase"
+				if t, ok = p.peek(); !ok || !t.quoted {
+					return nil, fmt.Errorf("nothing to look for in %s:", name)
+				}
+				p.pos++
+				text = t.text
+			}
+		}
+		text, n.prefix = strings.CutSuffix(text, "*")
+	}
+	if n.tokens = tokenize(text); len(n.tokens) == 0 {
+		return nil, fmt.Errorf("nothing to look for in %q", t.text)
+	}
+	return n, nil
+}
+
+func searchFieldNames() string {
+	var names []string
+	for _, f := range searchFields {
+		names = append(names, f.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// match reports whether doc matches and how well: the weighted number of
+// places the query's words were found.
+func (n *queryNode) match(doc searchDoc) (bool, float64) {
+	switch n.op {
+	case "and":
+		var score float64
+		for _, k := range n.kids {
+			ok, s := k.match(doc)
+			if !ok {
+				return false, 0
+			}
+			score += s
+		}
+		return true, score
+	case "or":
+		var hit bool
+		var score float64
+		for _, k := range n.kids {
+			if ok, s := k.match(doc); ok {
+				hit = true
+				score += s
+			}
+		}
+		return hit, score
+	case "not":
+		ok, _ := n.kids[0].match(doc)
+		return !ok, 0
+	}
+	var score float64
+	for i, values := range doc {
+		if n.field >= 0 && i != n.field {
+			continue
+		}
+		for _, toks := range values {
+			score += float64(n.count(toks)) * searchFields[i].weight
+		}
+	}
+	return score > 0, score
+}
+
+// count returns how often the phrase occurs in toks.
+func (n *queryNode) count(toks []string) int {
+	var c int
+	last := len(n.tokens) - 1
+	for i := 0; i+last < len(toks); i++ {
+		ok := true
+		for j, t := range n.tokens {
+			if j == last && n.prefix {
+				ok = strings.HasPrefix(toks[i+j], t)
+			} else {
+				ok = toks[i+j] == t
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			c++
+		}
+	}
+	return c
+}
+
+// matchesQuery reports whether e matches q. A query that does not parse
+// is searched for as plain words, which is what the web gallery's search
+// box wants.
+func matchesQuery(e *catalogEntry, q string) bool {
+	n, err := parseQuery(q)
+	if err != nil {
+		n, _ = parseQuery(strings.NewReplacer(`"`, " ", "(", " ", ")", " ", ":", " ").Replace(q))
+		if n == nil {
+			return true
+		}
+	}
+	ok, _ := n.match(newSearchDoc(e))
+	return ok
+}
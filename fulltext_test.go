@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	doc := newSearchDoc(&catalogEntry{
+		Title: "Lake Bled", Location: "Bled, Slovenia", Description: "Golden gate of the Alps",
+		Copyright: "© Jane Doe", Tags: []string{"lake", "alps"}, Locales: []string{"de-DE"},
+		Source: "spotlight", Path: "2024/lake-bled.jpg",
+	})
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{"", true},
+		{"bled", true},
+		{"BLED slovenia", true},
+		{"bled iceland", false},
+		{"bled OR iceland", true},
+		{"bled NOT iceland", true},
+		{"NOT bled", false},
+		{"bled AND (iceland OR alps)", true},
+		{`"golden gate"`, true},
+		{`"gate golden"`, false},
+		{"slov*", true},
+		{"title:bled", true},
+		{"title:slovenia", false},
+		{`description:"the alps"`, true},
+		{"Location:slovenia", true},
+		{"slovénia", true},
+		{"10:30", false},
+		{`"lake alps"`, false}, // a phrase does not span two tags
+	}
+	for _, tt := range tests {
+		n, err := parseQuery(tt.q)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.q, err)
+			continue
+		}
+		if got, _ := n.match(doc); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		q   string
+		err string
+	}{
+		{`"open`, "unterminated phrase"},
+		{"(bled", "missing )"},
+		{"bled)", `unexpected ")"`},
+		{"bled OR", "incomplete query"},
+		{"NOT", "incomplete query"},
+		{"colour:red", `unknown search field "colour"`},
+		{"title:", "nothing to look for in title:"},
+		{"*", `nothing to look for in "*"`},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.q)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseQuery(%q) error = %v, want %q", tt.q, err, tt.err)
+		}
+	}
+}
+
+func TestMatchRanksTitleFirst(t *testing.T) {
+	n, err := parseQuery("bled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, title := n.match(newSearchDoc(&catalogEntry{Title: "Bled"}))
+	_, credit := n.match(newSearchDoc(&catalogEntry{Copyright: "Bled"}))
+	if title <= credit {
+		t.Errorf("title score %v, credit score %v", title, credit)
+	}
+}
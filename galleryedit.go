@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The editing mode of the served gallery (serve -edit): tag, rate,
+// favorite and block images from a browser, one at a time on an image's
+// page or in batches by ticking them in the grid. Every change goes
+// through library.update, so it takes the library lock like the commands
+// do. Editing needs the token in $SPOTLIGHTDL_SERVE_TOKEN: scripts send it
+// as a Bearer token, browsers log in once at /login and get a session
+// cookie derived from it, so the token itself is never stored there.
+//
+//	POST /edit  sha=<sha256>... action=favorite|unfavorite|tag|rate|block [tags=a,-b] [rating=0-5] [back=/path]
+
+const editCookie = "spotlightdl_edit"
+
+// galleryEditor authenticates and applies the gallery's edits.
+type galleryEditor struct {
+	lib     *library
+	token   string
+	session string       // the cookie's value
+	limit   *rateLimiter // login attempts
+}
+
+func newGalleryEditor(lib *library, token string) *galleryEditor {
+	// a new token logs every browser out
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("spotlightdl gallery session"))
+	return &galleryEditor{
+		lib:     lib,
+		token:   token,
+		session: hex.EncodeToString(mac.Sum(nil)),
+		limit:   newRateLimiter(10*time.Second, 5),
+	}
+}
+
+// authorized reports whether r carries the session cookie or the token.
+func (g *galleryEditor) authorized(r *http.Request) bool {
+	if g == nil {
+		return false
+	}
+	if c, err := r.Cookie(editCookie); err == nil && subtle.ConstantTimeCompare([]byte(c.Value), []byte(g.session)) == 1 {
+		return true
+	}
+	return authorized(r, g.token)
+}
+
+func (g *galleryEditor) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		render(w, loginTmpl, "")
+	})
+
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		// limit before checking so the form cannot be used to guess
+		// tokens quickly
+		if wait := g.limit.take(); wait > 0 {
+			w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds()+1)))
+			http.Error(w, "too many attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		got := strings.TrimSpace(r.PostFormValue("token"))
+		if subtle.ConstantTimeCompare([]byte(got), []byte(g.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			render(w, loginTmpl, "wrong token")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name: editCookie, Value: g.session, Path: "/",
+			MaxAge: int((90 * 24 * time.Hour).Seconds()), HttpOnly: true,
+			// a strict cookie is not sent with forms posted from other
+			// sites, which keeps them from editing through a logged-in
+			// browser
+			SameSite: http.SameSiteStrictMode, Secure: r.TLS != nil,
+		})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	mux.HandleFunc("POST /logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: editCookie, Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	mux.HandleFunc("POST /edit", func(w http.ResponseWriter, r *http.Request) {
+		if !g.authorized(r) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := g.apply(r.PostForm["sha"], r.PostForm.Get("action"), r.PostForm.Get("tags"), r.PostForm.Get("rating"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			var he httpError
+			switch {
+			case errors.As(err, &he):
+				status = he.status
+			case errors.As(err, new(*lockedError)):
+				status = http.StatusConflict
+			case errors.As(err, new(*frozenError)):
+				status = http.StatusLocked
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		back := r.PostForm.Get("back")
+		// only paths on this server, not //elsewhere, and not the page of
+		// an image that is gone
+		if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.HasPrefix(back, "/\\") ||
+			r.PostForm.Get("action") == "block" && strings.HasPrefix(back, "/image/") {
+			back = "/"
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	})
+}
+
+// apply runs one action on the images given by SHA-256 (or a unique
+// prefix). Ratings go to an XMP sidecar that is already there, as with
+// `rate`, and blocked images go to the trash with a tombstone, as with
+// `block`.
+func (g *galleryEditor) apply(shas []string, action, tags, rating string) error {
+	if len(shas) == 0 {
+		return httpError{http.StatusBadRequest, "no images selected"}
+	}
+	switch action {
+	case "favorite", "unfavorite", "tag", "rate", "block":
+	default:
+		return httpError{http.StatusBadRequest, fmt.Sprintf("unknown action %q", action)}
+	}
+	if action == "tag" && strings.TrimSpace(tags) == "" {
+		return httpError{http.StatusBadRequest, "no tags given"}
+	}
+	stars, err := strconv.Atoi(rating)
+	if action == "rate" && (err != nil || stars < 0 || stars > 5) {
+		return httpError{http.StatusBadRequest, fmt.Sprintf("rating must be 0 (clear) to 5, got %q", rating)}
+	}
+	return g.lib.update(func(cat *catalog) error {
+		var entries []*catalogEntry
+		for _, sha := range shas {
+			e, err := lookupSHA(cat, sha)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		switch action {
+		case "favorite", "unfavorite":
+			for _, e := range entries {
+				e.Favorite = action == "favorite"
+			}
+		case "tag":
+			for _, e := range entries {
+				e.Tags = editTags(e.Tags, tags)
+				if err := syncXMPTags(filepath.Join(g.lib.outDir, filepath.FromSlash(e.Path)), e.Tags); err != nil {
+					return err
+				}
+			}
+		case "rate":
+			for _, e := range entries {
+				e.Rating = stars
+				if err := syncXMPRating(filepath.Join(g.lib.outDir, filepath.FromSlash(e.Path)), stars); err != nil {
+					return err
+				}
+			}
+		case "block":
+			return blockEntries(g.lib.outDir, cat, entries)
+		}
+		return nil
+	})
+}
+
+// blockEntries moves images to the trash and leaves tombstones for them;
+// the caller holds the library lock and saves cat.
+func blockEntries(outDir string, cat *catalog, entries []*catalogEntry) error {
+	if err := checkFrozen(outDir, "block"); err != nil {
+		return err
+	}
+	t, err := loadTombstones(outDir)
+	if err != nil {
+		return err
+	}
+	trash, err := loadTrash(outDir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		t = t.bury(e, "blocked")
+		if trash, err = trashImage(outDir, cat, trash, e, now); err != nil {
+			return err
+		}
+	}
+	if err := saveTombstones(outDir, t); err != nil {
+		return err
+	}
+	return saveTrash(outDir, trash)
+}
+
+var loginTmpl = template.Must(template.New("login").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width">
+<title>spotlightdl: log in</title>` + galleryStyle + `</head><body>
+<header><a href="/"><b>spotlightdl</b></a><span>log in to edit</span></header>
+<form class="detail" method="post" action="/login">
+<p><input type="password" name="token" placeholder="token from $SPOTLIGHTDL_SERVE_TOKEN" autofocus> <button>log in</button></p>
+{{with .}}<p class="error">{{.}}</p>{{end}}
+</form>
+</body></html>`))
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/drzo1dberg/spotlightDlGo/api"
+)
+
+// healthReport is served on /healthz and written to -health-file.
+type healthReport = api.Health
+
+// healthOf judges the recorded runs: failing if the latest finished run
+// died with an error, stale if nothing succeeded within maxAge (0 = no
+// limit).
+func healthOf(u *usageStats, maxAge time.Duration, now time.Time) healthReport {
+	h := healthReport{Status: "unknown"}
+	var finished *runRecord
+	for i := len(u.Recent) - 1; i >= 0; i-- {
+		r := u.Recent[i]
+		if !r.OK && r.Error == "" {
+			continue // still running, or killed without a trace
+		}
+		if finished == nil {
+			finished = r
+		}
+		if r.OK {
+			end := r.Start.Add(time.Duration(r.Seconds * float64(time.Second)))
+			h.LastSuccess = &end
+			break
+		}
+	}
+	if n := len(u.Recent); n > 0 {
+		h.LastRun = &u.Recent[n-1].Start
+	}
+	switch {
+	case finished == nil:
+	case !finished.OK:
+		h.Status, h.LastError = "failing", finished.Error
+	case maxAge > 0 && now.Sub(*h.LastSuccess) > maxAge:
+		h.Status = "stale"
+	default:
+		h.Status = "ok"
+	}
+	return h
+}
+
+// healthHandler serves GET /healthz: 200 unless the report is failing or
+// stale, so it can back a container liveness probe. running may be nil.
+func healthHandler(outDir string, maxAge time.Duration, running func() bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := openUsage(outDir)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, healthReport{Status: "failing", LastError: err.Error()})
+			return
+		}
+		h := healthOf(u, maxAge, time.Now())
+		if running != nil {
+			h.Running = running()
+		}
+		status := http.StatusOK
+		if h.Status == "failing" || h.Status == "stale" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, h)
+	}
+}
+
+func writeHealthFile(path string, u *usageStats) error {
+	b, err := json.MarshalIndent(healthOf(u, 0, time.Now()), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(b, '\n'))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Hooks run a user's command after each download (-exec) or after the
+// run (-exec-run-end). The command line is split into words the way a
+// shell would, but no shell runs it: placeholders are filled in word by
+// word, so a title with quotes or a semicolon in it stays one argument
+// and cannot run anything. The values are also in the environment as
+// SPOTLIGHTDL_<NAME>, for scripts.
+
+var (
+	execPlaceholders       = []string{"path", "title", "url", "sha256", "copyright", "source", "locale", "outdir"}
+	execRunEndPlaceholders = []string{"outdir", "new", "failed", "stopped"}
+)
+
+// hookCommand is a parsed -exec or -exec-run-end.
+type hookCommand struct {
+	flag string
+	argv []string
+}
+
+// parseHook splits a hook's command line and checks its placeholders.
+func parseHook(flag, line string, placeholders []string) (*hookCommand, error) {
+	argv, err := splitCommand(line)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %w", flag, err)
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("-%s: empty command", flag)
+	}
+	for _, arg := range argv {
+		for _, m := range nameTemplate.FindAllString(arg, -1) {
+			if !slices.Contains(placeholders, m[1:len(m)-1]) {
+				return nil, fmt.Errorf("-%s: unknown placeholder %s (want {%s})", flag, m, strings.Join(placeholders, "}, {"))
+			}
+		}
+	}
+	return &hookCommand{flag: flag, argv: argv}, nil
+}
+
+// splitCommand splits a command line into words with the quoting rules of
+// a POSIX shell: '...' is literal, "..." allows \" and \\, and a backslash
+// outside quotes escapes the next character.
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated '")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\$`+"`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New(`unterminated "`)
+			}
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+		default:
+			word.WriteByte(c)
+		}
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// run starts the command with the placeholders filled in from vars and
+// waits for it. Its output goes to stderr, keeping stdout for -output
+// json and -events.
+func (h *hookCommand) run(ctx context.Context, vars map[string]string) error {
+	if h == nil {
+		return nil
+	}
+	argv := make([]string, len(h.argv))
+	for i, arg := range h.argv {
+		argv[i] = nameTemplate.ReplaceAllStringFunc(arg, func(m string) string {
+			return vars[m[1:len(m)-1]]
+		})
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, "SPOTLIGHTDL_"+strings.ToUpper(k)+"="+v)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-%s: %s: %w", h.flag, argv[0], err)
+	}
+	return nil
+}
+
+// downloadHookVars are the values -exec gets for a new image.
+func downloadHookVars(outDir, path string, im spotImage, sum string) map[string]string {
+	return map[string]string{
+		"path":      path,
+		"title":     im.Title,
+		"url":       im.URL,
+		"sha256":    sum,
+		"copyright": im.Copyright,
+		"source":    im.Source,
+		"locale":    im.Locale,
+		"outdir":    outDir,
+	}
+}
+
+// runEndHookVars are the values -exec-run-end gets.
+func runEndHookVars(outDir string, s *runSummary) map[string]string {
+	return map[string]string{
+		"outdir":  outDir,
+		"new":     strconv.Itoa(len(s.Downloaded)),
+		"failed":  strconv.Itoa(len(s.Failed)),
+		"stopped": s.Stopped,
+	}
+}
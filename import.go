@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Windows keeps the Spotlight images it has shown as extensionless files:
+// the classic lock screen under ContentDeliveryManager, the Windows 11
+// desktop Spotlight under IrisService.
+const (
+	cdmAssetsDir = `Packages\Microsoft.Windows.ContentDeliveryManager_cw5n1h2txyewy\LocalState\Assets`
+	irisDir      = `Packages\MicrosoftWindows.Client.CBS_cw5n1h2txyewy\LocalCache\Microsoft\IrisService`
+)
+
+func init() {
+	registerCommand("import", cmdImport)
+}
+
+func cmdImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	from := flags.String("from", "", "Spotlight assets folder (default: the current Windows user's)")
+	minWidth := flags.Int("min-width", 1280, "ignore images narrower than this (tiles, logos)")
+	verbose := flags.Bool("v", false, "verbose logging")
+	parseFlags(flags, args)
+
+	dirs := []string{*from}
+	if *from == "" {
+		local := os.Getenv("LOCALAPPDATA")
+		if local == "" {
+			return errors.New("import: no default assets folder on this system, use -from")
+		}
+		dirs = []string{filepath.Join(local, cdmAssetsDir), filepath.Join(local, irisDir)}
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	lock, err := lockLibrary(context.Background(), *outDir, "import", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+
+	var imported, dup, skipped int
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && p == dir {
+					return fs.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			ok, err := isLandscapeJPEG(p, *minWidth)
+			if err != nil || !ok {
+				skipped++
+				return nil
+			}
+			sum, size, err := hashFile(p)
+			if err != nil {
+				return err
+			}
+			if cat.bySHA(sum) != nil {
+				dup++
+				if *verbose {
+					fmt.Printf("already in library: %s\n", p)
+				}
+				return nil
+			}
+			name := "spotlight-" + sum[:16] + ".jpg"
+			dst := filepath.Join(*outDir, name)
+			if err := copyFile(p, dst); err != nil {
+				return err
+			}
+			e := &catalogEntry{Path: name, SHA256: sum, Size: size, Source: "import", Added: time.Now().UTC()}
+			e.Width, e.Height, _ = imageSize(dst)
+			cat.add(e)
+			imported++
+			fmt.Println(dst)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("done. imported=%d duplicates=%d ignored=%d\n", imported, dup, skipped)
+	}
+	return nil
+}
+
+func isLandscapeJPEG(path string, minWidth int) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, 3)
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, []byte{0xff, 0xd8, 0xff}) {
+		return false, nil
+	}
+	w, h, err := imageSize(path)
+	if err != nil {
+		return false, nil
+	}
+	return w > h && w >= minWidth, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringLookup reads a secret from the OS keyring via the platform CLI
+// (security on macOS, secret-tool from libsecret elsewhere).
+func keyringLookup(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(out))
+	if secret == "" {
+		return "", errors.New("keyring: empty secret")
+	}
+	return secret, nil
+}
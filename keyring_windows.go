@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32  = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead = modadvapi32.NewProc("CredReadW")
+	procCredFree = modadvapi32.NewProc("CredFree")
+)
+
+const credTypeGeneric = 1
+
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keyringLookup reads a generic credential named "service:account" from the
+// Windows Credential Manager (e.g. created with
+// `cmdkey /generic:spotlightdl:unsplash /user:unsplash /pass:<key>`).
+func keyringLookup(service, account string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(service + ":" + account)
+	if err != nil {
+		return "", err
+	}
+	var c *credential
+	r, _, e := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&c)))
+	if r == 0 {
+		return "", e
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(c)))
+	if c.CredentialBlobSize == 0 {
+		return "", errors.New("keyring: empty secret")
+	}
+	blob := unsafe.Slice(c.CredentialBlob, c.CredentialBlobSize)
+	// cmdkey stores the password as UTF-16
+	if len(blob)%2 == 0 {
+		u := unsafe.Slice((*uint16)(unsafe.Pointer(c.CredentialBlob)), len(blob)/2)
+		return strings.TrimSpace(syscall.UTF16ToString(u)), nil
+	}
+	return strings.TrimSpace(string(blob)), nil
+}
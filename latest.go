@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// -latest keeps latest.jpg (or .png, and so on) at the top of the library
+// on the newest image, a path that wallpaper tools and scripts can rely
+// on: a symbolic link, or with copy a copy of the file, for Windows, where
+// links need Developer Mode, and for tools that do not follow them. It is
+// no image of its own to the catalog or the archive history.
+
+const latestName = "latest"
+
+func checkLatest(mode string) error {
+	if mode != "" && mode != "link" && mode != "copy" {
+		return fmt.Errorf("-latest: unknown %q (want link or copy)", mode)
+	}
+	return nil
+}
+
+// isLatestFile reports whether p is the -latest file of outDir.
+func isLatestFile(outDir, p string) bool {
+	return filepath.Dir(p) == filepath.Clean(outDir) && strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)) == latestName
+}
+
+// newestImage is the path of the image added last, or "". Without a
+// catalog (-lite) it is the last one of this run.
+func newestImage(outDir string, cat *catalog, s *runSummary) string {
+	if cat == nil {
+		if len(s.Downloaded) == 0 {
+			return ""
+		}
+		return s.Downloaded[len(s.Downloaded)-1].Path
+	}
+	var newest *catalogEntry
+	for _, e := range cat.Images {
+		if newest == nil || e.Added.After(newest.Added) {
+			newest = e
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return filepath.Join(outDir, filepath.FromSlash(newest.Path))
+}
+
+// updateLatest makes latest.<ext> in outDir the image at p.
+func updateLatest(outDir, p, mode string) error {
+	ext := strings.ToLower(filepath.Ext(p))
+	dst := filepath.Join(outDir, latestName+ext)
+	// one of another type, from an earlier newest image, goes
+	for _, other := range imageExts {
+		if other != ext {
+			os.Remove(filepath.Join(outDir, latestName+other))
+		}
+	}
+	if mode == "copy" {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		// a link from -latest link is replaced, not followed
+		if fi, err := os.Lstat(dst); err == nil && fi.Mode().IsRegular() {
+			if old, err := os.ReadFile(dst); err == nil && bytes.Equal(old, b) {
+				return nil
+			}
+		}
+		return writeFileAtomic(dst, b)
+	}
+	target, err := filepath.Rel(outDir, p)
+	if err != nil {
+		return err
+	}
+	if cur, err := os.Readlink(dst); err == nil && cur == target {
+		return nil
+	}
+	// a new link renamed over the old one, so that there is always one
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
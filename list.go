@@ -0,0 +1,207 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// list and search find images in the catalog by what is known about
+// them, for "that beach one from March": search takes a full-text query
+// (see fulltext.go) and ranks the matches, and both take filters. An
+// image's date is when the source published it, or when it was downloaded
+// for sources that do not say.
+
+func init() {
+	registerCommand("list", cmdList)
+	registerCommand("search", cmdSearch)
+}
+
+func cmdList(args []string) error {
+	return listImages("list", args)
+}
+
+func cmdSearch(args []string) error {
+	return listImages("search", args)
+}
+
+type listFilter struct {
+	query         *queryNode
+	title, credit string
+	locale        string
+	from, to      time.Time
+	minW, minH    int
+	favoritesOnly bool
+	minRating     int
+	tags          tagFilter
+}
+
+func listImages(name string, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	title := flags.String("title", "", "only images whose title contains this (any case)")
+	credit := flags.String("copyright", "", "only images whose copyright line contains this (any case)")
+	locale := flags.String("locale", "", "only images offered in this locale (de-DE) or country (DE)")
+	fromFlag := flags.String("from", "", "only images from this date on: 2025, 2025-03, 2025-03-14, or as for diff -since")
+	toFlag := flags.String("to", "", "only images up to and including this date, as for -from")
+	minRes := flags.String("min-resolution", "", "only images at least this large, e.g. 1920x1080")
+	favoritesOnly := flags.Bool("favorites-only", false, "only favorites")
+	minRating := flags.Int("min-rating", 0, "only images rated at least this, 1-5")
+	tags := flags.String("tag", "", "only images with one of these tags, and none of those prefixed with -, e.g. beach,-night")
+	format := flags.String("format", "table", "table or json")
+	limit := flags.Int("limit", 0, "show at most this many images, the best matches or newest first (0 = all)")
+	if name == "search" {
+		flags.Usage = func() {
+			fmt.Fprintln(flags.Output(), "usage: spotlightdl search [flags] <query>")
+			fmt.Fprintln(flags.Output(), `  e.g. beach NOT sunset, "golden gate", moun*, location:iceland`)
+			flags.PrintDefaults()
+		}
+	}
+	parseFlags(flags, args)
+
+	if name == "search" && flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("search: need something to look for")
+	}
+	if name == "list" && flags.NArg() > 0 {
+		return fmt.Errorf("list: unexpected argument %q; search looks for words", flags.Arg(0))
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("%s: unknown -format %q (want table or json)", name, *format)
+	}
+	f := listFilter{title: *title, credit: *credit, locale: *locale, favoritesOnly: *favoritesOnly, minRating: *minRating, tags: parseTagFilter(*tags)}
+	var err error
+	if f.query, err = parseQuery(strings.Join(flags.Args(), " ")); err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	if *fromFlag != "" {
+		if f.from, err = parseDateBound(*fromFlag, false); err != nil {
+			return fmt.Errorf("%s: -from: %w", name, err)
+		}
+	}
+	if *toFlag != "" {
+		if f.to, err = parseDateBound(*toFlag, true); err != nil {
+			return fmt.Errorf("%s: -to: %w", name, err)
+		}
+	}
+	if *minRes != "" {
+		if _, err := fmt.Sscanf(strings.ToLower(*minRes), "%dx%d", &f.minW, &f.minH); err != nil {
+			return fmt.Errorf("%s: invalid -min-resolution %q (want WIDTHxHEIGHT)", name, *minRes)
+		}
+	}
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	var found []*catalogEntry
+	rank := make(map[*catalogEntry]float64)
+	for _, e := range cat.Images {
+		if ok, score := f.match(e); ok {
+			found = append(found, e)
+			rank[e] = score
+		}
+	}
+	// best matches first, then newest first
+	slices.SortStableFunc(found, func(a, b *catalogEntry) int {
+		if rank[a] != rank[b] {
+			return cmp.Compare(rank[b], rank[a])
+		}
+		return imageDate(b).Compare(imageDate(a))
+	})
+	if *limit > 0 && len(found) > *limit {
+		found = found[:*limit]
+	}
+
+	if *format == "json" {
+		if found == nil {
+			found = []*catalogEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(found)
+	}
+	if len(found) == 0 {
+		fmt.Println("no matching images")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tSIZE\tLOCALE\tTITLE\tPATH")
+	for _, e := range found {
+		res := "-"
+		if e.Width > 0 {
+			res = fmt.Sprintf("%dx%d", e.Width, e.Height)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", imageDate(e).Local().Format("2006-01-02"), res,
+			firstNonEmpty(strings.Join(e.Locales, ","), "-"), firstNonEmpty(e.Title, "-"), e.Path)
+	}
+	return tw.Flush()
+}
+
+// imageDate is when the source published an image, or when it was
+// downloaded.
+func imageDate(e *catalogEntry) time.Time {
+	if !e.Published.IsZero() {
+		return e.Published
+	}
+	return e.Added
+}
+
+// match reports whether e passes the filters and, for a search, how well
+// it matches the query.
+func (f *listFilter) match(e *catalogEntry) (bool, float64) {
+	if (f.favoritesOnly && !e.Favorite) || e.Rating < f.minRating || !f.tags.admits(e.Tags) {
+		return false, 0
+	}
+	if f.title != "" && !containsFold(e.Title, f.title) {
+		return false, 0
+	}
+	if f.credit != "" && !containsFold(e.Copyright, f.credit) {
+		return false, 0
+	}
+	if f.locale != "" && !slices.ContainsFunc(e.Locales, func(l string) bool {
+		return strings.EqualFold(l, f.locale) || strings.EqualFold(localeFolder(l), f.locale)
+	}) {
+		return false, 0
+	}
+	d := imageDate(e)
+	if (!f.from.IsZero() && d.Before(f.from)) || (!f.to.IsZero() && !d.Before(f.to)) {
+		return false, 0
+	}
+	if (f.minW > 0 || f.minH > 0) && (e.Width < f.minW || e.Height < f.minH) {
+		return false, 0
+	}
+	return f.query.match(newSearchDoc(e))
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// parseDateBound reads a year, month or day as the start of that period,
+// or with end the start of the next one, so that -to 2025-03 takes in
+// all of March. Anything else is read as for diff -since.
+func parseDateBound(s string, end bool) (time.Time, error) {
+	for _, p := range []struct {
+		layout string
+		y, m   int
+	}{{"2006", 1, 0}, {"2006-01", 0, 1}, {"2006-01-02", 0, 0}} {
+		if t, err := time.ParseInLocation(p.layout, s, time.Local); err == nil {
+			if end {
+				if p.y == 0 && p.m == 0 {
+					return t.AddDate(0, 0, 1), nil
+				}
+				return t.AddDate(p.y, p.m, 0), nil
+			}
+			return t, nil
+		}
+	}
+	return parseSince(s)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The library lock keeps two runs from working on one directory at once,
+// as when a cron job starts while the previous one is still downloading.
+// It is an OS file lock on .spotlightdl/lock, so it goes away with the
+// process however that ends; the file itself only says who holds it.
+
+type lockHolder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// lockedError reports a library that another run is working on.
+type lockedError struct {
+	outDir string
+	holder *lockHolder
+}
+
+func (e *lockedError) Error() string {
+	msg := "another spotlightdl run is working on " + e.outDir
+	if e.holder != nil {
+		msg = fmt.Sprintf("another spotlightdl run (%s, pid %d, since %s) is working on %s",
+			e.holder.Command, e.holder.PID, e.holder.Since.Local().Format("15:04:05"), e.outDir)
+	}
+	return msg + "; -lock-wait waits for it"
+}
+
+// errLockHeld is what tryLockFile returns when someone else has the lock.
+var errLockHeld = errors.New("lock held")
+
+type libraryLock struct {
+	f *os.File
+}
+
+func lockPath(outDir string) string {
+	return filepath.Join(stateDir(outDir), "lock")
+}
+
+// lockLibrary takes the lock for outDir on behalf of command, retrying
+// for up to wait while another run holds it.
+func lockLibrary(ctx context.Context, outDir, command string, wait time.Duration) (*libraryLock, error) {
+	if err := os.MkdirAll(stateDir(outDir), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath(outDir), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err := tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockHeld) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", lockPath(outDir), err)
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, &lockedError{outDir: outDir, holder: readLockHolder(outDir)}
+		}
+		if err := sleepCtx(ctx, 500*time.Millisecond); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	b, _ := json.Marshal(lockHolder{PID: os.Getpid(), Command: command, Since: time.Now()})
+	f.Truncate(0)
+	f.WriteAt(append(b, '\n'), 0)
+	return &libraryLock{f: f}, nil
+}
+
+func readLockHolder(outDir string) *lockHolder {
+	b, err := os.ReadFile(lockPath(outDir))
+	if err != nil {
+		return nil
+	}
+	var h lockHolder
+	if json.Unmarshal(b, &h) != nil || h.PID == 0 {
+		return nil
+	}
+	return &h
+}
+
+// unlock releases the lock; a nil lock is fine.
+func (l *libraryLock) unlock() {
+	if l == nil {
+		return
+	}
+	l.f.Truncate(0)
+	unlockFile(l.f)
+	l.f.Close()
+}
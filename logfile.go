@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingFile is an append-only log file that moves itself aside once it
+// grows past maxSize. Rotated files are named <base>-<timestamp><ext> and
+// pruned beyond keep files or maxAge. Several processes may share one
+// (the daemon and its fetches): a writer that finds the path rotated by
+// someone else simply reopens it.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration // 0 keeps rotated files regardless of age
+	keep    int           // 0 keeps any number
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, keep: keep}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if r.f != nil {
+		r.f.Close()
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// another process may have rotated the file under us
+	if cur, err := os.Stat(r.path); err != nil || !sameFile(r.f, cur) {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func sameFile(f *os.File, fi os.FileInfo) bool {
+	own, err := f.Stat()
+	return err == nil && os.SameFile(own, fi)
+}
+
+func (r *rotatingFile) rotate() error {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	aside := fmt.Sprintf("%s-%s%s", base, time.Now().UTC().Format("20060102T150405.000"), ext)
+	if err := os.Rename(r.path, aside); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune(base, ext)
+	return nil
+}
+
+// prune removes rotated files beyond keep or older than maxAge. The
+// timestamps in the names sort chronologically.
+func (r *rotatingFile) prune(base, ext string) {
+	old, _ := filepath.Glob(base + "-*" + ext)
+	slices.Sort(old)
+	slices.Reverse(old)
+	for i, p := range old {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if (r.keep > 0 && i >= r.keep) || (r.maxAge > 0 && time.Since(fi.ModTime()) > r.maxAge) {
+			os.Remove(p)
+		}
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFile is the open -log-file, closed when the daemon reloads its
+// settings.
+var logFile *rotatingFile
+
+// jsonLogs and fileLogs are set once logging is configured, so that
+// fatal errors also reach the log in its format. fileLogs covers any log
+// that does not end up on stderr, syslog and journald included.
+var jsonLogs, fileLogs bool
+
+// logFlags are the logging options shared by the fetch run and the
+// long-running commands.
+type logFlags struct {
+	level   *string
+	format  *string
+	target  *string
+	file    *string
+	maxSize *string
+	maxAge  *string
+	keep    *int
+}
+
+func addLogFlags(flags *flag.FlagSet, defaultLevel string) *logFlags {
+	return &logFlags{
+		level:   flags.String("log-level", defaultLevel, "log level: debug, info, warn or error"),
+		format:  flags.String("log-format", "text", "log format: text or json"),
+		target:  flags.String("log-target", "", "where logs go: stderr, syslog or journald (Linux), eventlog (Windows); default stderr, or the event log for a Windows service"),
+		file:    flags.String("log-file", "", "write logs to this file instead of stderr, rotating it by size"),
+		maxSize: flags.String("log-max-size", "10MB", "rotate -log-file when it would grow past this size"),
+		maxAge:  flags.String("log-max-age", "30d", "delete rotated log files older than this (0 keeps them)"),
+		keep:    flags.Int("log-keep", 5, "rotated log files to keep (0 = no limit)"),
+	}
+}
+
+// setup installs the default slog logger. verbose lowers the level to
+// debug, as -v always did.
+func (l *logFlags) setup(verbose bool) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*l.level)); err != nil {
+		return fmt.Errorf("unknown -log-level %q (want debug, info, warn or error)", *l.level)
+	}
+	if verbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	t := strings.ToLower(*l.target)
+	if t == "" && *l.file == "" {
+		t = defaultLogTarget()
+	}
+	if t != "" && t != "stderr" {
+		if *l.file != "" {
+			return fmt.Errorf("-log-file and -log-target %s are mutually exclusive", t)
+		}
+		h, err := systemLogHandler(t, opts)
+		if err != nil {
+			return err
+		}
+		install(h, nil, false, false)
+		return nil
+	}
+	var file *rotatingFile
+	var out io.Writer = os.Stderr
+	if *l.file != "" {
+		maxSize, err := parseSize(*l.maxSize)
+		if err != nil {
+			return fmt.Errorf("-log-max-size: %w", err)
+		}
+		var maxAge time.Duration
+		if *l.maxAge != "0" {
+			if maxAge, err = parseAge(*l.maxAge); err != nil {
+				return fmt.Errorf("-log-max-age: %w", err)
+			}
+		}
+		if file, err = openRotatingFile(*l.file, maxSize, maxAge, *l.keep); err != nil {
+			return err
+		}
+		out = file
+	}
+	var h slog.Handler
+	switch strings.ToLower(*l.format) {
+	case "text":
+		h = slog.NewTextHandler(out, opts)
+	case "json":
+		h = slog.NewJSONHandler(out, opts)
+	default:
+		if file != nil {
+			file.Close()
+		}
+		return fmt.Errorf("unknown -log-format %q (want text or json)", *l.format)
+	}
+	install(h, file, strings.EqualFold(*l.format, "json"), file == nil)
+	return nil
+}
+
+// install makes h the default logger, replacing an earlier setup.
+func install(h slog.Handler, file *rotatingFile, json, stderr bool) {
+	slog.SetDefault(slog.New(h))
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile, jsonLogs, fileLogs = file, json, !stderr
+}
+
+// args passes the same settings on to a child process.
+func (l *logFlags) args() []string {
+	args := []string{"-log-level", *l.level, "-log-format", *l.format, "-log-target", *l.target}
+	if *l.file != "" {
+		args = append(args, "-log-file", *l.file, "-log-max-size", *l.maxSize,
+			"-log-max-age", *l.maxAge, "-log-keep", fmt.Sprint(*l.keep))
+	}
+	return args
+}
+
+// lineHandler renders a record as "msg key=value ..." without the time and
+// level, for system logs that record those on their own. Copies made by WithAttrs share
+// the buffer and its lock.
+type lineHandler struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+	h   slog.Handler
+}
+
+func newLineHandler(opts *slog.HandlerOptions) lineHandler {
+	buf := new(bytes.Buffer)
+	o := *opts
+	o.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+			return slog.Attr{}
+		}
+		return a
+	}
+	return lineHandler{mu: new(sync.Mutex), buf: buf, h: slog.NewTextHandler(buf, &o)}
+}
+
+// format must be called with mu held.
+func (l lineHandler) format(ctx context.Context, r slog.Record) string {
+	l.buf.Reset()
+	l.h.Handle(ctx, r)
+	attrs := strings.TrimSpace(l.buf.String())
+	if attrs == "" {
+		return r.Message
+	}
+	return r.Message + " " + attrs
+}
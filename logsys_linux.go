@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+)
+
+func defaultLogTarget() string { return "stderr" }
+
+// systemLogHandler returns a handler for -log-target syslog or journald.
+func systemLogHandler(target string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch target {
+	case "syslog":
+		w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "spotlightdl")
+		if err != nil {
+			return nil, fmt.Errorf("syslog: %w", err)
+		}
+		return &syslogHandler{w: w, shared: newLineHandler(opts)}, nil
+	case "journald":
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: "/run/systemd/journal/socket", Net: "unixgram"})
+		if err != nil {
+			return nil, fmt.Errorf("journald: %w", err)
+		}
+		return &journalHandler{conn: conn, level: opts.Level}, nil
+	case "eventlog":
+		return nil, fmt.Errorf("-log-target %s is only supported on Windows", target)
+	}
+	return nil, fmt.Errorf("unknown -log-target %q (want stderr, syslog or journald)", target)
+}
+
+type syslogHandler struct {
+	w      *syslog.Writer
+	shared lineHandler
+}
+
+func (s *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.shared.h.Enabled(ctx, level)
+}
+
+func (s *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	s.shared.mu.Lock()
+	defer s.shared.mu.Unlock()
+	msg := s.shared.format(ctx, r)
+	switch {
+	case r.Level >= slog.LevelError:
+		return s.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return s.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return s.w.Info(msg)
+	}
+	return s.w.Debug(msg)
+}
+
+func (s *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	l := s.shared
+	l.h = l.h.WithAttrs(attrs)
+	return &syslogHandler{w: s.w, shared: l}
+}
+
+func (s *syslogHandler) WithGroup(name string) slog.Handler {
+	l := s.shared
+	l.h = l.h.WithGroup(name)
+	return &syslogHandler{w: s.w, shared: l}
+}
+
+// journalHandler speaks the native journald protocol, so every attribute
+// becomes a field of its own (err= as ERR, and so on) that journalctl can
+// filter on. MESSAGE carries them too, for the plain journalctl view.
+type journalHandler struct {
+	conn   *net.UnixConn
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string // open groups, as FIELD_ prefix
+}
+
+func (j *journalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := slog.LevelInfo
+	if j.level != nil {
+		min = j.level.Level()
+	}
+	return level >= min
+}
+
+func (j *journalHandler) Handle(_ context.Context, r slog.Record) error {
+	var fields []string
+	var text strings.Builder
+	text.WriteString(r.Message)
+	var add func(prefix string, a slog.Attr)
+	add = func(prefix string, a slog.Attr) {
+		v := a.Value.Resolve()
+		if a.Key == "" && v.Kind() != slog.KindGroup {
+			return
+		}
+		if v.Kind() == slog.KindGroup {
+			p := prefix
+			if a.Key != "" {
+				p += journalKey(a.Key) + "_"
+			}
+			for _, g := range v.Group() {
+				add(p, g)
+			}
+			return
+		}
+		key := prefix + journalKey(a.Key)
+		fields = append(fields, key, v.String())
+		fmt.Fprintf(&text, " %s=%s", strings.ToLower(key), v.String())
+	}
+	for _, a := range j.attrs {
+		add("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(j.prefix, a)
+		return true
+	})
+
+	priority := "7"
+	switch {
+	case r.Level >= slog.LevelError:
+		priority = "3"
+	case r.Level >= slog.LevelWarn:
+		priority = "4"
+	case r.Level >= slog.LevelInfo:
+		priority = "6"
+	}
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", text.String())
+	writeJournalField(&b, "PRIORITY", priority)
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", "spotlightdl")
+	writeJournalField(&b, "SYSLOG_PID", fmt.Sprint(os.Getpid()))
+	for i := 0; i < len(fields); i += 2 {
+		writeJournalField(&b, fields[i], fields[i+1])
+	}
+	_, err := j.conn.Write(b.Bytes())
+	return err
+}
+
+func (j *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *j
+	if j.prefix != "" {
+		attrs = []slog.Attr{{Key: strings.TrimSuffix(j.prefix, "_"), Value: slog.GroupValue(attrs...)}}
+	}
+	c.attrs = append(append([]slog.Attr(nil), j.attrs...), attrs...)
+	return &c
+}
+
+func (j *journalHandler) WithGroup(name string) slog.Handler {
+	c := *j
+	c.prefix += journalKey(name) + "_"
+	return &c
+}
+
+// journalKey maps an attribute key onto the journal's field names:
+// uppercase letters, digits and underscores, not starting with one.
+func journalKey(k string) string {
+	k = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, k)
+	k = strings.TrimLeft(k, "_")
+	if k == "" || k[0] >= '0' && k[0] <= '9' {
+		k = "X" + k
+	}
+	return k
+}
+
+// writeJournalField uses the length-prefixed form for values with a
+// newline, as the protocol requires.
+func writeJournalField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+		return
+	}
+	b.WriteString(key)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func defaultLogTarget() string { return "stderr" }
+
+func systemLogHandler(target string, _ *slog.HandlerOptions) (slog.Handler, error) {
+	switch target {
+	case "syslog", "journald":
+		return nil, fmt.Errorf("-log-target %s is only supported on Linux", target)
+	case "eventlog":
+		return nil, fmt.Errorf("-log-target %s is only supported on Windows", target)
+	}
+	return nil, fmt.Errorf("unknown -log-target %q (want stderr)", target)
+}
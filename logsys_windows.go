@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procRegisterEventSource = modadvapi32.NewProc("RegisterEventSourceW")
+	procReportEvent         = modadvapi32.NewProc("ReportEventW")
+)
+
+const (
+	eventlogErrorType       = 0x0001
+	eventlogWarningType     = 0x0002
+	eventlogInformationType = 0x0004
+)
+
+// defaultLogTarget picks the event log when nothing would read stderr, as
+// for a service or a hidden scheduled task; a redirected stderr (as with
+// NSSM) is still honoured.
+func defaultLogTarget() string {
+	if syscall.Stderr == 0 || syscall.Stderr == syscall.InvalidHandle {
+		return "eventlog"
+	}
+	return "stderr"
+}
+
+func systemLogHandler(target string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch target {
+	case "eventlog":
+		name, err := syscall.UTF16PtrFromString("spotlightdl")
+		if err != nil {
+			return nil, err
+		}
+		h, _, err := procRegisterEventSource.Call(0, uintptr(unsafe.Pointer(name)))
+		if h == 0 {
+			return nil, fmt.Errorf("eventlog: %w", err)
+		}
+		// the Application log is shared; only warnings and errors go there
+		o := *opts
+		if o.Level == nil || o.Level.Level() < slog.LevelWarn {
+			o.Level = slog.LevelWarn
+		}
+		return &eventlogHandler{handle: h, shared: newLineHandler(&o)}, nil
+	case "syslog", "journald":
+		return nil, fmt.Errorf("-log-target %s is only supported on Linux", target)
+	}
+	return nil, fmt.Errorf("unknown -log-target %q (want stderr or eventlog)", target)
+}
+
+// eventlogHandler reports to the Application event log under the source
+// "spotlightdl", always with event ID 1.
+type eventlogHandler struct {
+	handle uintptr
+	shared lineHandler
+}
+
+func (e *eventlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return e.shared.h.Enabled(ctx, level)
+}
+
+func (e *eventlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	e.shared.mu.Lock()
+	msg := e.shared.format(ctx, r)
+	e.shared.mu.Unlock()
+	typ := uintptr(eventlogInformationType)
+	switch {
+	case r.Level >= slog.LevelError:
+		typ = eventlogErrorType
+	case r.Level >= slog.LevelWarn:
+		typ = eventlogWarningType
+	}
+	s, err := syscall.UTF16PtrFromString(msg)
+	if err != nil {
+		return err
+	}
+	ok, _, err := procReportEvent.Call(e.handle, typ, 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&s)), 0)
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
+
+func (e *eventlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	l := e.shared
+	l.h = l.h.WithAttrs(attrs)
+	return &eventlogHandler{handle: e.handle, shared: l}
+}
+
+func (e *eventlogHandler) WithGroup(name string) slog.Handler {
+	l := e.shared
+	l.h = l.h.WithGroup(name)
+	return &eventlogHandler{handle: e.handle, shared: l}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The manifest lists every image with where it came from and what it
+// hashes to, sorted by path so that two manifests diff cleanly: for
+// audits, and to see what another machine is missing.
+
+var manifestColumns = []string{"path", "sha256", "size", "url", "title", "copyright", "source", "locales", "added", "published"}
+
+type manifestEntry struct {
+	Path      string   `json:"path"`
+	SHA256    string   `json:"sha256"`
+	Size      int64    `json:"size"`
+	URL       string   `json:"url,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Copyright string   `json:"copyright,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Locales   []string `json:"locales,omitempty"`
+	Added     string   `json:"added"`
+	Published string   `json:"published,omitempty"`
+}
+
+func exportManifest(args []string) error {
+	flags := flag.NewFlagSet("export manifest", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	format := flags.String("format", "csv", "csv or json")
+	out := flags.String("o", "", "output file (default stdout)")
+	sel := addSelectionFlags(flags)
+	parseFlags(flags, args)
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("export manifest: unknown -format %q (want csv or json)", *format)
+	}
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	var entries []manifestEntry
+	for _, e := range cat.Images {
+		if !sel.admits(e) {
+			continue
+		}
+		m := manifestEntry{
+			Path:      e.Path,
+			SHA256:    e.SHA256,
+			Size:      e.Size,
+			URL:       e.URL,
+			Title:     e.Title,
+			Copyright: e.Copyright,
+			Source:    e.Source,
+			Locales:   e.Locales,
+			Added:     e.Added.UTC().Format(time.RFC3339),
+		}
+		if !e.Published.IsZero() {
+			m.Published = e.Published.UTC().Format(time.RFC3339)
+		}
+		entries = append(entries, m)
+	}
+	slices.SortFunc(entries, func(a, b manifestEntry) int { return cmp.Compare(a.Path, b.Path) })
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if *format == "json" {
+		if entries == nil {
+			entries = []manifestEntry{}
+		}
+		enc := json.NewEncoder(bw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+	cw := csv.NewWriter(bw)
+	cw.Write(manifestColumns)
+	for _, m := range entries {
+		cw.Write([]string{m.Path, m.SHA256, strconv.FormatInt(m.Size, 10), m.URL, m.Title, m.Copyright,
+			m.Source, strings.Join(m.Locales, ";"), m.Added, m.Published})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
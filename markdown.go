@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// `export markdown` writes an index of the library as Markdown, grouped
+// by month with a thumbnail for each image, for an archive kept in Git
+// and published on a forge that renders it. The thumbnails go to .thumbs
+// next to the index, which the library's own scans skip like every dot
+// directory.
+
+func exportMarkdown(args []string) error {
+	flags := flag.NewFlagSet("export markdown", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	out := flags.String("o", "", "file to write the index to (default INDEX.md in the library)")
+	title := flags.String("title", "Spotlight archive", "the index's heading")
+	sel := addSelectionFlags(flags)
+	parseFlags(flags, args)
+	if *out == "" {
+		*out = filepath.Join(*outDir, "INDEX.md")
+	}
+	base := filepath.Dir(*out)
+	thumbs := filepath.Join(base, ".thumbs")
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	entries := sel.entries(cat)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", mdEscape(*title))
+	if len(entries) == 0 {
+		b.WriteString("No images yet.\n")
+	} else {
+		first := imageDate(entries[len(entries)-1]).Local().Format("January 2006")
+		last := imageDate(entries[0]).Local().Format("January 2006")
+		if first == last {
+			fmt.Fprintf(&b, "%s images from %s.\n", thousands(len(entries)), first)
+		} else {
+			fmt.Fprintf(&b, "%s images from %s to %s.\n", thousands(len(entries)), first, last)
+		}
+	}
+
+	keep := make(map[string]bool)
+	month := ""
+	for _, e := range entries {
+		img, err := filepath.Rel(base, filepath.Join(*outDir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			return fmt.Errorf("export markdown: %w", err)
+		}
+		src := relURL(filepath.ToSlash(img))
+		thumb := src
+		if th, err := ensureThumb(*outDir, e); err == nil {
+			dst := filepath.Join(thumbs, e.SHA256+".jpg")
+			keep[dst] = true
+			if _, err := exportFile(th, dst, false); err != nil {
+				return fmt.Errorf("export markdown: %w", err)
+			}
+			thumb = relURL(".thumbs/" + e.SHA256 + ".jpg")
+		}
+
+		d := imageDate(e).Local()
+		if m := d.Format("January 2006"); m != month {
+			month = m
+			fmt.Fprintf(&b, "\n## %s\n", month)
+		}
+		name := firstNonEmpty(e.Title, filepath.Base(e.Path))
+		fmt.Fprintf(&b, "\n[![%s](%s)](%s)  \n**%s**", mdEscape(name), thumb, src, mdEscape(name))
+		for _, s := range nonEmpty(e.Location, d.Format("2006-01-02"), e.Copyright) {
+			fmt.Fprintf(&b, " · %s", mdEscape(s))
+		}
+		b.WriteString("\n")
+		if e.Description != "" {
+			fmt.Fprintf(&b, "\n%s\n", mdEscape(e.Description))
+		}
+	}
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(*out, []byte(b.String())); err != nil {
+		return err
+	}
+	// thumbnails of images no longer listed
+	filepath.WalkDir(thumbs, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !keep[p] {
+			os.Remove(p)
+		}
+		return nil
+	})
+	fmt.Printf("wrote %s with %d images\n", *out, len(entries))
+	return nil
+}
+
+var mdEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`)
+
+// mdEscape keeps text from being read as Markdown.
+func mdEscape(s string) string {
+	return mdEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
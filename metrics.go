@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// metricsHandler serves GET /metrics in the Prometheus text format. The
+// run counters come from stats.json, which every fetch run updates, so
+// they cover runs made by the daemon, cron or by hand alike. running may
+// be nil outside the daemon.
+func metricsHandler(lib *library, running func() bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := openUsage(lib.outDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cat, err := lib.current()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, u, cat, running)
+	}
+}
+
+func writeMetrics(w io.Writer, u *usageStats, cat *catalog, running func() bool) {
+	metric := func(name, typ, help string, v any) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, v)
+	}
+	t := u.totals()
+	metric("spotlightdl_runs_total", "counter", "Fetch runs started.", u.Runs)
+	metric("spotlightdl_runs_succeeded_total", "counter", "Fetch runs that finished without a fatal error.", u.Successes)
+	metric("spotlightdl_api_calls_total", "counter", "Requests to source APIs.", t.APICalls)
+	metric("spotlightdl_errors_total", "counter", "Failed API calls and downloads.", t.Errors)
+	metric("spotlightdl_downloads_total", "counter", "Images downloaded.", t.Images)
+	metric("spotlightdl_downloaded_bytes_total", "counter", "Bytes of images downloaded.", t.Bytes)
+	metric("spotlightdl_dedup_hits_total", "counter", "Images skipped because the library already had them.", t.Deduped)
+	metric("spotlightdl_dedup_bytes_total", "counter", "Bytes not downloaded thanks to deduplication.", t.DedupedBytes)
+
+	fmt.Fprintf(w, "# HELP spotlightdl_run_duration_seconds Duration of successful fetch runs.\n# TYPE spotlightdl_run_duration_seconds summary\n")
+	fmt.Fprintf(w, "spotlightdl_run_duration_seconds_sum %g\nspotlightdl_run_duration_seconds_count %d\n", u.Seconds, u.Successes)
+	if n := len(u.Recent); n > 0 {
+		last := u.Recent[n-1]
+		metric("spotlightdl_last_run_timestamp_seconds", "gauge", "Start of the most recent run.", last.Start.Unix())
+	}
+
+	var size int64
+	for _, e := range cat.Images {
+		size += e.Size
+	}
+	metric("spotlightdl_library_images", "gauge", "Images in the catalog.", len(cat.Images))
+	metric("spotlightdl_library_bytes", "gauge", "Total size of the cataloged images.", size)
+	if running != nil {
+		busy := 0
+		if running() {
+			busy = 1
+		}
+		metric("spotlightdl_fetch_running", "gauge", "1 while the daemon runs a fetch.", busy)
+	}
+}
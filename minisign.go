@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// minisignVerify checks a minisign signature file (legacy "Ed" or prehashed
+// "ED") and its trusted comment against a base64 public key as printed by
+// `minisign -G`. It returns the trusted comment.
+func minisignVerify(pubKey string, msg, sigFile []byte) (string, error) {
+	pk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(pubKey))
+	if err != nil || len(pk) != 2+8+ed25519.PublicKeySize || string(pk[:2]) != "Ed" {
+		return "", errors.New("minisign: invalid public key")
+	}
+	keyID, key := pk[2:10], ed25519.PublicKey(pk[10:])
+
+	lines := strings.Split(strings.ReplaceAll(string(sigFile), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return "", errors.New("minisign: malformed signature file")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return "", errors.New("minisign: malformed signature")
+	}
+	if !bytes.Equal(sig[2:10], keyID) {
+		return "", errors.New("minisign: signed with a different key")
+	}
+
+	signed := msg
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b512(msg)
+		signed = sum[:]
+	default:
+		return "", errors.New("minisign: unknown signature algorithm")
+	}
+	if !ed25519.Verify(key, signed, sig[10:]) {
+		return "", errors.New("minisign: signature verification failed")
+	}
+
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(key, append(append([]byte{}, sig[10:]...), trusted...), global) {
+		return "", errors.New("minisign: trusted comment verification failed")
+	}
+	return trusted, nil
+}
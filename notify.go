@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notifier delivers a notification over one channel. Channels register a
+// factory in init, so the run loop only ever talks to a notifyRouter.
+type Notifier interface {
+	Notify(ctx context.Context, n notification) error
+}
+
+// notification is what a run reports. Event is one of notifyEvents.
+type notification struct {
+	Event   string    `json:"event"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Images  []string  `json:"images,omitempty"` // files downloaded
+}
+
+var notifyEvents = []string{"new-images", "run-failed", "portal"}
+
+// notifierConfig is a [channel.<name>] table from notify.toml.
+type notifierConfig struct {
+	Name   string
+	Table  map[string]any
+	Client *http.Client
+}
+
+var notifierRegistry = map[string]func(notifierConfig) (Notifier, error){}
+
+func registerNotifier(typ string, factory func(notifierConfig) (Notifier, error)) {
+	if _, dup := notifierRegistry[typ]; dup {
+		panic("notifier registered twice: " + typ)
+	}
+	notifierRegistry[typ] = factory
+}
+
+func init() {
+	registerNotifier("desktop", func(notifierConfig) (Notifier, error) { return desktopNotifier{}, nil })
+}
+
+// notifyRouter sends each event to the channels routed to it. A nil
+// router sends nothing.
+type notifyRouter struct {
+	channels map[string]Notifier
+	routes   map[string][]string
+	// errors are only worth a warning for channels the user configured
+	quiet bool
+}
+
+// defaultNotifyRouter is used without a notify.toml: only the captive
+// portal prompt goes to the desktop.
+func defaultNotifyRouter() *notifyRouter {
+	return &notifyRouter{
+		channels: map[string]Notifier{"desktop": desktopNotifier{}},
+		routes:   map[string][]string{"portal": {"desktop"}},
+		quiet:    true,
+	}
+}
+
+// loadNotifyRouter reads the routing config at path, or
+// .spotlightdl/notify.toml in outDir if path is empty.
+func loadNotifyRouter(path, outDir string, client *http.Client) (*notifyRouter, error) {
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join(stateDir(outDir), "notify.toml")
+	}
+	b, err := os.ReadFile(path)
+	if !explicit && errors.Is(err, os.ErrNotExist) {
+		return defaultNotifyRouter(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := parseNotifyConfig(string(b), client)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func parseNotifyConfig(src string, client *http.Client) (*notifyRouter, error) {
+	doc, err := parseTOML(src)
+	if err != nil {
+		return nil, err
+	}
+	r := &notifyRouter{channels: map[string]Notifier{}, routes: map[string][]string{}}
+	chans, err := tomlTableAt(doc, "channel")
+	if err != nil {
+		return nil, err
+	}
+	for name := range chans {
+		t, err := tomlTableAt(chans, name)
+		if err != nil {
+			return nil, err
+		}
+		typ, err := tomlString(t, "type")
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", name, err)
+		}
+		typ = firstNonEmpty(typ, name)
+		factory, ok := notifierRegistry[typ]
+		if !ok {
+			return nil, fmt.Errorf("channel %s: unknown type %q (available: %s)", name, typ, strings.Join(notifierTypes(), ", "))
+		}
+		n, err := factory(notifierConfig{Name: name, Table: t, Client: client})
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", name, err)
+		}
+		r.channels[name] = n
+	}
+	routes, err := tomlTableAt(doc, "route")
+	if err != nil {
+		return nil, err
+	}
+	for ev := range routes {
+		if !slices.Contains(notifyEvents, ev) {
+			return nil, fmt.Errorf("route: unknown event %q (want %s)", ev, strings.Join(notifyEvents, ", "))
+		}
+		names, err := tomlStrings(routes, ev)
+		if err != nil {
+			return nil, fmt.Errorf("route: %w", err)
+		}
+		for _, n := range names {
+			if _, ok := r.channels[n]; !ok {
+				return nil, fmt.Errorf("route %s: no channel named %q", ev, n)
+			}
+		}
+		r.routes[ev] = names
+	}
+	return r, nil
+}
+
+func notifierTypes() []string {
+	var types []string
+	for t := range notifierRegistry {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// send delivers n to every channel routed to its event. Channels are
+// tried one after another, each with its own timeout, and a failing
+// channel never fails the run.
+func (r *notifyRouter) send(ctx context.Context, n notification) {
+	if r == nil {
+		return
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now().UTC()
+	}
+	for _, name := range r.routes[n.Event] {
+		cctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		err := r.channels[name].Notify(cctx, n)
+		cancel()
+		if err != nil {
+			level := slog.LevelWarn
+			if r.quiet {
+				level = slog.LevelDebug
+			}
+			slog.Log(ctx, level, "notification failed", "channel", name, "event", n.Event, "err", err)
+		}
+	}
+}
+
+type desktopNotifier struct{}
+
+func (desktopNotifier) sandboxBlocked([]uint16) string { return "runs a command" }
+
+func (desktopNotifier) Notify(ctx context.Context, n notification) error {
+	return notifyDesktop(n.Title, n.Message)
+}
+
+// notifyDesktop shows a desktop notification using whatever the platform
+// ships: notify-send (D-Bus) on Linux/BSD, osascript on macOS and a
+// PowerShell toast on Windows.
+func notifyDesktop(title, msg string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := `display notification "` + appleScriptQuote(msg) + `" with title "` + appleScriptQuote(title) + `"`
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		// the texts travel in the environment: PowerShell knows more
+		// quote characters than anyone cares to escape
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript)
+		cmd.Env = append(os.Environ(), "SPOTLIGHTDL_TOAST_TITLE="+title, "SPOTLIGHTDL_TOAST_MESSAGE="+msg)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=spotlightdl", title, msg)
+	}
+	return cmd.Run()
+}
+
+func appleScriptQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+const windowsToastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$n = $t.GetElementsByTagName('text')
+$n.Item(0).AppendChild($t.CreateTextNode($env:SPOTLIGHTDL_TOAST_TITLE)) > $null
+$n.Item(1).AppendChild($t.CreateTextNode($env:SPOTLIGHTDL_TOAST_MESSAGE)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($t))`
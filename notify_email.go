@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerNotifier("email", newEmailNotifier)
+}
+
+// emailNotifier sends a plain-text mail through an SMTP relay, using
+// STARTTLS when the server offers it.
+type emailNotifier struct {
+	server   string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func newEmailNotifier(cfg notifierConfig) (Notifier, error) {
+	var n emailNotifier
+	var err error
+	if n.server, err = tomlString(cfg.Table, "smtp"); err != nil {
+		return nil, err
+	}
+	if n.from, err = tomlString(cfg.Table, "from"); err != nil {
+		return nil, err
+	}
+	if n.to, err = tomlStrings(cfg.Table, "to"); err != nil {
+		return nil, err
+	}
+	if n.username, err = tomlString(cfg.Table, "username"); err != nil {
+		return nil, err
+	}
+	passEnv, err := tomlString(cfg.Table, "password_env")
+	if err != nil {
+		return nil, err
+	}
+	if n.server == "" || n.from == "" || len(n.to) == 0 {
+		return nil, errors.New("smtp, from and to are required")
+	}
+	if _, _, err := net.SplitHostPort(n.server); err != nil {
+		n.server = net.JoinHostPort(n.server, "587")
+	}
+	if passEnv != "" {
+		n.password = os.Getenv(passEnv)
+	}
+	return &n, nil
+}
+
+func (m *emailNotifier) sandboxBlocked(ports []uint16) string {
+	return portBlocked(&url.URL{Scheme: "smtp", Host: m.server}, ports)
+}
+
+func (m *emailNotifier) Notify(ctx context.Context, n notification) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&b, "Subject: [spotlightdl] %s\r\n", n.Title)
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(n.Message + "\r\n")
+	for _, p := range n.Images {
+		b.WriteString(p + "\r\n")
+	}
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, _ := net.SplitHostPort(m.server)
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+	// net/smtp has no context support; run it aside so ctx still bounds the wait
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(m.server, auth, m.from, m.to, []byte(b.String())) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+)
+
+func init() {
+	registerNotifier("mqtt", newMQTTNotifier)
+}
+
+// mqttNotifier publishes the notification as JSON to a topic (MQTT 3.1.1,
+// QoS 0), connecting for each message. That is plenty for a handful of
+// events per run and needs no client library.
+type mqttNotifier struct {
+	broker   *url.URL
+	topic    string
+	username string
+	password string
+	retain   bool
+}
+
+func newMQTTNotifier(cfg notifierConfig) (Notifier, error) {
+	broker, err := tomlString(cfg.Table, "broker")
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("broker must be tcp://host:port or ssl://host:port, got %q", broker)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Host, "1883")
+		}
+	case "ssl", "tls", "mqtts":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Host, "8883")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	n := &mqttNotifier{broker: u}
+	if n.topic, err = tomlString(cfg.Table, "topic"); err != nil {
+		return nil, err
+	}
+	n.topic = firstNonEmpty(n.topic, "spotlightdl/events")
+	if n.username, err = tomlString(cfg.Table, "username"); err != nil {
+		return nil, err
+	}
+	if n.retain, err = tomlBool(cfg.Table, "retain"); err != nil {
+		return nil, err
+	}
+	passEnv, err := tomlString(cfg.Table, "password_env")
+	if err != nil {
+		return nil, err
+	}
+	if passEnv != "" {
+		n.password = os.Getenv(passEnv)
+	}
+	return n, nil
+}
+
+func (m *mqttNotifier) sandboxBlocked(ports []uint16) string { return portBlocked(m.broker, ports) }
+
+func (m *mqttNotifier) Notify(ctx context.Context, n notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.broker.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if m.broker.Scheme != "tcp" && m.broker.Scheme != "mqtt" {
+		tc := tls.Client(conn, &tls.Config{ServerName: m.broker.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		conn = tc
+	}
+
+	// CONNECT with a clean session
+	flags := byte(0x02)
+	body := append(mqttString("MQTT"), 4, 0, 0, 60)
+	body = append(body, mqttString(fmt.Sprintf("spotlightdl-%d", os.Getpid()))...)
+	if m.username != "" {
+		flags |= 0x80
+		body = append(body, mqttString(m.username)...)
+		if m.password != "" {
+			flags |= 0x40
+			body = append(body, mqttString(m.password)...)
+		}
+	}
+	body[7] = flags
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		return err
+	}
+	var ack [4]byte
+	if _, err := io.ReadFull(conn, ack[:]); err != nil {
+		return fmt.Errorf("mqtt: reading CONNACK: %w", err)
+	}
+	if ack[0] != 0x20 {
+		return errors.New("mqtt: unexpected reply to CONNECT")
+	}
+	if ack[3] != 0 {
+		return fmt.Errorf("mqtt: connection refused (code %d)", ack[3])
+	}
+
+	head := byte(0x30)
+	if m.retain {
+		head |= 0x01
+	}
+	if _, err := conn.Write(mqttPacket(head, append(mqttString(m.topic), payload...))); err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte{0xe0, 0}) // DISCONNECT
+	return err
+}
+
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttPacket prepends the fixed header with its variable-length size.
+func mqttPacket(head byte, body []byte) []byte {
+	out := []byte{head}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
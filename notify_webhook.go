@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+func init() {
+	registerNotifier("webhook", newWebhookNotifier)
+}
+
+// webhookNotifier POSTs the notification as JSON, e.g. to Home Assistant,
+// ntfy or a chat integration.
+type webhookNotifier struct {
+	url    string
+	header map[string]string
+	client *http.Client
+}
+
+func newWebhookNotifier(cfg notifierConfig) (Notifier, error) {
+	url, err := tomlString(cfg.Table, "url")
+	if err != nil {
+		return nil, err
+	}
+	if url == "" {
+		return nil, errors.New("url is required")
+	}
+	n := &webhookNotifier{url: url, header: map[string]string{}, client: cfg.Client}
+	// a secret is named by its environment variable, never written into the file
+	tokenEnv, err := tomlString(cfg.Table, "token_env")
+	if err != nil {
+		return nil, err
+	}
+	if tokenEnv != "" {
+		n.header["Authorization"] = "Bearer " + os.Getenv(tokenEnv)
+	}
+	if n.client == nil {
+		n.client = http.DefaultClient
+	}
+	return n, nil
+}
+
+func (w *webhookNotifier) sandboxBlocked(ports []uint16) string {
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return ""
+	}
+	return portBlocked(u, ports)
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.header {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
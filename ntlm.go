@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLMv2 client (MS-NLMP) for proxies that demand NTLM but where no SSPI is
+// available, i.e. everywhere except Windows. Only the parts needed for a
+// CONNECT handshake are implemented: no signing, sealing or MIC.
+
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmNegotiateOEM             = 0x00000002
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+	ntlmNegotiateTargetInfo      = 0x00800000
+	ntlmNegotiate128             = 0x20000000
+	ntlmNegotiate56              = 0x80000000
+
+	ntlmAvEOL       = 0
+	ntlmAvTimestamp = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+type ntlmAuth struct {
+	schemeName string
+	user       string
+	domain     string
+	password   string
+	sent       bool
+}
+
+// newNTLMAuth accepts "DOMAIN\user" or "user@domain" style account names.
+func newNTLMAuth(scheme, account, password string) *ntlmAuth {
+	a := &ntlmAuth{schemeName: scheme, user: account, password: password}
+	if i := strings.IndexByte(account, '\\'); i >= 0 {
+		a.domain, a.user = account[:i], account[i+1:]
+	} else if i := strings.LastIndexByte(account, '@'); i >= 0 {
+		a.user, a.domain = account[:i], account[i+1:]
+	}
+	return a
+}
+
+func (a *ntlmAuth) scheme() string { return a.schemeName }
+
+func (a *ntlmAuth) step(challenge []byte) ([]byte, error) {
+	if !a.sent {
+		a.sent = true
+		return ntlmNegotiateMessage(), nil
+	}
+	return a.authenticate(challenge)
+}
+
+func ntlmNegotiateMessage() []byte {
+	flags := uint32(ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSession | ntlmNegotiateTargetInfo |
+		ntlmNegotiate128 | ntlmNegotiate56)
+	b := make([]byte, 32)
+	copy(b, ntlmSignature)
+	binary.LittleEndian.PutUint32(b[8:], 1)
+	binary.LittleEndian.PutUint32(b[12:], flags)
+	// empty domain and workstation security buffers, pointing at the end
+	binary.LittleEndian.PutUint32(b[20:], 32)
+	binary.LittleEndian.PutUint32(b[28:], 32)
+	return b
+}
+
+func (a *ntlmAuth) authenticate(msg []byte) ([]byte, error) {
+	if len(msg) < 48 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("ntlm: malformed challenge")
+	}
+	flags := binary.LittleEndian.Uint32(msg[20:])
+	serverChallenge := msg[24:32]
+	targetInfo, err := ntlmSecBuffer(msg, 40)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := ntlmAvPair(targetInfo, ntlmAvTimestamp)
+	if timestamp == nil {
+		timestamp = binary.LittleEndian.AppendUint64(nil, ntlmFiletime(time.Now()))
+	}
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	ntowf := ntowfv2(a.user, a.domain, a.password)
+	ntResp, lmResp := ntlmv2Responses(ntowf, serverChallenge, clientChallenge, timestamp, targetInfo)
+
+	domain := utf16le(a.domain)
+	user := utf16le(a.user)
+	const header = 64
+	payload := [][]byte{lmResp, ntResp, domain, user, nil, nil}
+
+	out := make([]byte, header)
+	copy(out, ntlmSignature)
+	binary.LittleEndian.PutUint32(out[8:], 3)
+	offset := header
+	for i, p := range payload {
+		pos := 12 + i*8
+		binary.LittleEndian.PutUint16(out[pos:], uint16(len(p)))
+		binary.LittleEndian.PutUint16(out[pos+2:], uint16(len(p)))
+		binary.LittleEndian.PutUint32(out[pos+4:], uint32(offset))
+		offset += len(p)
+	}
+	binary.LittleEndian.PutUint32(out[60:], flags&^ntlmNegotiateOEM|ntlmNegotiateUnicode)
+	for _, p := range payload {
+		out = append(out, p...)
+	}
+	return out, nil
+}
+
+// ntowfv2 is the NTLMv2 key of an account (MS-NLMP 3.3.2).
+func ntowfv2(user, domain, password string) []byte {
+	ntHash := md4Sum(utf16le(password))
+	return hmacMD5(ntHash[:], utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Responses computes the NTLMv2 and LMv2 responses to a server
+// challenge (MS-NLMP 3.3.2).
+func ntlmv2Responses(ntowf, serverChallenge, clientChallenge, timestamp, targetInfo []byte) (nt, lm []byte) {
+	var temp []byte
+	temp = append(temp, 1, 1, 0, 0, 0, 0, 0, 0)
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	proof := hmacMD5(ntowf, append(append([]byte{}, serverChallenge...), temp...))
+	nt = append(proof, temp...)
+	lm = append(hmacMD5(ntowf, append(append([]byte{}, serverChallenge...), clientChallenge...)), clientChallenge...)
+	return nt, lm
+}
+
+func ntlmSecBuffer(msg []byte, pos int) ([]byte, error) {
+	n := int(binary.LittleEndian.Uint16(msg[pos:]))
+	off := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+	if off+n > len(msg) {
+		return nil, errors.New("ntlm: security buffer out of range")
+	}
+	return msg[off : off+n], nil
+}
+
+func ntlmAvPair(info []byte, id uint16) []byte {
+	for len(info) >= 4 {
+		avID := binary.LittleEndian.Uint16(info)
+		n := int(binary.LittleEndian.Uint16(info[2:]))
+		if avID == ntlmAvEOL || 4+n > len(info) {
+			return nil
+		}
+		if avID == id {
+			return info[4 : 4+n]
+		}
+		info = info[4+n:]
+	}
+	return nil
+}
+
+// ntlmFiletime converts t to 100ns ticks since 1601-01-01.
+func ntlmFiletime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func hmacMD5(key, data []byte) []byte {
+	m := hmac.New(md5.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
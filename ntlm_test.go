@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The NTLMv2 example of MS-NLMP 4.2.4.
+var (
+	ntlmTestServerChallenge = unhex("0123456789abcdef")
+	ntlmTestClientChallenge = unhex("aaaaaaaaaaaaaaaa")
+	ntlmTestTime            = make([]byte, 8)
+	ntlmTestTargetInfo      = unhex("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestNTOWF(t *testing.T) {
+	if got := md4Sum(utf16le("Password")); hex.EncodeToString(got[:]) != "a4f49c406510bdcab6824ee7c30fd852" {
+		t.Errorf("NTOWFv1 = %x", got)
+	}
+	if got := ntowfv2("User", "Domain", "Password"); hex.EncodeToString(got) != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("NTOWFv2 = %x", got)
+	}
+}
+
+func TestNTLMv2Responses(t *testing.T) {
+	nt, lm := ntlmv2Responses(ntowfv2("User", "Domain", "Password"),
+		ntlmTestServerChallenge, ntlmTestClientChallenge, ntlmTestTime, ntlmTestTargetInfo)
+	if got, want := hex.EncodeToString(lm), "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa"; got != want {
+		t.Errorf("LMv2 = %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(nt[:16]), "68cd0ab851e51c96aabc927bebef6a1c"; got != want {
+		t.Errorf("NTProofStr = %s, want %s", got, want)
+	}
+	temp := "0101000000000000" + "0000000000000000" + "aaaaaaaaaaaaaaaa" + "00000000" + hex.EncodeToString(ntlmTestTargetInfo) + "00000000"
+	if got := hex.EncodeToString(nt[16:]); got != temp {
+		t.Errorf("NTLMv2 blob = %s, want %s", got, temp)
+	}
+}
+
+func TestNewNTLMAuth(t *testing.T) {
+	tests := []struct{ account, user, domain string }{
+		{`CORP\alice`, "alice", "CORP"},
+		{"alice@corp.example.com", "alice", "corp.example.com"},
+		{"alice", "alice", ""},
+	}
+	for _, tt := range tests {
+		a := newNTLMAuth("NTLM", tt.account, "pw")
+		if a.user != tt.user || a.domain != tt.domain {
+			t.Errorf("%q: user %q, domain %q; want %q, %q", tt.account, a.user, a.domain, tt.user, tt.domain)
+		}
+	}
+}
+
+func TestNTLMHandshake(t *testing.T) {
+	a := newNTLMAuth("NTLM", `Domain\User`, "Password")
+	neg, err := a.step(nil)
+	if err != nil || !bytes.HasPrefix(neg, ntlmSignature) || binary.LittleEndian.Uint32(neg[8:]) != 1 {
+		t.Fatalf("negotiate = %x, %v", neg, err)
+	}
+
+	// a challenge (type 2) carrying the example's target info
+	challenge := make([]byte, 48)
+	copy(challenge, ntlmSignature)
+	binary.LittleEndian.PutUint32(challenge[8:], 2)
+	binary.LittleEndian.PutUint32(challenge[20:], ntlmNegotiateUnicode|ntlmNegotiateNTLM|ntlmNegotiateTargetInfo)
+	copy(challenge[24:], ntlmTestServerChallenge)
+	binary.LittleEndian.PutUint16(challenge[40:], uint16(len(ntlmTestTargetInfo)))
+	binary.LittleEndian.PutUint16(challenge[42:], uint16(len(ntlmTestTargetInfo)))
+	binary.LittleEndian.PutUint32(challenge[44:], 48)
+	challenge = append(challenge, ntlmTestTargetInfo...)
+
+	msg, err := a.step(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(msg[8:]) != 3 {
+		t.Fatalf("message type %d, want 3", binary.LittleEndian.Uint32(msg[8:]))
+	}
+	field := func(i int) []byte {
+		b, err := ntlmSecBuffer(msg, 12+i*8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	if d, u := field(2), field(3); !bytes.Equal(d, utf16le("Domain")) || !bytes.Equal(u, utf16le("User")) {
+		t.Errorf("domain %x, user %x", d, u)
+	}
+	// the response is the one of the example but for the client challenge
+	// and time, which the blob carries
+	nt := field(1)
+	blob := nt[16:]
+	wantNT, _ := ntlmv2Responses(ntowfv2("User", "Domain", "Password"), ntlmTestServerChallenge, blob[16:24], blob[8:16], ntlmTestTargetInfo)
+	if !bytes.Equal(nt, wantNT) {
+		t.Errorf("NTLMv2 response %x, want %x", nt, wantNT)
+	}
+
+	if _, err := a.step([]byte(strings.Repeat("x", 10))); err == nil {
+		t.Error("a malformed challenge was accepted")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// -store objects keeps each image once, under its hash, as
+// objects/ab/ab12...ef.jpg, so that the same picture cannot be stored
+// twice whatever its name or source. What people browse are the symbolic
+// links in by-title/ and by-date/YYYY/MM/, which the end of every run
+// makes match the catalog again: links to deleted images go, renamed
+// titles follow.
+
+const objectsDir = "objects"
+
+var objectLinkDirs = []string{"by-title", "by-date"}
+
+// storeObject moves a download from path to its place under objects/ and
+// returns that.
+func storeObject(outDir, p, sum string) (string, error) {
+	ext := strings.ToLower(cmp.Or(filepath.Ext(p), ".jpg"))
+	dst := filepath.Join(outDir, objectsDir, sum[:2], sum+ext)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	// an object already there has the same bytes, by its name
+	if err := os.Rename(p, dst); err != nil {
+		return "", err
+	}
+	removeEmptyDirs(outDir, filepath.Dir(p))
+	return dst, nil
+}
+
+// objectLinks returns the links the catalog asks for, each link's
+// slash-separated path in the library mapped to the object it points to.
+// Images of the same title or day are told apart as uniquePath does, in
+// the order they were added, so that names only shift when one goes.
+func objectLinks(cat *catalog) map[string]string {
+	entries := slices.Clone(cat.Images)
+	slices.SortStableFunc(entries, func(a, b *catalogEntry) int { return a.Added.Compare(b.Added) })
+	links := make(map[string]string)
+	add := func(dir, name, target string) {
+		ext := path.Ext(target)
+		p := path.Join(dir, name+ext)
+		for n := 2; links[p] != ""; n++ {
+			p = path.Join(dir, fmt.Sprintf("%s (%d)%s", name, n, ext))
+		}
+		links[p] = target
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Path, objectsDir+"/") {
+			continue
+		}
+		// untitled objects go by the start of their hash, or whatever
+		// name a file dropped into objects/ by hand has
+		stem := strings.TrimSuffix(path.Base(e.Path), path.Ext(e.Path))
+		if len(stem) > 12 {
+			stem = strings.ToValidUTF8(stem[:12], "")
+		}
+		title := safeName(cmp.Or(e.Title, stem))
+		d := imageDate(e)
+		add("by-title", title, e.Path)
+		add(path.Join("by-date", d.Format("2006"), d.Format("01")), d.Format("2006-01-02")+" "+title, e.Path)
+	}
+	return links
+}
+
+// linkObjects makes by-title/ and by-date/ match the catalog.
+func linkObjects(outDir string, cat *catalog) error {
+	want := objectLinks(cat)
+	for _, dir := range objectLinkDirs {
+		root := filepath.Join(outDir, dir)
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			rel, _ := filepath.Rel(outDir, p)
+			target, err := os.Readlink(p)
+			if want[filepath.ToSlash(rel)] != "" && err == nil && target == linkTarget(rel, want[filepath.ToSlash(rel)]) {
+				delete(want, filepath.ToSlash(rel))
+				return nil
+			}
+			os.Remove(p)
+			removeEmptyDirs(root, filepath.Dir(p))
+			return nil
+		})
+		os.Remove(root) // if empty
+	}
+	var errs []error
+	for rel, obj := range want {
+		p := filepath.Join(outDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.Symlink(linkTarget(filepath.FromSlash(rel), obj), p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		// Windows only lets administrators and Developer Mode make them
+		return fmt.Errorf("%d of %d links failed, first: %w", len(errs), len(want), errs[0])
+	}
+	return nil
+}
+
+// linkTarget is the relative path from the link at rel to obj, both
+// inside the library, so that the library can move as a whole.
+func linkTarget(rel, obj string) string {
+	t, err := filepath.Rel(filepath.Dir(rel), filepath.FromSlash(obj))
+	if err != nil {
+		return filepath.FromSlash(obj)
+	}
+	return t
+}
+
+func checkStore(store string) error {
+	if store != "" && store != "objects" {
+		return fmt.Errorf("-store: unknown %q (want objects)", store)
+	}
+	return nil
+}
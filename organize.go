@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// -organize sorts new downloads into subfolders instead of dropping them
+// all into outdir: with date, 2025/03/ by the publish date (or the
+// download date for sources that have none, or with -organize-date
+// downloaded); with locale, DE/ by the market the image came from; with
+// photographer, by who took it. Levels nest in the order given. -name
+// renames the files themselves after a template. The catalog knows where
+// every image went, so an image is still only downloaded once whatever
+// folder or name it would get today. With locale, a picture that several
+// markets offer is still stored once, and hard-linked into the folders of
+// the others.
+
+var organizeLevels = []string{"date", "locale", "photographer"}
+
+// namePlaceholders are what a -name template can use.
+var namePlaceholders = []string{"name", "title", "photographer", "date", "locale", "source"}
+
+type organizeScheme struct {
+	levels []string
+	byDate string // published or downloaded
+	name   string // file name template, "" keeps the source's names
+}
+
+func parseOrganize(spec, byDate, name string) (*organizeScheme, error) {
+	s := &organizeScheme{byDate: byDate, name: name}
+	for _, level := range splitList(spec) {
+		if !slices.Contains(organizeLevels, level) {
+			return nil, fmt.Errorf("unknown -organize level %q (want %s)", level, strings.Join(organizeLevels, ", "))
+		}
+		s.levels = append(s.levels, level)
+	}
+	if byDate != "published" && byDate != "downloaded" {
+		return nil, fmt.Errorf("unknown -organize-date %q (want published or downloaded)", byDate)
+	}
+	if name != "" {
+		var bad error
+		nameTemplate.ReplaceAllStringFunc(name, func(m string) string {
+			if !slices.Contains(namePlaceholders, m[1:len(m)-1]) && bad == nil {
+				bad = fmt.Errorf("-name: unknown placeholder %s (want {%s})", m, strings.Join(namePlaceholders, "}, {"))
+			}
+			return m
+		})
+		if bad != nil {
+			return nil, bad
+		}
+		if !strings.Contains(name, "{name}") && !strings.Contains(name, "{title}") {
+			return nil, errors.New("-name: the template needs {name} or {title}, or images would overwrite each other")
+		}
+	}
+	return s, nil
+}
+
+var nameTemplate = regexp.MustCompile(`\{[a-z]+\}`)
+
+func (s *organizeScheme) date(im spotImage, now time.Time) time.Time {
+	if s.byDate == "published" && !im.Published.IsZero() {
+		return im.Published
+	}
+	return now
+}
+
+// renames reports whether file names come from a -name template rather
+// than the source, so that two images may end up with the same one.
+func (s *organizeScheme) renames() bool { return s.name != "" }
+
+// uniquePath returns p, or p with " (2)", " (3)" ... before the extension
+// if that is taken.
+func uniquePath(p string) string {
+	ext := filepath.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for n := 2; exists(p); n++ {
+		p = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	return p
+}
+
+// fileName applies the -name template to the source's file name.
+func (s *organizeScheme) fileName(im spotImage, name string, now time.Time) string {
+	if s.name == "" {
+		return name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	out := nameTemplate.ReplaceAllStringFunc(s.name, func(m string) string {
+		switch m {
+		case "{name}":
+			return base
+		case "{title}":
+			return firstNonEmpty(im.Title, base)
+		case "{photographer}":
+			return firstNonEmpty(photographer(im.Author, im.Copyright), "unknown")
+		case "{date}":
+			return s.date(im, now).Format("2006-01-02")
+		case "{locale}":
+			return firstNonEmpty(im.Locale, "global")
+		case "{source}":
+			return im.Source
+		}
+		return m
+	})
+	return safeName(out) + ext
+}
+
+// dir returns the slash-separated folder for an image, "" for the top
+// level.
+func (s *organizeScheme) dir(im spotImage, now time.Time) string {
+	var parts []string
+	for _, level := range s.levels {
+		switch level {
+		case "date":
+			t := s.date(im, now)
+			parts = append(parts, t.Format("2006"), t.Format("01"))
+		case "locale":
+			parts = append(parts, localeFolder(im.Locale))
+		case "photographer":
+			parts = append(parts, safeName(firstNonEmpty(photographer(im.Author, im.Copyright), "unknown")))
+		}
+	}
+	return path.Join(parts...)
+}
+
+// localeFolder is the country of a locale like de-DE, the locale itself
+// without one, and "global" for sources that are not per market.
+func localeFolder(locale string) string {
+	if locale == "" {
+		return "global"
+	}
+	if _, country, ok := strings.Cut(locale, "-"); ok && country != "" {
+		return strings.ToUpper(country)
+	}
+	return locale
+}
+
+// addLocale notes that an image was also offered in locale.
+func addLocale(e *catalogEntry, locale string) {
+	if locale != "" && !slices.Contains(e.Locales, locale) {
+		e.Locales = append(e.Locales, locale)
+	}
+}
+
+// byLocale reports whether images are sorted into folders by market.
+func (s *organizeScheme) byLocale() bool { return slices.Contains(s.levels, "locale") }
+
+// linkCopy puts the image of e at p as well, a hard link in another
+// market's folder that takes no space of its own, and notes it on e. It
+// reports whether it could; across file systems, or on ones without hard
+// links, it cannot.
+func linkCopy(outDir string, e *catalogEntry, p string) bool {
+	rel, err := filepath.Rel(outDir, p)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return false
+	}
+	if err := os.Link(filepath.Join(outDir, filepath.FromSlash(e.Path)), p); err != nil {
+		removeEmptyDirs(outDir, filepath.Dir(p))
+		return false
+	}
+	if !slices.Contains(e.Links, rel) {
+		e.Links = append(e.Links, rel)
+	}
+	return true
+}
+
+// linkedPaths are the slash-separated paths of all hard links the
+// catalog notes, which are no images of their own.
+func (c *catalog) linkedPaths() map[string]bool {
+	linked := make(map[string]bool)
+	for _, e := range c.Images {
+		for _, rel := range e.Links {
+			linked[rel] = true
+		}
+	}
+	return linked
+}
+
+// staleLink returns the first of e's hard links that is a file of its own
+// by now, or "": replacing the image's file, as a download does, leaves
+// the links on the old one.
+func staleLink(outDir string, e *catalogEntry) string {
+	fi, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return ""
+	}
+	for _, rel := range e.Links {
+		li, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(rel)))
+		if err == nil && !os.SameFile(fi, li) {
+			return rel
+		}
+	}
+	return ""
+}
+
+// relink points e's hard links at its file again.
+func relink(outDir string, e *catalogEntry) {
+	links := e.Links
+	e.Links = nil
+	for _, rel := range links {
+		p := filepath.Join(outDir, filepath.FromSlash(rel))
+		os.Remove(p)
+		linkCopy(outDir, e, p)
+	}
+}
+
+// removeLinks deletes the hard links of e.
+func removeLinks(outDir string, e *catalogEntry) {
+	for _, rel := range e.Links {
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			continue
+		}
+		p := filepath.Join(outDir, filepath.FromSlash(rel))
+		os.Remove(p)
+		removeEmptyDirs(outDir, filepath.Dir(p))
+	}
+	e.Links = nil
+}
+
+// removeEmptyDirs removes dir and its parents up to outDir for as long as
+// they are empty.
+func removeEmptyDirs(outDir, dir string) {
+	for {
+		rel, err := filepath.Rel(outDir, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// photoAgencies are credits that name no photographer on their own.
+var photoAgencies = []string{
+	"getty images", "istock", "shutterstock", "alamy", "alamy stock photo", "adobe stock",
+	"offset", "flickr", "masterfile", "superstock", "age fotostock", "design pics",
+	"minden pictures", "nature picture library", "naturepl.com", "westend61", "robertharding",
+	"awl images", "danita delimont", "cavan images", "tandem stills + motion",
+	"amazing aerial agency", "stocksy", "500px", "unsplash", "wikimedia commons",
+}
+
+// photographer extracts the photographer from an image's credit: the
+// source's author field if it has one, otherwise the copyright line, as
+// in "© Jane Doe/Getty Images" or "Photo by Jane Doe on Unsplash". It is
+// "" when the line names only an agency.
+func photographer(author, copyright string) string {
+	if a := strings.TrimSpace(author); a != "" {
+		return a
+	}
+	c := strings.TrimSpace(copyright)
+	if rest, ok := strings.CutPrefix(c, "Photo by "); ok {
+		c, _, _ = strings.Cut(rest, " on ")
+	}
+	for _, p := range []string{"©", "(c)", "(C)", "Copyright", "copyright"} {
+		c = strings.TrimSpace(strings.TrimPrefix(c, p))
+	}
+	c, _, _ = strings.Cut(c, "/")
+	c = strings.TrimSpace(c)
+	if slices.Contains(photoAgencies, strings.ToLower(c)) {
+		return ""
+	}
+	return c
+}
+
+// safeName makes s usable as one path element on every platform.
+func safeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, " .")
+	if len(s) > 120 {
+		s = strings.ToValidUTF8(s[:120], "")
+	}
+	if s == "" {
+		return "_"
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"slices"
+)
+
+// pHash computes the classic 64-bit DCT perceptual hash: 32x32 luma,
+// 2D DCT, then one bit per low-frequency coefficient above the median.
+func pHash(path string) (uint64, error) {
+	img, err := decodeImage(path)
+	if err != nil {
+		return 0, err
+	}
+	return pHashImage(img), nil
+}
+
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+func pHashImage(img image.Image) uint64 {
+	const n = 32
+	var px [n][n]float64
+	lumaGrid(img, &px)
+
+	var dct [n][n]float64
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				for y := 0; y < n; y++ {
+					sum += px[x][y] *
+						math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*n)) *
+						math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*n))
+				}
+			}
+			dct[u][v] = sum
+		}
+	}
+
+	var coeffs []float64
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			coeffs = append(coeffs, dct[u][v])
+		}
+	}
+	// the DC term only reflects overall brightness
+	sorted := slices.Clone(coeffs[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var h uint64
+	for i, c := range coeffs {
+		if c > median {
+			h |= 1 << uint(63-i)
+		}
+	}
+	return h
+}
+
+// lumaGrid box-downsamples img into a 32x32 grid of luma values.
+func lumaGrid(img image.Image, out *[32][32]float64) {
+	const n = 32
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var count [n][n]float64
+	if yc, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < h; y++ {
+			row := yc.Y[y*yc.YStride:]
+			gy := y * n / h
+			for x := 0; x < w; x++ {
+				gx := x * n / w
+				out[gx][gy] += float64(row[x])
+				count[gx][gy]++
+			}
+		}
+	} else {
+		for y := 0; y < h; y++ {
+			gy := y * n / h
+			for x := 0; x < w; x++ {
+				gx := x * n / w
+				r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				out[gx][gy] += (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 257
+				count[gx][gy]++
+			}
+		}
+	}
+	for x := range out {
+		for y := range out[x] {
+			if count[x][y] > 0 {
+				out[x][y] /= count[x][y]
+			}
+		}
+	}
+}
+
+func formatPHash(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// `export photoprism` lays the library out as a PhotoPrism originals
+// folder: the images by year and month, as PhotoPrism's own import does,
+// each with an XMP sidecar and, in the .photoprism folder beside it, the
+// YAML sidecar PhotoPrism keeps its metadata in. Indexing the folder then
+// picks up titles, descriptions, credits, keywords and dates without
+// anything to edit by hand.
+
+func exportPhotoPrism(args []string) error {
+	flags := flag.NewFlagSet("export photoprism", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	out := flags.String("o", "", "originals directory to write to (required), e.g. photoprism/originals/Spotlight")
+	link := flags.Bool("link", false, "hard-link the images instead of copying them, where the file system allows")
+	sel := addSelectionFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl export photoprism [flags] -o <dir>")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *out == "" {
+		flags.Usage()
+		return errors.New("export photoprism: need -o")
+	}
+	if lib, err := filepath.Abs(*outDir); err == nil {
+		if dst, err := filepath.Abs(*out); err == nil {
+			if rel, err := filepath.Rel(lib, dst); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("export photoprism: %s is inside the library; write the export somewhere else", *out)
+			}
+		}
+	}
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	var exported, copied int
+	for _, e := range sel.entries(cat) {
+		src := filepath.Join(*outDir, filepath.FromSlash(e.Path))
+		if !exists(src) {
+			fmt.Printf("%s: missing, left out\n", e.Path)
+			continue
+		}
+		// images of the same name in one month are told apart by hash
+		name := path.Base(e.Path)
+		rel := filepath.Join(imageDate(e).Format("2006"), imageDate(e).Format("01"), name)
+		if keep[filepath.Join(*out, rel)] {
+			ext := path.Ext(name)
+			rel = filepath.Join(filepath.Dir(rel), strings.TrimSuffix(name, ext)+"-"+e.SHA256[:8]+ext)
+		}
+		dst := filepath.Join(*out, rel)
+		yml := filepath.Join(filepath.Dir(dst), ".photoprism", strings.TrimSuffix(filepath.Base(dst), filepath.Ext(dst))+".yml")
+		keep[dst], keep[xmpSidecarPath(dst)], keep[yml] = true, true, true
+
+		if fresh, err := exportFile(src, dst, *link); err != nil {
+			return fmt.Errorf("export photoprism: %w", err)
+		} else if fresh {
+			copied++
+		}
+		for p, b := range map[string][]byte{xmpSidecarPath(dst): xmpDocument(e), yml: photoPrismYAML(e)} {
+			if err := writeIfChanged(p, b); err != nil {
+				return fmt.Errorf("export photoprism: %w", err)
+			}
+		}
+		exported++
+	}
+
+	// only what an earlier export wrote goes, as the folder may hold
+	// other originals
+	listPath := filepath.Join(*out, ".spotlightdl-export")
+	var removed int
+	if old, err := os.ReadFile(listPath); err == nil {
+		for _, rel := range strings.Split(strings.TrimSpace(string(old)), "\n") {
+			p := filepath.Join(*out, filepath.FromSlash(rel))
+			if rel != "" && !keep[p] && os.Remove(p) == nil {
+				removeEmptyDirs(*out, filepath.Dir(p))
+				removed++
+			}
+		}
+	}
+	var list []string
+	for p := range keep {
+		if rel, err := filepath.Rel(*out, p); err == nil {
+			list = append(list, filepath.ToSlash(rel))
+		}
+	}
+	slices.Sort(list)
+	if err := writeFileAtomic(listPath, []byte(strings.Join(list, "\n")+"\n")); err != nil {
+		return fmt.Errorf("export photoprism: %w", err)
+	}
+	fmt.Printf("exported %d images to %s (%d new, %d files removed)\n", exported, *out, copied, removed)
+	return nil
+}
+
+// writeIfChanged leaves a file that already says b alone, so that its
+// modification time does not make an indexer look at it again.
+func writeIfChanged(p string, b []byte) error {
+	if old, err := os.ReadFile(p); err == nil && bytes.Equal(old, b) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(p, b)
+}
+
+// photoPrismYAML is the YAML sidecar PhotoPrism backs its metadata up to
+// and reads back when indexing. Values are JSON strings, which YAML takes
+// as double-quoted scalars.
+func photoPrismYAML(e *catalogEntry) []byte {
+	var b, details strings.Builder
+	field := func(b *strings.Builder, indent, name, value string) {
+		if value != "" {
+			q, _ := json.Marshal(value)
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, q)
+			fmt.Fprintf(b, "%s%sSrc: meta\n", indent, name)
+		}
+	}
+	kind := "image"
+	if strings.HasPrefix(imageMIME(e.Path), "video/") {
+		kind = "video"
+	}
+	fmt.Fprintf(&b, "TakenAt: %s\nTakenSrc: meta\nType: %s\n", imageDate(e).UTC().Format("2006-01-02T15:04:05Z"), kind)
+	field(&b, "", "Title", e.Title)
+	field(&b, "", "Description", e.Description)
+	if e.Favorite {
+		b.WriteString("Favorite: true\n")
+	}
+	field(&details, "  ", "Keywords", strings.Join(e.Tags, ", "))
+	field(&details, "  ", "Notes", e.Location)
+	field(&details, "  ", "Copyright", e.Copyright)
+	if details.Len() > 0 {
+		b.WriteString("Details:\n" + details.String())
+	}
+	return []byte(b.String())
+}
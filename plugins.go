@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Plugins are executables in the plugins directory ($SPOTLIGHTDL_PLUGINS,
+// else plugins in the config directory) named spotlightdl-source-<name>
+// or spotlightdl-filter-<name>. A source plugin is picked with -source
+// like a built-in source, a filter plugin with -filter-plugins. Each call
+// starts the plugin with a verb as its only argument, writes one JSON
+// object to its stdin and reads one from its stdout; stderr is passed
+// through for logs. The objects are versioned by "protocol", and
+// pluginProtocol only changes when they change incompatibly; fields may
+// be added without. The README documents them for plugin authors.
+
+const pluginProtocol = 1
+
+const (
+	pluginSourceTimeout = 2 * time.Minute
+	pluginPrefix        = "spotlightdl-"
+)
+
+func init() {
+	registerCommand("plugins", cmdPlugins)
+}
+
+func pluginDir() string {
+	if dir := os.Getenv("SPOTLIGHTDL_PLUGINS"); dir != "" {
+		return expandHome(dir)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "spotlightdl", "plugins")
+	}
+	return ""
+}
+
+// plugin is an executable found in the plugins directory.
+type plugin struct {
+	Kind string // source or filter
+	Name string
+	Path string
+}
+
+// findPlugins lists the plugins of a kind, or of every kind for "".
+func findPlugins(kind string) []plugin {
+	dir := pluginDir()
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var found []plugin
+	for _, d := range entries {
+		name := d.Name()
+		if runtime.GOOS == "windows" {
+			ext := strings.ToLower(filepath.Ext(name))
+			if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+				continue
+			}
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		rest, ok := strings.CutPrefix(name, pluginPrefix)
+		if !ok {
+			continue
+		}
+		k, n, ok := strings.Cut(rest, "-")
+		if !ok || n == "" || (k != "source" && k != "filter") || (kind != "" && k != kind) {
+			continue
+		}
+		if fi, err := d.Info(); err != nil || fi.IsDir() || (runtime.GOOS != "windows" && fi.Mode()&0o111 == 0) {
+			continue
+		}
+		found = append(found, plugin{Kind: k, Name: strings.ToLower(n), Path: filepath.Join(dir, d.Name())})
+	}
+	return found
+}
+
+func findPlugin(kind, name string) (plugin, bool) {
+	plugins := findPlugins(kind)
+	i := slices.IndexFunc(plugins, func(p plugin) bool { return p.Name == name })
+	if i < 0 {
+		return plugin{}, false
+	}
+	return plugins[i], true
+}
+
+// call runs the plugin with verb, sending in and decoding its answer into
+// out.
+func (p plugin) call(ctx context.Context, verb string, in, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, p.Path, verb)
+	cmd.Stdin = bytes.NewReader(append(b, '\n'))
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %s: %w", p.Name, verb, err)
+	}
+	if err := json.Unmarshal(stdout, out); err != nil {
+		return fmt.Errorf("plugin %s: %s: bad answer: %w", p.Name, verb, err)
+	}
+	return nil
+}
+
+// pluginSourceRequest is what a source plugin gets for "fetch".
+type pluginSourceRequest struct {
+	Protocol int    `json:"protocol"`
+	Locale   string `json:"locale,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Round    int    `json:"round"` // 1 for the first fetch of a run
+}
+
+// pluginSourceResponse is a source plugin's answer: a batch of images,
+// and whether it has nothing more for this run.
+type pluginSourceResponse struct {
+	Protocol int           `json:"protocol"`
+	Images   []pluginImage `json:"images"`
+	Done     bool          `json:"done,omitempty"`
+}
+
+// pluginSource is a Source backed by a source plugin.
+type pluginSource struct {
+	p       plugin
+	locale  string
+	country string
+	round   int
+	done    bool
+}
+
+func newPluginSource(p plugin, cfg sourceConfig) *pluginSource {
+	return &pluginSource{p: p, locale: cfg.Locale, country: cfg.Country}
+}
+
+func (s *pluginSource) Name() string { return s.p.Name }
+
+func (s *pluginSource) Fetch(ctx context.Context) ([]spotImage, error) {
+	if s.done {
+		return nil, nil
+	}
+	s.round++
+	ctx, cancel := context.WithTimeout(ctx, pluginSourceTimeout)
+	defer cancel()
+	var resp pluginSourceResponse
+	req := pluginSourceRequest{Protocol: pluginProtocol, Locale: s.locale, Country: s.country, Round: s.round}
+	if err := s.p.call(ctx, "fetch", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Protocol > pluginProtocol {
+		return nil, fmt.Errorf("plugin %s: speaks protocol %d, this spotlightdl only %d", s.p.Name, resp.Protocol, pluginProtocol)
+	}
+	s.done = resp.Done
+	var images []spotImage
+	for _, im := range resp.Images {
+		if im.URL == "" {
+			continue
+		}
+		name := localFileName(im.FileName)
+		if im.FileName != "" && name == "" {
+			slog.Warn("plugin suggested an unsafe file name, skipping the image", "plugin", s.p.Name, "url", im.URL, "fileName", im.FileName)
+			continue
+		}
+		images = append(images, spotImage{
+			URL:         im.URL,
+			FileName:    name,
+			Title:       im.Title,
+			Location:    im.Location,
+			Description: im.Description,
+			Copyright:   im.Copyright,
+			Author:      im.Author,
+			License:     im.License,
+			LicenseURL:  im.LicenseURL,
+			PageURL:     im.PageURL,
+			Source:      s.p.Name,
+			Locale:      cmp.Or(im.Locale, s.locale),
+			Published:   im.Published,
+		})
+	}
+	return images, nil
+}
+
+func (s *pluginSource) exhausted() bool { return s.done }
+
+// newFilterPlugins turns -filter-plugins into filters.
+func newFilterPlugins(names string) ([]*imageFilter, error) {
+	var filters []*imageFilter
+	for _, name := range splitList(names) {
+		p, ok := findPlugin("filter", strings.ToLower(name))
+		if !ok {
+			return nil, fmt.Errorf("-filter-plugins: no filter plugin %q in %s", name, pluginDir())
+		}
+		filters = append(filters, &imageFilter{name: "filter plugin " + p.Name, argv: []string{p.Path, "filter"}})
+	}
+	return filters, nil
+}
+
+func cmdPlugins(args []string) error {
+	flags := flag.NewFlagSet("plugins", flag.ExitOnError)
+	parseFlags(flags, args)
+	if flags.NArg() > 0 {
+		return errors.New("usage: spotlightdl plugins")
+	}
+	plugins := findPlugins("")
+	if len(plugins) == 0 {
+		fmt.Printf("no plugins in %s\n", pluginDir())
+		return nil
+	}
+	fmt.Printf("plugins in %s:\n", pluginDir())
+	for _, p := range plugins {
+		// "describe" is optional; a plugin without it is listed anyway
+		var about struct {
+			Description string `json:"description"`
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		p.call(ctx, "describe", struct {
+			Protocol int `json:"protocol"`
+		}{pluginProtocol}, &about)
+		cancel()
+		fmt.Printf("  %-6s %-20s %s\n", p.Kind, p.Name, about.Description)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLocalFileName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"lake.jpg", "lake.jpg"},
+		{"Lake Bled: dawn?.jpg", "Lake Bled_ dawn_.jpg"},
+		{"../escape.jpg", ""},
+		{"..", ""},
+		{"a/b.jpg", ""},
+		{`..\escape.jpg`, ""},
+		{"/etc/passwd", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := localFileName(tt.name); got != tt.want {
+			t.Errorf("localFileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPluginSourceRejectsTraversal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+cat >/dev/null
+echo '{"protocol":1,"done":true,"images":[
+ {"url":"https://example.com/a.jpg","fileName":"../escape.jpg"},
+ {"url":"https://example.com/b.jpg","fileName":"b.jpg"},
+ {"url":"https://example.com/c.jpg"}]}'
+`
+	p := plugin{Kind: "source", Name: "test", Path: filepath.Join(dir, "spotlightdl-source-test")}
+	if err := os.WriteFile(p.Path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	images, err := newPluginSource(p, sourceConfig{}).Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[0].FileName != "b.jpg" || images[1].FileName != "" {
+		t.Errorf("got %+v, want b.jpg and c.jpg without a name", images)
+	}
+}
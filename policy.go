@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// libraryPolicy is the declared maintenance state of a library, written by
+// `apply` and read by the commands that act on it.
+type libraryPolicy struct {
+	Retention retentionPolicy `json:"retention"`
+	Wallpaper wallpaperPolicy `json:"wallpaper"`
+	Scheduler schedulerState  `json:"scheduler"`
+}
+
+// retentionPolicy is evaluated by prune in the order of its fields; see
+// planPrune.
+type retentionPolicy struct {
+	KeepFavorites bool   `json:"keepFavorites,omitempty"`
+	KeepRating    int    `json:"keepRating,omitempty"` // keep images rated at least this
+	KeepLast      int    `json:"keepLast,omitempty"`
+	KeepPerMonth  int    `json:"keepPerMonth,omitempty"`
+	OlderThan     string `json:"olderThan,omitempty"` // e.g. 180d
+	MaxSize       string `json:"maxSize,omitempty"`   // e.g. 10GB
+	TrashFor      string `json:"trashFor,omitempty"`  // how long pruned images stay in the trash; default 30d
+}
+
+type wallpaperPolicy struct {
+	Mode          string `json:"mode,omitempty"` // off, latest or random
+	Interval      string `json:"interval,omitempty"`
+	FavoritesOnly bool   `json:"favoritesOnly,omitempty"`
+	MinRating     int    `json:"minRating,omitempty"` // only images rated at least this
+	Tags          string `json:"tags,omitempty"`      // as for -tag: beach,-night
+}
+
+// admits reports whether the policy lets e be the wallpaper.
+func (w wallpaperPolicy) admits(e *catalogEntry) bool {
+	return (!w.FavoritesOnly || e.Favorite) && e.Rating >= w.MinRating && parseTagFilter(w.Tags).admits(e.Tags)
+}
+
+type schedulerState struct {
+	Schedule string `json:"schedule,omitempty"`
+	Command  string `json:"command,omitempty"`
+}
+
+func policyPath(outDir string) string {
+	return filepath.Join(stateDir(outDir), "policy.json")
+}
+
+func loadPolicy(outDir string) (libraryPolicy, error) {
+	var p libraryPolicy
+	b, err := os.ReadFile(policyPath(outDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	return p, json.Unmarshal(b, &p)
+}
+
+func savePolicy(outDir string, p libraryPolicy) error {
+	if err := os.MkdirAll(stateDir(outDir), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(policyPath(outDir), append(b, '\n'))
+}
+
+// parseAge extends time.ParseDuration with d (days) and w (weeks).
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// parseSize reads sizes like 500MB, 10GB or 1.5TiB (decimal and binary
+// units); a bare number is bytes.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1},
+	}
+	mult := 1.0
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, mult = strings.TrimSpace(n), u.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	registerFeature(&feature{
+		name:  "rclone",
+		desc:  "-post-sync rclone:<remote:path>",
+		built: true,
+		check: lookTool("rclone"),
+	})
+}
+
+// postSyncExcludes are the files of the library a copy of it has no use
+// for: the lock, the trash, an unfinished reorganize and partial
+// downloads.
+var postSyncExcludes = []string{
+	"/.spotlightdl/lock",
+	"/.spotlightdl/trash/**",
+	"/.spotlightdl/reorganize/**",
+	"*.part",
+}
+
+// parsePostSync checks a -post-sync destination and returns the rclone
+// remote in it. rclone is the only tool so far; the prefix leaves room
+// for others.
+func parsePostSync(dest string) (string, error) {
+	tool, remote, ok := strings.Cut(dest, ":")
+	if !ok || tool != "rclone" {
+		return "", fmt.Errorf("unknown -post-sync %q (want rclone:<remote:path>)", dest)
+	}
+	if !strings.Contains(remote, ":") {
+		return "", fmt.Errorf("-post-sync %q: want rclone:<remote:path>, e.g. rclone:gdrive:Wallpapers", dest)
+	}
+	return remote, requireFeature("rclone")
+}
+
+// postSync makes the rclone remote in dest match the library with rclone
+// sync, which reaches any of rclone's backends and deletes there what
+// was pruned here. rclone reads its own config and RCLONE_* variables.
+func postSync(ctx context.Context, outDir, dest string) error {
+	remote, err := parsePostSync(dest)
+	if err != nil {
+		return err
+	}
+	args := []string{"sync", outDir, remote}
+	for _, ex := range postSyncExcludes {
+		args = append(args, "--exclude", ex)
+	}
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		args = append(args, "-v")
+	}
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone sync to %s: %w", remote, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBars draws a bar for the current download and one for the round
+// below the normal output. Lines printed through println appear above the
+// bars. A nil *progressBars prints plainly and draws nothing.
+type progressBars struct {
+	mu    sync.Mutex
+	w     io.Writer
+	drawn bool
+	last  time.Time
+
+	roundDone, roundTotal int
+	runBytes              int64
+	runStart              time.Time
+
+	file        string
+	done, total int64
+	fileStart   time.Time
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// newProgressBars returns nil unless f is a terminal that understands
+// ANSI cursor movement.
+func newProgressBars(f *os.File) *progressBars {
+	if !isTerminal(f) || os.Getenv("TERM") == "dumb" || !enableVT(f) {
+		return nil
+	}
+	return &progressBars{w: f, runStart: time.Now()}
+}
+
+func (p *progressBars) println(s string) {
+	if p == nil {
+		fmt.Println(s)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.erase()
+	fmt.Fprintln(p.w, s)
+	p.draw()
+}
+
+func (p *progressBars) startRound(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roundDone, p.roundTotal = 0, total
+}
+
+// step marks one image of the round as handled, downloaded or not.
+func (p *progressBars) step() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roundDone++
+	p.file = ""
+	p.redraw()
+}
+
+func (p *progressBars) startFile(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.file, p.done, p.total, p.fileStart = name, 0, 0, time.Now()
+	p.redraw()
+}
+
+func (p *progressBars) update(done, total int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.runBytes += done - p.done
+	p.done, p.total = done, total
+	if time.Since(p.last) >= 100*time.Millisecond || done == total {
+		p.redraw()
+	}
+}
+
+// clear removes the bars, e.g. before the program exits.
+func (p *progressBars) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.erase()
+}
+
+func (p *progressBars) redraw() {
+	p.erase()
+	p.draw()
+}
+
+func (p *progressBars) erase() {
+	if p.drawn {
+		// up one line, clear it and the one below
+		fmt.Fprint(p.w, "\r\x1b[1A\x1b[2K\x1b[1B\x1b[2K\x1b[1A")
+		p.drawn = false
+	}
+}
+
+func (p *progressBars) draw() {
+	p.last = time.Now()
+	var file string
+	if p.file != "" {
+		frac := 0.0
+		if p.total > 0 {
+			frac = float64(p.done) / float64(p.total)
+		}
+		speed := rate(p.done, time.Since(p.fileStart))
+		eta := "--"
+		if speed > 0 && p.total > 0 {
+			eta = (time.Duration(float64(p.total-p.done)/speed) * time.Second).Round(time.Second).String()
+		}
+		file = fmt.Sprintf("%-24s %s %3.0f%% %9s %9s/s ETA %s", truncate(p.file, 24), bar(frac, 20),
+			frac*100, formatBytes(p.done), formatBytes(int64(speed)), eta)
+	}
+	round := 0.0
+	if p.roundTotal > 0 {
+		round = float64(p.roundDone) / float64(p.roundTotal)
+	}
+	total := fmt.Sprintf("%-24s %s %d/%d %9s %9s/s", "round", bar(round, 20), p.roundDone, p.roundTotal,
+		formatBytes(p.runBytes), formatBytes(int64(rate(p.runBytes, time.Since(p.runStart)))))
+	fmt.Fprintf(p.w, "%s\n%s", file, total)
+	p.drawn = true
+}
+
+func rate(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func bar(frac float64, width int) string {
+	n := int(min(max(frac, 0), 1) * float64(width))
+	return "[" + strings.Repeat("#", n) + strings.Repeat("-", width-n) + "]"
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// parseProxyURL accepts full URLs as well as bare host:port, which is how
+// proxies are usually written down in corporate docs.
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "socks5", "socks5h":
+		// net/http speaks SOCKS5 itself, including user/password auth
+		// from the URL; names are always resolved by the proxy.
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", s)
+	}
+	return u, nil
+}
+
+// fixedProxy routes every request through u except those excluded by
+// NO_PROXY, mirroring what http.ProxyFromEnvironment does for HTTPS_PROXY.
+func fixedProxy(u *url.URL) func(*http.Request) (*url.URL, error) {
+	noProxy := firstEnv("NO_PROXY", "no_proxy")
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		return u, nil
+	}
+}
+
+// bypassProxy implements the common NO_PROXY dialect: "*", host names,
+// ".domain" or "domain" suffixes (optionally with :port), IPs and CIDRs.
+// Loopback is always direct.
+func bypassProxy(hostport, noProxy string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		if eip := net.ParseIP(strings.Trim(entry, "[]")); eip != nil {
+			if ip != nil && eip.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
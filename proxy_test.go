@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		host, noProxy string
+		want          bool
+	}{
+		{"localhost:443", "", true},
+		{"127.0.0.1:80", "", true},
+		{"[::1]:443", "", true},
+		{"example.com:443", "", false},
+		{"example.com:443", "*", true},
+		{"example.com:443", " , example.com ", true},
+		{"EXAMPLE.com:443", "Example.COM", true},
+		{"cdn.example.com:443", "example.com", true},
+		{"cdn.example.com:443", ".example.com", true},
+		{"cdn.example.com:443", "*.example.com", true},
+		{"example.com:443", ".example.com", true},
+		{"badexample.com:443", "example.com", false},
+		{"example.com.evil:443", "example.com", false},
+		{"example.com:443", "example.com:443", true},
+		{"example.com:8443", "example.com:443", false},
+		{"10.1.2.3:443", "10.0.0.0/8", true},
+		{"192.168.1.1:443", "10.0.0.0/8", false},
+		{"example.com:443", "10.0.0.0/8", false},
+		{"[fd00::1]:443", "fd00::/8", true},
+		{"10.1.2.3:443", "10.1.2.3", true},
+		{"10.1.2.3:443", "10.1.2.4", false},
+		{"10.1.2.3:443", "10.1.2.3:443", true},
+		{"10.1.2.3:443", "10.1.2.3:80", false},
+		{"[fd00::1]:443", "[fd00::1]:443", true},
+		{"example.com", "example.com", true},
+	}
+	for _, tt := range tests {
+		if got := bypassProxy(tt.host, tt.noProxy); got != tt.want {
+			t.Errorf("bypassProxy(%q, %q) = %v, want %v", tt.host, tt.noProxy, got, tt.want)
+		}
+	}
+}
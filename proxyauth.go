@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// proxyAuthenticator produces the tokens of a connection-bound, multi-leg
+// proxy handshake (NTLM, Negotiate). step is called with a nil challenge
+// for the first token.
+type proxyAuthenticator interface {
+	scheme() string
+	step(challenge []byte) ([]byte, error)
+}
+
+// newProxyAuthenticator picks SSPI (current Windows logon) when no explicit
+// account is given, and the built-in NTLM client otherwise.
+func newProxyAuthenticator(mode, account, password, proxyHost string) (proxyAuthenticator, error) {
+	var scheme string
+	switch strings.ToLower(mode) {
+	case "ntlm":
+		scheme = "NTLM"
+	case "negotiate", "kerberos":
+		scheme = "Negotiate"
+	default:
+		return nil, fmt.Errorf("unsupported proxy auth %q (want ntlm or negotiate)", mode)
+	}
+	if account == "" {
+		return sspiAuthenticator(scheme, "HTTP/"+proxyHost)
+	}
+	// Negotiate proxies accept raw NTLMSSP tokens; Kerberos itself needs SSPI.
+	return newNTLMAuth(scheme, account, password), nil
+}
+
+// connectDialer tunnels every connection through the proxy with CONNECT so
+// the multi-leg handshake can run on a single TCP connection, which
+// http.Transport's own proxy support cannot do.
+type connectDialer struct {
+	proxy     func(*http.Request) (*url.URL, error)
+	auth      func(proxyHost string) (proxyAuthenticator, error)
+	dialer    *net.Dialer
+	userAgent string
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyURL, err := d.proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+	if proxyURL.Scheme != "http" {
+		return nil, fmt.Errorf("-proxy-auth needs an http:// proxy, got %s", proxyURL.Scheme)
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "8080")
+	}
+
+	conn, err := d.dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	tunnel, err := d.handshake(conn, proxyURL.Hostname(), addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+func (d *connectDialer) handshake(conn net.Conn, proxyHost, addr string) (net.Conn, error) {
+	auth, err := d.auth(proxyHost)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := auth.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	br := bufio.NewReader(conn)
+	var challenge []byte
+	for leg := 0; leg < 3; leg++ {
+		token, err := auth.step(challenge)
+		if err != nil {
+			return nil, err
+		}
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: http.Header{},
+		}
+		req.Header.Set("User-Agent", d.userAgent)
+		req.Header.Set("Proxy-Connection", "Keep-Alive")
+		req.Header.Set("Proxy-Authorization", auth.scheme()+" "+base64.StdEncoding.EncodeToString(token))
+		if err := req.Write(conn); err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			if br.Buffered() > 0 {
+				return &bufferedConn{Conn: conn, r: br}, nil
+			}
+			return conn, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusProxyAuthRequired {
+			return nil, fmt.Errorf("proxy CONNECT: http %d", resp.StatusCode)
+		}
+		challenge = authChallenge(resp.Header, auth.scheme())
+		if challenge == nil || resp.Close {
+			return nil, fmt.Errorf("proxy rejected %s authentication", auth.scheme())
+		}
+	}
+	return nil, errors.New("proxy auth: too many round trips")
+}
+
+func authChallenge(h http.Header, scheme string) []byte {
+	for _, v := range h.Values("Proxy-Authenticate") {
+		name, data, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(name, scheme) || data == "" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand("prune", cmdPrune)
+}
+
+// pruneDecision is the verdict of the retention policy on one image. Trace
+// has one line per rule that was consulted, for `prune -explain`.
+type pruneDecision struct {
+	Entry *catalogEntry
+	Prune bool
+	Rule  string // the rule that decided
+	Trace []string
+}
+
+var errNoRetention = errors.New("no retention policy is set")
+
+// planPrune applies the retention policy. The rules are evaluated in this
+// order, and the first one that keeps an image protects it:
+//
+//  1. keep_favorites: favorites are kept
+//  2. keep_rating: images rated at least this are kept
+//  3. keep_last: the newest N images are kept
+//  4. keep_per_month: the newest N images of each month are kept
+//  5. older_than: unprotected images older than this are pruned
+//  6. max_size: while the library is larger, the oldest unprotected
+//     images are pruned
+//
+// Without older_than and max_size, every image the keep rules do not
+// protect is pruned.
+func planPrune(cat *catalog, pol retentionPolicy, now time.Time) ([]*pruneDecision, error) {
+	var maxAge time.Duration
+	var maxSize int64
+	var err error
+	if pol.OlderThan != "" {
+		if maxAge, err = parseAge(pol.OlderThan); err != nil {
+			return nil, fmt.Errorf("older_than: %w", err)
+		}
+	}
+	if pol.MaxSize != "" {
+		if maxSize, err = parseSize(pol.MaxSize); err != nil {
+			return nil, fmt.Errorf("max_size: %w", err)
+		}
+	}
+	if !pol.KeepFavorites && pol.KeepRating == 0 && pol.KeepLast == 0 && pol.KeepPerMonth == 0 && maxAge == 0 && maxSize == 0 {
+		return nil, errNoRetention
+	}
+
+	entries := slices.Clone(cat.Images)
+	slices.SortStableFunc(entries, func(a, b *catalogEntry) int { return b.Added.Compare(a.Added) })
+	perMonth := make(map[string]int)
+	var plan []*pruneDecision
+	var open []*pruneDecision // not protected by a keep rule, oldest last
+	for i, e := range entries {
+		d := &pruneDecision{Entry: e}
+		plan = append(plan, d)
+		month := e.Added.Local().Format("2006-01")
+		rank := perMonth[month]
+		perMonth[month]++
+		rules := []struct {
+			on   bool
+			name string
+			kept bool
+			why  string
+		}{
+			{pol.KeepFavorites, "keep_favorites", e.Favorite, "favorite"},
+			{pol.KeepRating > 0, "keep_rating", e.Rating >= pol.KeepRating, fmt.Sprintf("rated %d, keeping %d and up", e.Rating, pol.KeepRating)},
+			{pol.KeepLast > 0, "keep_last", i < pol.KeepLast, fmt.Sprintf("#%d by date, keeping the newest %d", i+1, pol.KeepLast)},
+			{pol.KeepPerMonth > 0, "keep_per_month", rank < pol.KeepPerMonth, fmt.Sprintf("#%d in %s, keeping the newest %d", rank+1, month, pol.KeepPerMonth)},
+		}
+		for _, r := range rules {
+			if !r.on {
+				continue
+			}
+			if r.kept {
+				d.Rule = r.name
+				d.Trace = append(d.Trace, fmt.Sprintf("%-15s %s: kept", r.name, r.why))
+				break
+			}
+			if r.name == "keep_favorites" {
+				r.why = "not a favorite"
+			}
+			d.Trace = append(d.Trace, fmt.Sprintf("%-15s %s: no match", r.name, r.why))
+		}
+		if d.Rule == "" {
+			open = append(open, d)
+		}
+	}
+
+	for _, d := range open {
+		age := now.Sub(d.Entry.Added)
+		switch {
+		case maxAge > 0 && age > maxAge:
+			d.Prune, d.Rule = true, "older_than"
+			d.Trace = append(d.Trace, fmt.Sprintf("%-15s added %s ago, older than %s: pruned", "older_than", formatAge(age), pol.OlderThan))
+		case maxAge > 0:
+			d.Trace = append(d.Trace, fmt.Sprintf("%-15s added %s ago, within %s", "older_than", formatAge(age), pol.OlderThan))
+		case maxSize == 0:
+			d.Prune, d.Rule = true, "keep rules"
+			d.Trace = append(d.Trace, fmt.Sprintf("%-15s no keep rule protects it: pruned", "keep rules"))
+		}
+	}
+	if maxSize > 0 {
+		var total int64
+		for _, d := range plan {
+			if !d.Prune {
+				total += d.Entry.Size
+			}
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			d := open[i]
+			if d.Prune {
+				continue
+			}
+			if total > maxSize {
+				total -= d.Entry.Size
+				d.Prune, d.Rule = true, "max_size"
+				d.Trace = append(d.Trace, fmt.Sprintf("%-15s library over %s, oldest unprotected image: pruned", "max_size", pol.MaxSize))
+			} else {
+				d.Rule = "max_size"
+				d.Trace = append(d.Trace, fmt.Sprintf("%-15s library fits in %s: kept", "max_size", pol.MaxSize))
+			}
+		}
+	}
+	for _, d := range open {
+		if d.Rule == "" {
+			d.Rule = "older_than"
+		}
+	}
+	return plan, nil
+}
+
+func formatAge(d time.Duration) string {
+	if d < 48*time.Hour {
+		return d.Round(time.Hour).String()
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// Pruned images are soft-deleted: moved to .spotlightdl/trash with their
+// catalog entries in trash.json, and only deleted for good once they have
+// been there for trash_for.
+
+type trashedImage struct {
+	Entry   *catalogEntry `json:"entry"`
+	Trashed time.Time     `json:"trashed"`
+}
+
+func trashDir(outDir string) string {
+	return filepath.Join(stateDir(outDir), "trash")
+}
+
+func loadTrash(outDir string) ([]*trashedImage, error) {
+	var t []*trashedImage
+	b, err := os.ReadFile(filepath.Join(trashDir(outDir), "trash.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, json.Unmarshal(b, &t)
+}
+
+func saveTrash(outDir string, t []*trashedImage) error {
+	if err := os.MkdirAll(trashDir(outDir), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(trashDir(outDir), "trash.json"), b)
+}
+
+// moveFile renames an image and the sidecars that travel with it.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	for _, ext := range []string{".json", ".xmp", ".sha256"} {
+		if exists(from + ext) {
+			os.Rename(from+ext, to+ext)
+		}
+	}
+	if filepath.Base(from) != filepath.Base(to) {
+		renameChecksumSidecar(to)
+	}
+	return nil
+}
+
+func trashImage(outDir string, cat *catalog, trash []*trashedImage, e *catalogEntry, now time.Time) ([]*trashedImage, error) {
+	from := filepath.Join(outDir, filepath.FromSlash(e.Path))
+	if err := moveFile(from, filepath.Join(trashDir(outDir), filepath.FromSlash(e.Path))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return trash, err
+	}
+	if e.Thumb != "" {
+		os.Remove(thumbFile(outDir, e))
+		e.Thumb = ""
+	}
+	removeLinks(outDir, e)
+	cat.remove(e.Path)
+	// a second image with the same path replaces the older one in the trash
+	trash = slices.DeleteFunc(trash, func(t *trashedImage) bool { return t.Entry.Path == e.Path })
+	return append(trash, &trashedImage{Entry: e, Trashed: now}), nil
+}
+
+// purgeTrash deletes what has been in the trash for longer than keep.
+func purgeTrash(outDir string, trash []*trashedImage, keep time.Duration, now time.Time) ([]*trashedImage, int, error) {
+	n := 0
+	var err error
+	trash = slices.DeleteFunc(trash, func(t *trashedImage) bool {
+		if now.Sub(t.Trashed) < keep {
+			return false
+		}
+		p := filepath.Join(trashDir(outDir), filepath.FromSlash(t.Entry.Path))
+		for _, f := range []string{p, p + ".json", p + ".xmp", p + ".sha256"} {
+			if rerr := os.Remove(f); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+				err = rerr
+			}
+		}
+		n++
+		return true
+	})
+	return trash, n, err
+}
+
+func cmdPrune(args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	dryRun := flags.Bool("dry-run", false, "show what would be pruned without touching anything")
+	explain := flags.String("explain", "", "show how the policy decides about this image (path or SHA-256 prefix)")
+	restore := flags.String("restore", "", "move an image back from the trash (path or SHA-256 prefix)")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	keepLast := flags.Int("keep-last", 0, "keep the newest N images (overrides keep_last of the policy)")
+	olderThan := flags.String("older-than", "", "prune images added longer ago than this, e.g. 180d (overrides older_than)")
+	maxSize := flags.String("max-size", "", "prune the oldest images while the library is larger than this, e.g. 10GB (overrides max_size)")
+	parseFlags(flags, args)
+
+	if !*dryRun && *explain == "" {
+		lock, err := lockLibrary(context.Background(), *outDir, "prune", *lockWait)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+
+	pol, err := loadPolicy(*outDir)
+	if err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "keep-last":
+			pol.Retention.KeepLast = *keepLast
+		case "older-than":
+			pol.Retention.OlderThan = *olderThan
+		case "max-size":
+			pol.Retention.MaxSize = *maxSize
+		}
+	})
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	trash, err := loadTrash(*outDir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if !*dryRun && *explain == "" && *restore == "" {
+		if err := checkFrozen(*outDir, "prune"); err != nil {
+			return err
+		}
+	}
+	if *restore != "" {
+		return restoreFromTrash(*outDir, cat, trash, *restore)
+	}
+
+	plan, err := planPrune(cat, pol.Retention, now)
+	if errors.Is(err, errNoRetention) {
+		return fmt.Errorf("prune: %w; set one in the [retention] section of `apply` or with -keep-last, -older-than or -max-size", err)
+	}
+	if err != nil {
+		return fmt.Errorf("prune: %w", err)
+	}
+
+	if *explain != "" {
+		e, err := cat.lookup(*outDir, *explain)
+		if err != nil {
+			return err
+		}
+		for _, d := range plan {
+			if d.Entry != e {
+				continue
+			}
+			verdict := "kept"
+			if d.Prune {
+				verdict = "pruned"
+			}
+			fmt.Printf("%s (added %s, %s): %s by %s\n", e.Path, e.Added.Local().Format("2006-01-02"), formatBytes(e.Size), verdict, d.Rule)
+			for i, line := range d.Trace {
+				fmt.Printf("  %d. %s\n", i+1, line)
+			}
+		}
+		return nil
+	}
+
+	var n int
+	var size int64
+	for _, d := range plan {
+		if !d.Prune {
+			continue
+		}
+		n++
+		size += d.Entry.Size
+		fmt.Printf("- %s (%s)\n", d.Entry.Path, d.Rule)
+		if *dryRun {
+			continue
+		}
+		if trash, err = trashImage(*outDir, cat, trash, d.Entry, now); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		fmt.Printf("would prune %d images (%s), keeping %d\n", n, formatBytes(size), len(plan)-n)
+		return nil
+	}
+
+	keep := 30 * 24 * time.Hour
+	if pol.Retention.TrashFor != "" {
+		if keep, err = parseAge(pol.Retention.TrashFor); err != nil {
+			return fmt.Errorf("trash_for: %w", err)
+		}
+	}
+	trash, purged, perr := purgeTrash(*outDir, trash, keep, now)
+	if err := cat.save(); err != nil {
+		return err
+	}
+	if err := saveTrash(*outDir, trash); err != nil {
+		return err
+	}
+	fmt.Printf("pruned %d images (%s), kept %d", n, formatBytes(size), len(plan)-n)
+	if purged > 0 {
+		fmt.Printf("; emptied %d from the trash", purged)
+	}
+	fmt.Println()
+	return perr
+}
+
+func restoreFromTrash(outDir string, cat *catalog, trash []*trashedImage, ref string) error {
+	ref = filepath.ToSlash(ref)
+	i := slices.IndexFunc(trash, func(t *trashedImage) bool {
+		return t.Entry.Path == ref || (len(ref) >= 6 && strings.HasPrefix(t.Entry.SHA256, strings.ToLower(ref)))
+	})
+	if i < 0 {
+		return fmt.Errorf("%s: not in the trash", ref)
+	}
+	e := trash[i].Entry
+	to := filepath.Join(outDir, filepath.FromSlash(e.Path))
+	if exists(to) {
+		return fmt.Errorf("%s already exists", to)
+	}
+	if err := moveFile(filepath.Join(trashDir(outDir), filepath.FromSlash(e.Path)), to); err != nil {
+		return err
+	}
+	cat.add(e)
+	if err := cat.save(); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s\n", e.Path)
+	return saveTrash(outDir, slices.Delete(trash, i, i+1))
+}
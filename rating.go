@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unratedWeight is the rotation weight of images nobody has rated yet: a
+// middling 3 stars, so new images still come up regularly.
+const unratedWeight = 3
+
+func init() {
+	registerCommand("rate", cmdRate)
+	registerCommand("star", cmdStar)
+	registerCommand("unstar", cmdUnstar)
+	registerCommand("rotate", cmdRotate)
+}
+
+func cmdRate(args []string) error {
+	flags := flag.NewFlagSet("rate", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	xmp := flags.Bool("xmp", false, "also write the rating to the image's XMP sidecar (<file>.xmp)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl rate [-outdir dir] [-xmp] <0-5> <image|sha256>...")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("rate: need a rating and at least one image")
+	}
+	rating, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || rating < 0 || rating > 5 {
+		return fmt.Errorf("rate: rating must be 0 (clear) to 5, got %q", flags.Arg(0))
+	}
+
+	lock, err := lockLibrary(context.Background(), *outDir, "rate", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	for _, ref := range flags.Args()[1:] {
+		e, err := cat.lookup(*outDir, ref)
+		if err != nil {
+			return err
+		}
+		e.Rating = rating
+		// a sidecar that is already there is kept up to date either way
+		write := syncXMPRating
+		if *xmp {
+			write = writeXMPRating
+		}
+		if err := write(filepath.Join(*outDir, filepath.FromSlash(e.Path)), rating); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", stars(rating), e.Path)
+	}
+	return cat.save()
+}
+
+// star and unstar mark and unmark favorites. Favorites survive prune
+// with keep_favorites, and rotate, serve, browse, list and the exports
+// can be limited to them with -favorites-only.
+func cmdStar(args []string) error {
+	return setFavorite("star", true, args)
+}
+
+func cmdUnstar(args []string) error {
+	return setFavorite("unstar", false, args)
+}
+
+func setFavorite(name string, on bool, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: spotlightdl %s [-outdir dir] <image|sha256>...\n", name)
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("%s: need at least one image", name)
+	}
+
+	lock, err := lockLibrary(context.Background(), *outDir, name, *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	for _, ref := range flags.Args() {
+		e, err := cat.lookup(*outDir, ref)
+		if err != nil {
+			return err
+		}
+		e.Favorite = on
+		mark := "☆"
+		if on {
+			mark = "★"
+		}
+		fmt.Printf("%s %s\n", mark, e.Path)
+	}
+	return cat.save()
+}
+
+func stars(n int) string {
+	return strings.Repeat("★", n) + strings.Repeat("☆", 5-n)
+}
+
+func cmdRotate(args []string) error {
+	flags := flag.NewFlagSet("rotate", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	mode := flags.String("mode", "", "random (weighted by rating) or latest; defaults to the wallpaper policy from apply, else random")
+	interval := flags.String("interval", "", "keep running and change the wallpaper this often, e.g. 1h (default: once, or the policy interval)")
+	favoritesOnly := flags.Bool("favorites-only", false, "only show favorites (default: the wallpaper policy)")
+	minRating := flags.Int("min-rating", -1, "only show images rated at least this, 1-5 (default: the wallpaper policy)")
+	tags := flags.String("tag", "", "only show images with one of these tags, and none of those prefixed with -, e.g. beach,-night (default: the wallpaper policy)")
+	parseFlags(flags, args)
+
+	pol, err := loadPolicy(*outDir)
+	if err != nil {
+		return err
+	}
+	m := firstNonEmpty(*mode, firstNonEmpty(pol.Wallpaper.Mode, "random"))
+	if m == "off" {
+		return errors.New("rotate: wallpaper policy is off")
+	}
+	if m != "random" && m != "latest" {
+		return fmt.Errorf("rotate: unknown mode %q (want random or latest)", m)
+	}
+	w := pol.Wallpaper
+	w.Mode = m
+	w.FavoritesOnly = w.FavoritesOnly || *favoritesOnly
+	if *tags != "" {
+		w.Tags = *tags
+	}
+	if *minRating >= 0 {
+		if *minRating > 5 {
+			return fmt.Errorf("rotate: -min-rating must be between 0 and 5, got %d", *minRating)
+		}
+		w.MinRating = *minRating
+	}
+	var every time.Duration
+	if iv := firstNonEmpty(*interval, pol.Wallpaper.Interval); iv != "" {
+		if every, err = parseAge(iv); err != nil {
+			return err
+		}
+	}
+
+	var current string
+	for {
+		// a freeze only stops a running rotation from changing anything
+		if err := checkFrozen(*outDir, "rotate"); err != nil {
+			if every <= 0 {
+				return err
+			}
+			time.Sleep(every)
+			continue
+		}
+		cat, err := openCatalog(*outDir)
+		if err != nil {
+			return err
+		}
+		e := pickWallpaper(cat, *outDir, current, w)
+		if e == nil {
+			switch {
+			case w.Tags != "":
+				return fmt.Errorf("rotate: no images in the library match the tags %s", w.Tags)
+			case w.FavoritesOnly && w.MinRating > 0:
+				return fmt.Errorf("rotate: no favorites rated %d stars or more", w.MinRating)
+			case w.FavoritesOnly:
+				return errors.New("rotate: no favorites in the library; star some first")
+			case w.MinRating > 0:
+				return fmt.Errorf("rotate: no images rated %d stars or more", w.MinRating)
+			}
+			return errors.New("rotate: no images in the library")
+		}
+		if e.Path != current {
+			if err := setWallpaper(filepath.Join(*outDir, filepath.FromSlash(e.Path))); err != nil {
+				return fmt.Errorf("rotate: %w", err)
+			}
+			fmt.Println(e.Path)
+			current = e.Path
+		}
+		if every <= 0 {
+			return nil
+		}
+		time.Sleep(every)
+	}
+}
+
+// pickWallpaper chooses the next image among those w admits; random mode
+// samples proportionally to the rating and avoids showing the current
+// image twice in a row.
+func pickWallpaper(cat *catalog, outDir, current string, w wallpaperPolicy) *catalogEntry {
+	var pool []*catalogEntry
+	for _, e := range cat.Images {
+		if w.admits(e) && exists(filepath.Join(outDir, filepath.FromSlash(e.Path))) {
+			pool = append(pool, e)
+		}
+	}
+	if len(pool) == 0 {
+		return nil
+	}
+	if w.Mode == "latest" {
+		return slices.MaxFunc(pool, func(a, b *catalogEntry) int { return a.Added.Compare(b.Added) })
+	}
+	if len(pool) > 1 {
+		pool = slices.DeleteFunc(pool, func(e *catalogEntry) bool { return e.Path == current })
+	}
+	weight := func(e *catalogEntry) int {
+		if e.Rating == 0 {
+			return unratedWeight
+		}
+		return e.Rating
+	}
+	total := 0
+	for _, e := range pool {
+		total += weight(e)
+	}
+	n := rand.IntN(total)
+	for _, e := range pool {
+		if n -= weight(e); n < 0 {
+			return e
+		}
+	}
+	return pool[len(pool)-1]
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+func init() {
+	registerCommand("rebuild-index", cmdRebuildIndex)
+	registerCommand("watch", cmdWatch)
+}
+
+// catalogChanges lists what reconcileCatalog did to the catalog.
+type catalogChanges struct {
+	Added, Removed, Changed []string
+	Renamed                 [][2]string // old path, new path
+}
+
+// reconcileCatalog brings the catalog in line with the images on disk:
+// files added by hand are indexed, deleted ones dropped, and a file that
+// was moved or renamed keeps its metadata. The archive snapshot and
+// history are updated on the way; rehash ignores the cached hashes. It
+// waits up to wait for the library lock on behalf of command.
+func reconcileCatalog(outDir, command string, rehash bool, wait time.Duration) (*catalogChanges, error) {
+	lock, err := lockLibrary(context.Background(), outDir, command, wait)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+	if _, err := recordArchiveDiff(outDir, rehash); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(stateDir(outDir), "snapshot.json"))
+	if err != nil {
+		return nil, err
+	}
+	var files map[string]snapshotFile
+	if err := json.Unmarshal(b, &files); err != nil {
+		return nil, err
+	}
+	cat, err := openCatalog(outDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// entries without a file may turn out to have moved, or live on in a
+	// hard link in another market's folder; the snapshot leaves those out
+	ch := &catalogChanges{}
+	gone := make(map[string]*catalogEntry)
+	var pruned bool
+	for _, e := range cat.Images {
+		n := len(e.Links)
+		e.Links = slices.DeleteFunc(e.Links, func(rel string) bool { return !exists(filepath.Join(outDir, filepath.FromSlash(rel))) })
+		pruned = pruned || len(e.Links) != n
+		if _, ok := files[e.Path]; ok {
+			continue
+		}
+		if len(e.Links) > 0 {
+			ch.Renamed = append(ch.Renamed, [2]string{e.Path, e.Links[0]})
+			e.Path, e.Links = e.Links[0], e.Links[1:]
+			continue
+		}
+		gone[e.SHA256] = e
+	}
+	paths := slices.Sorted(maps.Keys(files))
+	for _, rel := range paths {
+		f := files[rel]
+		e := cat.byPath(rel)
+		switch {
+		case e != nil && e.SHA256 == f.SHA256:
+		case e != nil:
+			indexFile(cat, outDir, rel, f)
+			ch.Changed = append(ch.Changed, rel)
+		case gone[f.SHA256] != nil:
+			e = gone[f.SHA256]
+			delete(gone, f.SHA256)
+			ch.Renamed = append(ch.Renamed, [2]string{e.Path, rel})
+			e.Path = rel
+		default:
+			indexFile(cat, outDir, rel, f)
+			ch.Added = append(ch.Added, rel)
+		}
+	}
+	var deleted []*catalogEntry
+	for _, e := range gone {
+		cat.remove(e.Path)
+		ch.Removed = append(ch.Removed, e.Path)
+		deleted = append(deleted, e)
+	}
+	// deleted by hand: do not download them again
+	if err := buryEntries(outDir, deleted, "deleted"); err != nil {
+		return nil, err
+	}
+	slices.Sort(ch.Removed)
+	if len(ch.Added)+len(ch.Removed)+len(ch.Changed)+len(ch.Renamed) == 0 && !pruned {
+		return ch, nil
+	}
+	return ch, cat.save()
+}
+
+// indexFile (re)creates the catalog entry for a file that did not come
+// through a download, keeping user data like ratings and tags.
+func indexFile(cat *catalog, outDir, rel string, f snapshotFile) {
+	e := cat.byPath(rel)
+	if e == nil {
+		e = &catalogEntry{Path: rel, Source: "manual", Added: time.Now().UTC()}
+		cat.add(e)
+	}
+	if e.SHA256 != f.SHA256 {
+		// derived data belongs to the old content
+		e.PHash, e.Palette, e.Brightness, e.Thumb = "", nil, 0, ""
+	}
+	e.SHA256, e.Size = f.SHA256, f.Size
+	e.Width, e.Height, _ = imageSize(filepath.Join(outDir, filepath.FromSlash(rel)))
+}
+
+func (ch *catalogChanges) print() {
+	for _, p := range ch.Added {
+		fmt.Printf("+ %s\n", p)
+	}
+	for _, p := range ch.Removed {
+		fmt.Printf("- %s\n", p)
+	}
+	for _, p := range ch.Changed {
+		fmt.Printf("~ %s\n", p)
+	}
+	for _, r := range ch.Renamed {
+		fmt.Printf("> %s -> %s\n", r[0], r[1])
+	}
+}
+
+func cmdRebuildIndex(args []string) error {
+	flags := flag.NewFlagSet("rebuild-index", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	parseFlags(flags, args)
+
+	// rehash everything: a full rebuild must not trust the snapshot
+	ch, err := reconcileCatalog(*outDir, "rebuild-index", true, *lockWait)
+	if err != nil {
+		return err
+	}
+	ch.print()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d images indexed\n", len(cat.Images))
+	return nil
+}
+
+func cmdWatch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	settle := flags.Duration("settle", 2*time.Second, "wait this long after the last change before updating the catalog")
+	parseFlags(flags, args)
+	return watchLibrary(*outDir, *settle, nil, true)
+}
+
+// watchLibrary keeps the catalog in sync with outDir until an error occurs.
+// Changes are skipped while busy (if set) reports true. While another run
+// holds the library lock, it tries again every settle.
+func watchLibrary(outDir string, settle time.Duration, busy func() bool, verbose bool) error {
+	changed := make(chan struct{}, 1)
+	poke := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	if ch, err := reconcileCatalog(outDir, "watch", false, 0); errors.As(err, new(*lockedError)) {
+		poke()
+	} else if err != nil {
+		return err
+	} else if verbose {
+		ch.print()
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- watchDir(outDir, poke)
+	}()
+	if verbose {
+		fmt.Printf("watching %s\n", outDir)
+	}
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-changed:
+		}
+		// let a burst of changes (a file manager moving a folder) finish
+		for quiet := false; !quiet; {
+			select {
+			case <-changed:
+			case <-time.After(settle):
+				quiet = true
+			}
+		}
+		if busy != nil && busy() {
+			continue
+		}
+		ch, err := reconcileCatalog(outDir, "watch", false, 0)
+		if errors.As(err, new(*lockedError)) {
+			poke()
+			continue
+		}
+		if err != nil {
+			slog.Warn("watch: updating the catalog failed", "err", err)
+			continue
+		}
+		if verbose {
+			ch.print()
+		} else if n := len(ch.Added) + len(ch.Removed) + len(ch.Changed) + len(ch.Renamed); n > 0 {
+			slog.Info("catalog updated from disk", "added", len(ch.Added), "removed", len(ch.Removed), "changed", len(ch.Changed), "renamed", len(ch.Renamed))
+		}
+	}
+}
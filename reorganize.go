@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// reorganize moves the images already in the library to where -organize
+// and -name would put them today. It works in two steps, all files into
+// a staging directory and from there to their new places, so that moves
+// can swap or chain names. A journal records the plan: if the process
+// dies halfway, the next reorganize puts every file back first. The
+// catalog is the commit point, and the snapshot follows it so that the
+// move does not show up in the archive history.
+
+type reorgMove struct {
+	From string `json:"from"` // slash-separated, relative to outdir
+	To   string `json:"to"`
+}
+
+func reorgJournalPath(outDir string) string {
+	return filepath.Join(stateDir(outDir), "reorganize.json")
+}
+
+func reorgStage(outDir string, i int) string {
+	return filepath.Join(stateDir(outDir), "reorganize", strconv.Itoa(i))
+}
+
+func init() {
+	registerCommand("reorganize", cmdReorganize)
+}
+
+func cmdReorganize(args []string) error {
+	flags := flag.NewFlagSet("reorganize", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	organize := flags.String("organize", "", "folders, as for the fetch run: date, locale, photographer (empty moves everything to the top level)")
+	organizeDate := flags.String("organize-date", "published", "date for -organize date: published or downloaded")
+	nameTmpl := flags.String("name", "", "file name template, as for the fetch run (empty keeps the current names)")
+	dryRun := flags.Bool("dry-run", false, "show the moves without making them")
+	parseFlags(flags, args)
+
+	layout, err := parseOrganize(*organize, *organizeDate, *nameTmpl)
+	if err != nil {
+		return err
+	}
+	lock, err := lockLibrary(context.Background(), *outDir, "reorganize", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	if *dryRun && exists(reorgJournalPath(*outDir)) {
+		return errors.New("reorganize: the previous run was interrupted; run it without -dry-run to put the files back first")
+	}
+	if err := recoverReorganize(*outDir); err != nil {
+		return err
+	}
+	if !*dryRun {
+		if err := checkFrozen(*outDir, "reorganize"); err != nil {
+			return err
+		}
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	moves := planReorganize(*outDir, cat, layout)
+	if len(moves) == 0 {
+		fmt.Println("nothing to move")
+		return nil
+	}
+	if *dryRun {
+		for _, m := range moves {
+			fmt.Printf("%s -> %s\n", m.From, m.To)
+		}
+		fmt.Printf("would move %d image(s)\n", len(moves))
+		return nil
+	}
+	if err := applyReorganize(*outDir, cat, moves); err != nil {
+		return err
+	}
+	relinkLocales(*outDir, cat, layout)
+	if err := cat.save(); err != nil {
+		return err
+	}
+	if slices.ContainsFunc(objectLinkDirs, func(d string) bool { return exists(filepath.Join(*outDir, d)) }) {
+		// the links of -store objects follow what is left under objects/
+		if err := linkObjects(*outDir, cat); err != nil {
+			slog.Warn("linking images failed", "err", err)
+		}
+	}
+	fmt.Printf("moved %d image(s)\n", len(moves))
+	return nil
+}
+
+// relinkLocales makes the hard links of images from several markets
+// afresh, where the new scheme puts each market's folder.
+func relinkLocales(outDir string, cat *catalog, layout *organizeScheme) {
+	for _, e := range cat.Images {
+		removeLinks(outDir, e)
+	}
+	if !layout.byLocale() {
+		return
+	}
+	for _, e := range cat.Images {
+		if len(e.Locales) < 2 || !exists(filepath.Join(outDir, filepath.FromSlash(e.Path))) {
+			continue
+		}
+		// the file itself is in the folder of the first market
+		im := entryImage(outDir, e)
+		for _, locale := range e.Locales[1:] {
+			im.Locale = locale
+			p := filepath.Join(outDir, filepath.FromSlash(layout.dir(im, e.Added)), path.Base(e.Path))
+			if !exists(p) {
+				linkCopy(outDir, e, p)
+			}
+		}
+	}
+}
+
+// planReorganize works out the new path of every image whose file is
+// there, giving names that clash a number as the fetch run does.
+func planReorganize(outDir string, cat *catalog, layout *organizeScheme) []reorgMove {
+	taken := make(map[string]bool)
+	for _, e := range cat.Images {
+		taken[strings.ToLower(e.Path)] = true
+	}
+	var moves []reorgMove
+	for _, e := range cat.Images {
+		if !exists(filepath.Join(outDir, filepath.FromSlash(e.Path))) {
+			continue
+		}
+		im := entryImage(outDir, e)
+		name := path.Base(e.Path)
+		if layout.renames() {
+			name = layout.fileName(im, firstNonEmpty(fileNameFromURL(e.URL), name), e.Added)
+		}
+		to := path.Join(layout.dir(im, e.Added), name)
+		if to == e.Path {
+			continue
+		}
+		// a file that moves away frees its name only once it is gone,
+		// which the staging step takes care of; compare without case for
+		// Windows and macOS
+		delete(taken, strings.ToLower(e.Path))
+		ext := path.Ext(to)
+		base := strings.TrimSuffix(to, ext)
+		for n := 2; taken[strings.ToLower(to)] || (exists(filepath.Join(outDir, filepath.FromSlash(to))) && cat.byPath(to) == nil); n++ {
+			to = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		taken[strings.ToLower(to)] = true
+		if to != e.Path {
+			moves = append(moves, reorgMove{From: e.Path, To: to})
+		}
+	}
+	return moves
+}
+
+// entryImage rebuilds what the source said about an image from its
+// catalog entry and attribution sidecar.
+func entryImage(outDir string, e *catalogEntry) spotImage {
+	im := spotImage{URL: e.URL, Title: e.Title, Location: e.Location, Description: e.Description, Copyright: e.Copyright, Source: e.Source, Published: e.Published}
+	if len(e.Locales) > 0 {
+		im.Locale = e.Locales[0]
+	}
+	if b, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(e.Path)) + ".json"); err == nil {
+		var sc sidecar
+		if json.Unmarshal(b, &sc) == nil {
+			im.Author = sc.Author
+		}
+	}
+	return im
+}
+
+func applyReorganize(outDir string, cat *catalog, moves []reorgMove) error {
+	b, err := json.MarshalIndent(moves, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(reorgJournalPath(outDir), b); err != nil {
+		return err
+	}
+	abs := func(rel string) string { return filepath.Join(outDir, filepath.FromSlash(rel)) }
+	for i, m := range moves {
+		if err := moveFile(abs(m.From), reorgStage(outDir, i)); err != nil {
+			return rollbackReorganize(outDir, moves, err)
+		}
+	}
+	for i, m := range moves {
+		if err := moveFile(reorgStage(outDir, i), abs(m.To)); err != nil {
+			return rollbackReorganize(outDir, moves, err)
+		}
+	}
+	for _, m := range moves {
+		cat.byPath(m.From).Path = m.To
+	}
+	if err := cat.save(); err != nil {
+		return rollbackReorganize(outDir, moves, err)
+	}
+	finishReorganize(outDir, moves)
+	return nil
+}
+
+// finishReorganize cleans up after the catalog has been saved.
+func finishReorganize(outDir string, moves []reorgMove) {
+	snapPath := filepath.Join(stateDir(outDir), "snapshot.json")
+	if b, err := os.ReadFile(snapPath); err == nil {
+		var snap map[string]snapshotFile
+		if json.Unmarshal(b, &snap) == nil {
+			moved := make(map[string]snapshotFile)
+			for _, m := range moves {
+				if f, ok := snap[m.From]; ok {
+					moved[m.To] = f
+					delete(snap, m.From)
+				}
+			}
+			for p, f := range moved {
+				snap[p] = f
+			}
+			if b, err := json.Marshal(snap); err == nil {
+				writeFileAtomic(snapPath, b)
+			}
+		}
+	}
+	for _, m := range moves {
+		removeEmptyDirs(outDir, filepath.Dir(filepath.Join(outDir, filepath.FromSlash(m.From))))
+	}
+	os.RemoveAll(filepath.Join(stateDir(outDir), "reorganize"))
+	os.Remove(reorgJournalPath(outDir))
+}
+
+// rollbackReorganize undoes the moves and explains why with cause.
+func rollbackReorganize(outDir string, moves []reorgMove, cause error) error {
+	if err := undoReorganize(outDir, moves); err != nil {
+		return fmt.Errorf("reorganize: %w; %w", cause, err)
+	}
+	return fmt.Errorf("reorganize: %w; all files are back in place", cause)
+}
+
+// undoReorganize moves every file back to where it was.
+func undoReorganize(outDir string, moves []reorgMove) error {
+	var failed []string
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		from := filepath.Join(outDir, filepath.FromSlash(m.From))
+		if exists(from) {
+			continue
+		}
+		for _, p := range []string{filepath.Join(outDir, filepath.FromSlash(m.To)), reorgStage(outDir, i)} {
+			if exists(p) {
+				if err := moveFile(p, from); err != nil {
+					failed = append(failed, m.From)
+				}
+				break
+			}
+		}
+	}
+	if len(failed) > 0 {
+		// keep the journal, so the next run tries again
+		return fmt.Errorf("could not move back %s", strings.Join(failed, ", "))
+	}
+	for _, m := range moves {
+		removeEmptyDirs(outDir, filepath.Dir(filepath.Join(outDir, filepath.FromSlash(m.To))))
+	}
+	os.RemoveAll(filepath.Join(stateDir(outDir), "reorganize"))
+	os.Remove(reorgJournalPath(outDir))
+	return nil
+}
+
+// recoverReorganize finishes or undoes a reorganize that was cut short,
+// depending on whether it got as far as saving the catalog.
+func recoverReorganize(outDir string) error {
+	b, err := os.ReadFile(reorgJournalPath(outDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var moves []reorgMove
+	if err := json.Unmarshal(b, &moves); err != nil {
+		return fmt.Errorf("%s: %w", reorgJournalPath(outDir), err)
+	}
+	cat, err := openCatalog(outDir)
+	if err != nil {
+		return err
+	}
+	if len(moves) > 0 && cat.byPath(moves[0].To) != nil && cat.byPath(moves[0].From) == nil {
+		slog.Info("reorganize: finishing the previous run")
+		finishReorganize(outDir, moves)
+		return nil
+	}
+	slog.Warn("reorganize: the previous run was interrupted, moving files back")
+	if err := undoReorganize(outDir, moves); err != nil {
+		return fmt.Errorf("reorganize: %w", err)
+	}
+	return nil
+}
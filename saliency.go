@@ -0,0 +1,70 @@
+//go:build saliency
+
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+func init() {
+	registerFeature(&feature{name: "saliency", desc: "saliency-aware cropping", tag: "saliency", built: true})
+}
+
+// saliencyCrop picks the crop of the given aspect ratio (width/height) that
+// holds the most edge energy, a cheap stand-in for "where the subject is".
+func saliencyCrop(img image.Image, aspect float64) (image.Rectangle, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	cw, ch := w, int(float64(w)/aspect)
+	if ch > h {
+		cw, ch = int(float64(h)*aspect), h
+	}
+	if cw == w && ch == h {
+		return b, nil
+	}
+
+	// energy summed along the axis that does not move
+	horizontal := cw < w
+	n := h
+	if horizontal {
+		n = w
+	}
+	energy := make([]float64, n)
+	lum := func(x, y int) float64 {
+		return float64(color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y)
+	}
+	const step = 2 // sampling every other pixel is plenty
+	for y := 1; y < h-1; y += step {
+		for x := 1; x < w-1; x += step {
+			gx := lum(x+1, y) - lum(x-1, y)
+			gy := lum(x, y+1) - lum(x, y-1)
+			e := gx*gx + gy*gy
+			if horizontal {
+				energy[x] += e
+			} else {
+				energy[y] += e
+			}
+		}
+	}
+
+	size := ch
+	if horizontal {
+		size = cw
+	}
+	var sum float64
+	for i := 0; i < size; i++ {
+		sum += energy[i]
+	}
+	best, bestAt := sum, 0
+	for i := size; i < n; i++ {
+		sum += energy[i] - energy[i-size]
+		if sum > best {
+			best, bestAt = sum, i-size+1
+		}
+	}
+	if horizontal {
+		return image.Rect(b.Min.X+bestAt, b.Min.Y, b.Min.X+bestAt+cw, b.Min.Y+ch), nil
+	}
+	return image.Rect(b.Min.X, b.Min.Y+bestAt, b.Min.X+cw, b.Min.Y+bestAt+ch), nil
+}
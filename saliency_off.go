@@ -0,0 +1,13 @@
+//go:build !saliency
+
+package main
+
+import "image"
+
+func init() {
+	registerFeature(&feature{name: "saliency", desc: "saliency-aware cropping", tag: "saliency"})
+}
+
+func saliencyCrop(img image.Image, aspect float64) (image.Rectangle, error) {
+	return image.Rectangle{}, requireFeature("saliency")
+}
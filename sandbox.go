@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sandboxPolicy is what a sandboxed run may still do once restricted.
+type sandboxPolicy struct {
+	ReadWrite []string // archive and state
+	ReadOnly  []string // system config, CA bundles, time zones
+	TCPPorts  []uint16 // outbound connect ports
+}
+
+// fetchSandboxPolicy allows the output directory, the files TLS and DNS
+// need, and HTTPS (plus HTTP for the portal probe and the proxy's port).
+func fetchSandboxPolicy(outDir string, portalCheck bool, proxy string, extraRead ...string) sandboxPolicy {
+	p := sandboxPolicy{
+		ReadWrite: []string{outDir},
+		TCPPorts:  []uint16{443},
+	}
+	if d := localStateDir(outDir); exists(d) {
+		p.ReadWrite = append(p.ReadWrite, d)
+	}
+	for _, d := range []string{"/etc", "/usr/share/ca-certificates", "/usr/share/zoneinfo", "/usr/local/share/ca-certificates"} {
+		if exists(d) {
+			p.ReadOnly = append(p.ReadOnly, d)
+		}
+	}
+	// Landlock checks where a link leads, not the link: resolv.conf on
+	// systemd-resolved hosts and CA bundles on some distributions point
+	// out of /etc
+	var links []string
+	for _, d := range sandboxCertDirs {
+		entries, _ := os.ReadDir(d)
+		for _, e := range entries {
+			links = append(links, filepath.Join(d, e.Name()))
+		}
+	}
+	p.ReadOnly = append(p.ReadOnly, linkTargetDirs(append(links, sandboxSystemFiles...), p.ReadOnly)...)
+	for _, f := range extraRead {
+		if f != "" {
+			if abs, err := filepath.Abs(f); err == nil {
+				p.ReadOnly = append(p.ReadOnly, abs)
+			}
+		}
+	}
+	if portalCheck {
+		p.TCPPorts = append(p.TCPPorts, 80)
+	}
+	if proxy == "" {
+		proxy = firstEnv("HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy")
+	}
+	if proxy != "" {
+		if u, err := parseProxyURL(proxy); err == nil {
+			port := u.Port()
+			if port == "" {
+				port = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[u.Scheme]
+			}
+			if n, err := strconv.ParseUint(port, 10, 16); err == nil {
+				p.TCPPorts = append(p.TCPPorts, uint16(n))
+			}
+		}
+	}
+	return p
+}
+
+// sandboxSystemFiles are the files in /etc a fetch reads: name
+// resolution, time zone and the CA bundles crypto/x509 looks for.
+var sandboxSystemFiles = []string{
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/localtime",
+	"/etc/ssl/certs/ca-certificates.crt", "/etc/pki/tls/certs/ca-bundle.crt", "/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem", "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", "/etc/ssl/cert.pem",
+}
+
+// sandboxCertDirs hold a link per CA certificate on some distributions.
+var sandboxCertDirs = []string{"/etc/ssl/certs", "/etc/pki/tls/certs"}
+
+// linkTargetDirs returns the directories that files resolve into, where
+// those are not within allowed already. Missing files are left out.
+func linkTargetDirs(files, allowed []string) []string {
+	var dirs []string
+	for _, f := range files {
+		real, err := filepath.EvalSymlinks(f)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(real)
+		if !slices.ContainsFunc(slices.Concat(allowed, dirs), func(a string) bool { return within(dir, a) }) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// sandboxBlocked is implemented by notification channels that -sandbox can
+// stop: it returns why, given the TCP ports the sandbox allows, or "".
+type sandboxBlocked interface {
+	sandboxBlocked(ports []uint16) string
+}
+
+// sandbox fits r to a sandbox that allows ports: the desktop prompt of the
+// default routing is dropped, since it runs a command, and channels the
+// user configured that cannot work are an error rather than a warning on
+// every run.
+func (r *notifyRouter) sandbox(ports []uint16) error {
+	if r == nil {
+		return nil
+	}
+	if r.quiet {
+		clear(r.routes)
+		return nil
+	}
+	var blocked []string
+	for _, name := range slices.Sorted(maps.Keys(r.channels)) {
+		if b, ok := r.channels[name].(sandboxBlocked); ok {
+			if why := b.sandboxBlocked(ports); why != "" {
+				blocked = append(blocked, name+" ("+why+")")
+			}
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Errorf("-sandbox does not allow the notification channels %s", strings.Join(blocked, ", "))
+	}
+	return nil
+}
+
+// portBlocked says why a connection to the port of u is not allowed, or "".
+func portBlocked(u *url.URL, ports []uint16) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "tcp": "1883", "ssl": "8883"}[u.Scheme]
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || !slices.Contains(ports, uint16(n)) {
+		return "connects to port " + port
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock (Linux 5.13+) restricts file access, and since ABI 4 (6.7) TCP
+// connect ports, for this process and its children. It is applied to
+// every OS thread with AllThreadsSyscall, which requires a CGO_ENABLED=0
+// build, as the release binaries are.
+
+const (
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+	landlockRuleNetPort          = 2
+
+	llFsExecute    = 1 << 0
+	llFsWriteFile  = 1 << 1
+	llFsReadFile   = 1 << 2
+	llFsReadDir    = 1 << 3
+	llFsRemoveDir  = 1 << 4
+	llFsRemoveFile = 1 << 5
+	llFsMakeChar   = 1 << 6
+	llFsMakeDir    = 1 << 7
+	llFsMakeReg    = 1 << 8
+	llFsMakeSock   = 1 << 9
+	llFsMakeFifo   = 1 << 10
+	llFsMakeBlock  = 1 << 11
+	llFsMakeSym    = 1 << 12
+	llFsRefer      = 1 << 13 // ABI 2
+	llFsTruncate   = 1 << 14 // ABI 3
+
+	llNetBindTCP    = 1 << 0 // ABI 4
+	llNetConnectTCP = 1 << 1
+
+	prSetNoNewPrivs = 38
+	oPath           = 0x200000
+)
+
+// landlockABI reports the kernel's Landlock ABI version.
+func landlockABI() (uintptr, error) {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, fmt.Errorf("sandbox: Landlock unavailable: %w", errno)
+	}
+	return abi, nil
+}
+
+func sandboxSupported() error {
+	_, err := landlockABI()
+	return err
+}
+
+func enterSandbox(p sandboxPolicy) error {
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+
+	handledFs := uint64(llFsExecute | llFsWriteFile | llFsReadFile | llFsReadDir | llFsRemoveDir |
+		llFsRemoveFile | llFsMakeChar | llFsMakeDir | llFsMakeReg | llFsMakeSock | llFsMakeFifo |
+		llFsMakeBlock | llFsMakeSym)
+	rw := uint64(llFsWriteFile | llFsReadFile | llFsReadDir | llFsRemoveDir | llFsRemoveFile |
+		llFsMakeDir | llFsMakeReg | llFsMakeSym)
+	if abi >= 2 {
+		handledFs |= llFsRefer
+		rw |= llFsRefer
+	}
+	if abi >= 3 {
+		handledFs |= llFsTruncate
+		rw |= llFsTruncate
+	}
+	ro := uint64(llFsReadFile | llFsReadDir)
+
+	attr := binary.NativeEndian.AppendUint64(nil, handledFs)
+	if abi >= 4 {
+		attr = binary.NativeEndian.AppendUint64(attr, llNetBindTCP|llNetConnectTCP)
+	}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr[0])), uintptr(len(attr)), 0)
+	if errno != 0 {
+		return fmt.Errorf("sandbox: create ruleset: %w", errno)
+	}
+	defer syscall.Close(int(fd))
+
+	for _, path := range p.ReadWrite {
+		if err := landlockAllowPath(int(fd), path, rw); err != nil {
+			return err
+		}
+	}
+	for _, path := range p.ReadOnly {
+		if err := landlockAllowPath(int(fd), path, ro); err != nil {
+			return err
+		}
+	}
+	if abi >= 4 {
+		for _, port := range p.TCPPorts {
+			rule := binary.NativeEndian.AppendUint64(nil, llNetConnectTCP)
+			rule = binary.NativeEndian.AppendUint64(rule, uint64(port))
+			if _, _, errno := syscall.Syscall6(sysLandlockAddRule, fd, landlockRuleNetPort, uintptr(unsafe.Pointer(&rule[0])), 0, 0, 0); errno != 0 {
+				return fmt.Errorf("sandbox: allow port %d: %w", port, errno)
+			}
+		}
+	}
+
+	if _, _, errno := syscall.AllThreadsSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		if errno == syscall.ENOTSUP {
+			return errors.New("sandbox: needs a CGO_ENABLED=0 build")
+		}
+		return fmt.Errorf("sandbox: no_new_privs: %w", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("sandbox: restrict: %w", errno)
+	}
+	return nil
+}
+
+func landlockAllowPath(rulesetFd int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("sandbox: %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return err
+	}
+	// directory-only rights are rejected on files
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= llFsWriteFile | llFsReadFile | llFsTruncate
+	}
+	// struct landlock_path_beneath_attr is packed: u64 then s32
+	rule := binary.NativeEndian.AppendUint64(nil, access)
+	rule = binary.NativeEndian.AppendUint32(rule, uint32(fd))
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule[0])), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("sandbox: allow %s: %w", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+func sandboxSupported() error {
+	return errors.New("-sandbox is not supported on " + runtime.GOOS + " (Linux Landlock only)")
+}
+
+func enterSandbox(sandboxPolicy) error {
+	return sandboxSupported()
+}
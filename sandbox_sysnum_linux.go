@@ -0,0 +1,11 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package main
+
+// Landlock's system calls. Since Linux 5.1 a new system call has the same
+// number on every architecture, except that MIPS adds its ABI's offset.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+)
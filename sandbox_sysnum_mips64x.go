@@ -0,0 +1,10 @@
+//go:build linux && (mips64 || mips64le)
+
+package main
+
+// The n64 ABI numbers system calls from 5000.
+const (
+	sysLandlockCreateRuleset = 5444
+	sysLandlockAddRule       = 5445
+	sysLandlockRestrictSelf  = 5446
+)
@@ -0,0 +1,10 @@
+//go:build linux && (mips || mipsle)
+
+package main
+
+// The o32 ABI numbers system calls from 4000.
+const (
+	sysLandlockCreateRuleset = 4444
+	sysLandlockAddRule       = 4445
+	sysLandlockRestrictSelf  = 4446
+)
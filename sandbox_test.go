@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLinkTargetDirs(t *testing.T) {
+	root := t.TempDir()
+	etc := filepath.Join(root, "etc")
+	run := filepath.Join(root, "run", "resolve")
+	for _, d := range []string{etc, run} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(run, "stub-resolv.conf"), nil, 0o644)
+	os.WriteFile(filepath.Join(etc, "hosts"), nil, 0o644)
+	os.Symlink(filepath.Join(run, "stub-resolv.conf"), filepath.Join(etc, "resolv.conf"))
+	os.Symlink("hosts", filepath.Join(etc, "hosts.link"))
+
+	files := []string{
+		filepath.Join(etc, "resolv.conf"),
+		filepath.Join(etc, "hosts"),
+		filepath.Join(etc, "hosts.link"),
+		filepath.Join(etc, "missing"),
+	}
+	real, err := filepath.EvalSymlinks(run) // the temp dir may be behind a link itself
+	if err != nil {
+		t.Fatal(err)
+	}
+	realEtc, _ := filepath.EvalSymlinks(etc)
+	got := linkTargetDirs(files, []string{realEtc})
+	if !slices.Equal(got, []string{real}) {
+		t.Errorf("linkTargetDirs = %q, want %q", got, real)
+	}
+}
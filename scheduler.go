@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// The scheduler integration keeps exactly one entry owned by spotlightdl:
+// a crontab line tagged with cronMarker, or the "spotlightdl" task in the
+// Windows Task Scheduler.
+
+const (
+	cronMarker   = "# spotlightdl-apply"
+	windowsTask  = "spotlightdl"
+	defaultDaily = "07:00"
+)
+
+// cronSchedule turns "hourly", "daily", "daily@HH:MM" or a five-field cron
+// expression into a cron expression.
+func cronSchedule(s string) (string, error) {
+	switch {
+	case s == "hourly":
+		return "0 * * * *", nil
+	case s == "daily" || strings.HasPrefix(s, "daily@"):
+		h, m, err := dailyTime(s)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d %d * * *", m, h), nil
+	case len(strings.Fields(s)) == 5:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid schedule %q (want hourly, daily, daily@HH:MM or a cron expression)", s)
+}
+
+func dailyTime(s string) (hour, minute int, err error) {
+	at := defaultDaily
+	if _, t, ok := strings.Cut(s, "@"); ok {
+		at = t
+	}
+	if _, err := fmt.Sscanf(at, "%d:%d", &hour, &minute); err != nil || hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time in schedule %q", s)
+	}
+	return hour, minute, nil
+}
+
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func windowsQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// installSchedule makes the scheduler entry match (schedule, argv); an
+// empty schedule removes it. It reports whether anything changed.
+func installSchedule(schedule string, argv []string, prev schedulerState, dryRun bool) (bool, error) {
+	if runtime.GOOS == "windows" {
+		return installWindowsTask(schedule, argv, prev, dryRun)
+	}
+	return installCron(schedule, argv, dryRun)
+}
+
+func installCron(schedule string, argv []string, dryRun bool) (bool, error) {
+	out, err := exec.Command("crontab", "-l").Output()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return false, err // no crontab binary; "no crontab for user" exits 1
+	}
+	var kept []string
+	var current string
+	for _, l := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if strings.HasSuffix(l, cronMarker) {
+			current = l
+			continue
+		}
+		if l != "" || len(kept) > 0 {
+			kept = append(kept, l)
+		}
+	}
+
+	var want string
+	if schedule != "" {
+		expr, err := cronSchedule(schedule)
+		if err != nil {
+			return false, err
+		}
+		quoted := make([]string, len(argv))
+		for i, a := range argv {
+			quoted[i] = shellQuote(a)
+		}
+		want = expr + " " + strings.Join(quoted, " ") + " " + cronMarker
+	}
+	if want == current {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	if want != "" {
+		kept = append(kept, want)
+	}
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(kept, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("crontab: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return true, nil
+}
+
+func installWindowsTask(schedule string, argv []string, prev schedulerState, dryRun bool) (bool, error) {
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		quoted[i] = windowsQuote(a)
+	}
+	command := strings.Join(quoted, " ")
+	present := exec.Command("schtasks", "/Query", "/TN", windowsTask).Run() == nil
+
+	if schedule == "" {
+		if !present {
+			return false, nil
+		}
+		if dryRun {
+			return true, nil
+		}
+		return true, runSchtasks("/Delete", "/F", "/TN", windowsTask)
+	}
+	if present && prev.Schedule == schedule && prev.Command == command {
+		return false, nil
+	}
+	args := []string{"/Create", "/F", "/TN", windowsTask, "/TR", command}
+	switch {
+	case schedule == "hourly":
+		args = append(args, "/SC", "HOURLY")
+	case schedule == "daily" || strings.HasPrefix(schedule, "daily@"):
+		h, m, err := dailyTime(schedule)
+		if err != nil {
+			return false, err
+		}
+		args = append(args, "/SC", "DAILY", "/ST", fmt.Sprintf("%02d:%02d", h, m))
+	default:
+		return false, fmt.Errorf("schedule %q: Task Scheduler supports hourly, daily or daily@HH:MM", schedule)
+	}
+	if dryRun {
+		return true, nil
+	}
+	return true, runSchtasks(args...)
+}
+
+func runSchtasks(args ...string) error {
+	out, err := exec.Command("schtasks", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("schtasks: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
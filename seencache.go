@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// seenCache replaces the catalog in -lite runs: the file names of every
+// image ever downloaded, one per line in .spotlightdl/seen.txt. Names are
+// appended as downloads finish, so an interrupted run loses nothing and
+// memory stays at one short string per image. A nil cache knows nothing.
+type seenCache struct {
+	path  string
+	names map[string]struct{}
+}
+
+func openSeenCache(outDir string) (*seenCache, error) {
+	c := &seenCache{path: filepath.Join(stateDir(outDir), "seen.txt"), names: map[string]struct{}{}}
+	f, err := os.Open(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if name := strings.TrimSpace(sc.Text()); name != "" {
+			c.names[name] = struct{}{}
+		}
+	}
+	return c, sc.Err()
+}
+
+func (c *seenCache) has(name string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.names[name]
+	return ok
+}
+
+func (c *seenCache) add(name string) error {
+	if c == nil || c.has(name) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(name + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		c.names[name] = struct{}{}
+	}
+	return err
+}
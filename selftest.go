@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func init() {
+	registerCommand("selftest", cmdSelftest)
+}
+
+// selftestStep is one stage of the end-to-end check.
+type selftestStep struct {
+	Name   string
+	Detail string
+	Took   time.Duration
+	Err    error
+}
+
+// runSelftest fetches one image from the live Spotlight API into a
+// temporary library and checks every stage a normal run goes through:
+// API and parsing, download and hashing, decoding, the catalog, and
+// cleanup. It stops at the first failing step.
+func runSelftest(ctx context.Context, opts transportOptions, localeSpec string) []selftestStep {
+	var dir string
+	defer func() {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+	}()
+	var (
+		im   spotImage
+		path string
+		sum  string
+	)
+	client, err := newHTTPClient(opts)
+	if err != nil {
+		return []selftestStep{{Name: "http client", Err: err}}
+	}
+	locale, country := resolveLocale(localeSpec)
+
+	stages := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{"spotlight api", func() (string, error) {
+			srcs, err := newSources("spotlight", sourceConfig{Client: client, Locale: locale, Country: country, LocaleFallback: []string{"en-US"}})
+			if err != nil {
+				return "", err
+			}
+			// empty batches happen; the source falls back after a few
+			for range emptyBeforeFallback + 2 {
+				imgs, err := srcs[0].Fetch(ctx)
+				if err != nil {
+					return "", err
+				}
+				if len(imgs) > 0 {
+					im = imgs[0]
+					im.Source = "spotlight"
+					return fmt.Sprintf("%d images for %s, %q", len(imgs), im.Locale, im.Title), nil
+				}
+			}
+			return "", errors.New("no images returned; the response format may have changed")
+		}},
+		{"download", func() (string, error) {
+			dir, err = os.MkdirTemp("", "spotlightdl-selftest-")
+			if err != nil {
+				return "", err
+			}
+			name := firstNonEmpty(im.FileName, "selftest.jpg")
+			path = filepath.Join(dir, name)
+			sum, err = download(ctx, client, im.URL, path, false, nil)
+			if err != nil {
+				return "", err
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s, sha256 %s", formatBytes(fi.Size()), sum[:12]), nil
+		}},
+		{"decode", func() (string, error) {
+			img, err := decodeImage(path)
+			if err != nil {
+				return "", err
+			}
+			b := img.Bounds()
+			if b.Dx() <= b.Dy() {
+				return "", fmt.Errorf("%dx%d is not landscape", b.Dx(), b.Dy())
+			}
+			return fmt.Sprintf("%dx%d", b.Dx(), b.Dy()), nil
+		}},
+		{"catalog", func() (string, error) {
+			cat, err := openCatalog(dir)
+			if err != nil {
+				return "", err
+			}
+			recordDownload(cat, dir, path, sum, im)
+			if err := cat.save(); err != nil {
+				return "", err
+			}
+			again, err := openCatalog(dir)
+			if err != nil {
+				return "", err
+			}
+			e := again.bySHA(sum)
+			if e == nil || e.Title != im.Title || e.Width == 0 {
+				return "", errors.New("entry did not survive a save and reload")
+			}
+			return e.Path, nil
+		}},
+		{"cleanup", func() (string, error) {
+			if err := os.RemoveAll(dir); err != nil {
+				return "", err
+			}
+			if exists(dir) {
+				return "", fmt.Errorf("%s still exists", dir)
+			}
+			dir = ""
+			return "", nil
+		}},
+	}
+
+	var steps []selftestStep
+	for _, st := range stages {
+		start := time.Now()
+		detail, err := st.run()
+		steps = append(steps, selftestStep{Name: st.name, Detail: detail, Took: time.Since(start), Err: err})
+		if err != nil {
+			break
+		}
+	}
+	return steps
+}
+
+func cmdSelftest(args []string) error {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	localeFlag := flags.String("locale", "", "locale like en-US (defaults from $LANG)")
+	proxy := flags.String("proxy", "", "proxy URL (default from $HTTPS_PROXY/$HTTP_PROXY)")
+	caFile := flags.String("ca-file", "", "additional trusted CA certificates (PEM)")
+	timeout := flags.Duration("timeout", 2*time.Minute, "give up after this long")
+	parseFlags(flags, args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	start := time.Now()
+	steps := runSelftest(ctx, transportOptions{Proxy: *proxy, CAFile: *caFile}, *localeFlag)
+	failed := false
+	for _, s := range steps {
+		status, detail := "ok", s.Detail
+		if s.Err != nil {
+			status, detail, failed = "FAIL", s.Err.Error(), true
+		}
+		fmt.Printf("%-14s %-4s %8s  %s\n", s.Name, status, s.Took.Round(time.Millisecond), detail)
+	}
+	if failed {
+		return fmt.Errorf("selftest failed after %s", time.Since(start).Round(time.Millisecond))
+	}
+	fmt.Printf("PASS (%s)\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
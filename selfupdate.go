@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set by the release workflow through -ldflags "-X main.version=...
+// -X main.releaseSigningKey=...". Builds without a key refuse to update
+// themselves rather than trust unsigned downloads.
+var (
+	version           = "dev"
+	releaseSigningKey = ""
+)
+
+const releasesAPI = "https://api.github.com/repos/drzo1dberg/spotlightDlGo/releases"
+
+type ghRelease struct {
+	TagName    string `json:"tag_name"`
+	Prerelease bool   `json:"prerelease"`
+	Draft      bool   `json:"draft"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func init() {
+	registerCommand("self-update", cmdSelfUpdate)
+	registerCommand("version", func([]string) error {
+		fmt.Println(version)
+		return nil
+	})
+}
+
+func cmdSelfUpdate(args []string) error {
+	flags := flag.NewFlagSet("self-update", flag.ExitOnError)
+	channel := flags.String("channel", "stable", "release channel: stable or beta (beta includes pre-releases)")
+	checkOnly := flags.Bool("check-only", false, "only report whether an update is available")
+	parseFlags(flags, args)
+	if *channel != "stable" && *channel != "beta" {
+		return fmt.Errorf("self-update: unknown channel %q", *channel)
+	}
+
+	client, err := newHTTPClient(transportOptions{})
+	if err != nil {
+		return err
+	}
+	client.Timeout = 5 * time.Minute
+
+	rel, err := latestRelease(client, *channel == "beta")
+	if err != nil {
+		return err
+	}
+	if compareVersions(rel.TagName, version) <= 0 {
+		fmt.Printf("up to date (%s, %s channel)\n", version, *channel)
+		return nil
+	}
+	if *checkOnly {
+		fmt.Printf("update available: %s -> %s\n", version, rel.TagName)
+		return nil
+	}
+	if releaseSigningKey == "" {
+		return errors.New("self-update: this build has no release signing key embedded; download releases manually")
+	}
+
+	asset := "spotlight-api-fetcher_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		asset += ".exe"
+	}
+	var binURL, sigURL string
+	for _, a := range rel.Assets {
+		switch a.Name {
+		case asset:
+			binURL = a.URL
+		case asset + ".minisig":
+			sigURL = a.URL
+		}
+	}
+	if binURL == "" || sigURL == "" {
+		return fmt.Errorf("self-update: %s has no signed build for %s/%s", rel.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+
+	bin, err := fetchBytes(client, binURL, 256<<20)
+	if err != nil {
+		return err
+	}
+	sig, err := fetchBytes(client, sigURL, 4096)
+	if err != nil {
+		return err
+	}
+	trusted, err := minisignVerify(releaseSigningKey, bin, sig)
+	if err != nil {
+		return err
+	}
+	// the signed comment pins tag and file, so an older signed binary
+	// cannot be served as a newer release
+	if f := strings.Fields(trusted); len(f) < 3 || f[1] != rel.TagName || f[2] != asset {
+		return fmt.Errorf("self-update: signature is for %q, not %s %s", trusted, rel.TagName, asset)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := installBinary(exe, bin, rel.TagName); err != nil {
+		return err
+	}
+	fmt.Printf("updated %s -> %s\n", version, rel.TagName)
+	return nil
+}
+
+func latestRelease(client *http.Client, beta bool) (*ghRelease, error) {
+	b, err := fetchBytes(client, releasesAPI+"?per_page=30", 4<<20)
+	if err != nil {
+		return nil, err
+	}
+	var rels []ghRelease
+	if err := json.Unmarshal(b, &rels); err != nil {
+		return nil, err
+	}
+	var best *ghRelease
+	for i := range rels {
+		r := &rels[i]
+		if r.Draft || (r.Prerelease && !beta) {
+			continue
+		}
+		if best == nil || compareVersions(r.TagName, best.TagName) > 0 {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil, errors.New("self-update: no release found")
+	}
+	return best, nil
+}
+
+func fetchBytes(client *http.Client, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: http %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// installBinary swaps exe for the new build and runs it once; if it does
+// not report the expected version the previous binary is put back.
+func installBinary(exe string, bin []byte, want string) error {
+	newPath, oldPath := exe+".new", exe+".old"
+	if err := os.WriteFile(newPath, bin, 0o755); err != nil {
+		return err
+	}
+	os.Remove(oldPath)
+	// renaming works even for a running executable on Windows
+	if err := os.Rename(exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		os.Rename(oldPath, exe)
+		return err
+	}
+	if err := healthCheck(exe, want); err != nil {
+		os.Remove(exe)
+		if rerr := os.Rename(oldPath, exe); rerr != nil {
+			return fmt.Errorf("health check failed (%v) and rollback failed: %w", err, rerr)
+		}
+		return fmt.Errorf("new version failed health check, rolled back: %w", err)
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(oldPath)
+	}
+	return nil
+}
+
+func healthCheck(exe, want string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, exe, "version").Output()
+	if err != nil {
+		return err
+	}
+	if got := strings.TrimSpace(string(out)); got != want {
+		return fmt.Errorf("reports version %q", got)
+	}
+	return nil
+}
+
+// compareVersions orders tags like v1.2.3 and v1.3.0-beta.1; anything
+// unparsable (such as "dev") sorts first.
+func compareVersions(a, b string) int {
+	pa, prea, oka := parseVersion(a)
+	pb, preb, okb := parseVersion(b)
+	switch {
+	case !oka && !okb:
+		return 0
+	case !oka:
+		return -1
+	case !okb:
+		return 1
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case prea == preb:
+		return 0
+	case prea == "":
+		return 1
+	case preb == "":
+		return -1
+	}
+	return strings.Compare(prea, preb)
+}
+
+func parseVersion(s string) (nums [3]int, pre string, ok bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return nums, "", false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nums, "", false
+		}
+		nums[i] = n
+	}
+	return nums, pre, true
+}
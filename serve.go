@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const galleryPageSize = 60
+
+func init() {
+	registerCommand("serve", cmdServe)
+}
+
+// library is the catalog as seen by a long-running server: reloaded
+// whenever catalog.json changes on disk, e.g. after a fetch run.
+type library struct {
+	outDir string
+
+	mu    sync.Mutex
+	cat   *catalog
+	mtime time.Time
+}
+
+func newLibrary(outDir string) *library {
+	return &library{outDir: outDir}
+}
+
+// current returns the catalog, reloading it if the file has changed.
+func (l *library) current() (*catalog, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fi, err := os.Stat(filepath.Join(stateDir(l.outDir), "catalog.json"))
+	if l.cat != nil && (err != nil || fi.ModTime().Equal(l.mtime)) {
+		return l.cat, nil
+	}
+	cat, err := openCatalog(l.outDir)
+	if err != nil {
+		return nil, err
+	}
+	l.cat = cat
+	if fi != nil {
+		l.mtime = fi.ModTime()
+	}
+	return cat, nil
+}
+
+// update applies fn to a freshly loaded catalog and saves it if fn
+// succeeds, so concurrent requests never overwrite each other. Another
+// run working on the library is a *lockedError.
+func (l *library) update(fn func(*catalog) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, err := lockLibrary(context.Background(), l.outDir, "daemon", 0)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(l.outDir)
+	if err != nil {
+		return err
+	}
+	if err := fn(cat); err != nil {
+		return err
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	l.cat = cat
+	if fi, err := os.Stat(filepath.Join(stateDir(l.outDir), "catalog.json")); err == nil {
+		l.mtime = fi.ModTime()
+	}
+	return nil
+}
+
+func (l *library) bySHA(sum string) *catalogEntry {
+	cat, err := l.current()
+	if err != nil {
+		return nil
+	}
+	return cat.bySHA(sum)
+}
+
+func cmdServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	listen := flags.String("listen", ":8080", "address to serve the gallery on")
+	healthAge := flags.Duration("health-max-age", 0, "report unhealthy on /healthz when no fetch succeeded for this long (0 = never)")
+	favoritesOnly := flags.Bool("favorites-only", false, "only show favorites in the gallery")
+	edit := flags.Bool("edit", false, "let browsers logged in with $SPOTLIGHTDL_SERVE_TOKEN tag, favorite and block images")
+	parseFlags(flags, args)
+
+	lib := newLibrary(*outDir)
+	if _, err := lib.current(); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	var editor *galleryEditor
+	if *edit {
+		token := strings.TrimSpace(os.Getenv("SPOTLIGHTDL_SERVE_TOKEN"))
+		if token == "" {
+			return errors.New("serve: -edit needs a token in $SPOTLIGHTDL_SERVE_TOKEN")
+		}
+		editor = newGalleryEditor(lib, token)
+		editor.register(mux)
+	}
+	registerGallery(mux, lib, *favoritesOnly, editor)
+	mux.HandleFunc("GET /metrics", metricsHandler(lib, nil))
+	mux.HandleFunc("GET /healthz", healthHandler(*outDir, *healthAge, nil))
+	fmt.Printf("serving %s on %s\n", *outDir, *listen)
+	srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
+
+// registerGallery adds the gallery's pages; with an editor, they have
+// editing controls for browsers that are logged in.
+func registerGallery(mux *http.ServeMux, lib *library, favoritesOnly bool, editor *galleryEditor) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		cat, err := lib.current()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		var hits []*catalogEntry
+		for _, e := range cat.Images {
+			if (!favoritesOnly || e.Favorite) && matchesQuery(e, q) {
+				hits = append(hits, e)
+			}
+		}
+		slices.SortStableFunc(hits, func(a, b *catalogEntry) int { return b.Added.Compare(a.Added) })
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		from := min((page-1)*galleryPageSize, len(hits))
+		to := min(from+galleryPageSize, len(hits))
+		data := map[string]any{
+			"Query":  q,
+			"Total":  len(hits),
+			"Images": hits[from:to],
+			"Page":   page,
+			"Prev":   page - 1,
+			"Next":   0,
+			"Edit":   editor.authorized(r),
+			"Login":  editor != nil,
+			"Back":   r.URL.RequestURI(),
+		}
+		if to < len(hits) {
+			data["Next"] = page + 1
+		}
+		render(w, galleryTmpl, data)
+	})
+
+	mux.HandleFunc("GET /feed.xml", feedHandler(lib, favoritesOnly))
+
+	mux.HandleFunc("GET /image/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		e := lib.bySHA(r.PathValue("sha"))
+		if e == nil {
+			http.NotFound(w, r)
+			return
+		}
+		render(w, imageTmpl, struct {
+			*catalogEntry
+			Edit bool
+			Back string
+		}{e, editor.authorized(r), r.URL.RequestURI()})
+	})
+
+	mux.HandleFunc("GET /raw/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		e := lib.bySHA(r.PathValue("sha"))
+		if e == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Has("download") {
+			w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(filepath.Base(e.Path), `"`, "")+`"`)
+		}
+		http.ServeFile(w, r, filepath.Join(lib.outDir, filepath.FromSlash(e.Path)))
+	})
+
+	mux.HandleFunc("GET /thumb/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		e := lib.bySHA(r.PathValue("sha"))
+		if e == nil {
+			http.NotFound(w, r)
+			return
+		}
+		p, err := ensureThumb(lib.outDir, e)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=86400")
+		http.ServeFile(w, r, p)
+	})
+}
+
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var tmplFuncs = template.FuncMap{
+	"stars": stars,
+	"bytes": formatBytes,
+	"date":  func(t time.Time) string { return t.Local().Format("2006-01-02") },
+	"join":  strings.Join,
+}
+
+const galleryStyle = `<style>
+body{margin:0;font:15px system-ui,sans-serif;background:#111;color:#ddd}
+a{color:#9cf;text-decoration:none}
+header{padding:12px 20px;display:flex;gap:20px;align-items:center;background:#1b1b1b}
+header input{flex:1;max-width:420px;padding:6px 10px;border:0;border-radius:4px;background:#2a2a2a;color:#eee}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(260px,1fr));gap:10px;padding:20px}
+.grid a{display:block;background:#1b1b1b;border-radius:4px;overflow:hidden}
+.grid img{width:100%;aspect-ratio:16/9;object-fit:cover;display:block}
+.grid span{display:block;padding:6px 8px;font-size:13px;white-space:nowrap;overflow:hidden;text-overflow:ellipsis}
+nav{padding:0 20px 20px;display:flex;gap:20px}
+.detail{padding:20px}.detail img{max-width:100%;border-radius:4px}
+dl{display:grid;grid-template-columns:max-content 1fr;gap:4px 16px}dt{color:#888}
+.tile{position:relative}.tile input{position:absolute;top:8px;left:8px;width:20px;height:20px}
+.edit{padding:12px 20px 0;display:flex;gap:10px;align-items:center}
+.edit input,.edit select,header button{padding:5px 8px;border:0;border-radius:4px;background:#2a2a2a;color:#eee}
+</style>`
+
+// ratingSelect picks a rating for the rate action of the editing mode.
+const ratingSelect = `<select name="rating"><option value="5">★★★★★</option><option value="4">★★★★☆</option>` +
+	`<option value="3">★★★☆☆</option><option value="2">★★☆☆☆</option><option value="1">★☆☆☆☆</option><option value="0">no rating</option></select>`
+
+var galleryTmpl = template.Must(template.New("gallery").Funcs(tmplFuncs).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width">
+<title>spotlightdl gallery</title><link rel="alternate" type="application/atom+xml" title="new images" href="/feed.xml">` + galleryStyle + `</head><body>
+<header><a href="/"><b>spotlightdl</b></a>
+<form action="/"><input name="q" value="{{.Query}}" placeholder="search titles, places, tags"></form>
+<span>{{.Total}} images</span>
+{{if .Edit}}<form method="post" action="/logout"><button>log out</button></form>{{else if .Login}}<a href="/login">log in to edit</a>{{end}}</header>
+{{if .Edit}}<form method="post" action="/edit"><div class="edit">
+<input type="hidden" name="back" value="{{.Back}}">
+<select name="action"><option value="tag">tag</option><option value="rate">rate</option><option value="favorite">favorite</option><option value="unfavorite">unfavorite</option><option value="block">block</option></select>
+<input name="tags" placeholder="tags: a, b, -c">` + ratingSelect + `<button>apply to the ticked images</button></div>{{end}}
+<div class="grid">{{range .Images}}
+<div class="tile">{{if $.Edit}}<input type="checkbox" name="sha" value="{{.SHA256}}">{{end}}<a href="/image/{{.SHA256}}"><img loading="lazy" src="/thumb/{{.SHA256}}" alt="{{.Title}}"><span>{{if .Favorite}}★ {{end}}{{or .Title .Path}}</span></a></div>
+{{end}}</div>
+{{if .Edit}}</form>{{end}}
+<nav>{{if gt .Prev 0}}<a href="?q={{.Query}}&page={{.Prev}}">← newer</a>{{end}}
+{{if .Next}}<a href="?q={{.Query}}&page={{.Next}}">older →</a>{{end}}</nav>
+</body></html>`))
+
+var imageTmpl = template.Must(template.New("image").Funcs(tmplFuncs).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width">
+<title>{{or .Title .Path}}</title>` + galleryStyle + `</head><body>
+<header><a href="/"><b>spotlightdl</b></a><span>{{or .Title .Path}}</span></header>
+<div class="detail"><a href="/raw/{{.SHA256}}"><img src="/raw/{{.SHA256}}" alt="{{.Title}}"></a>
+<dl>
+{{with .Title}}<dt>title</dt><dd>{{.}}</dd>{{end}}
+{{with .Location}}<dt>location</dt><dd>{{.}}</dd>{{end}}
+{{with .Description}}<dt>description</dt><dd>{{.}}</dd>{{end}}
+{{with .Copyright}}<dt>copyright</dt><dd>{{.}}</dd>{{end}}
+<dt>file</dt><dd>{{.Path}}</dd>
+<dt>size</dt><dd>{{.Width}}×{{.Height}}, {{bytes .Size}}</dd>
+{{with .Source}}<dt>source</dt><dd>{{.}}</dd>{{end}}
+{{with .Locales}}<dt>locales</dt><dd>{{join . ", "}}</dd>{{end}}
+<dt>added</dt><dd>{{date .Added}}</dd>
+{{if .Rating}}<dt>rating</dt><dd>{{stars .Rating}}</dd>{{end}}
+{{if .Favorite}}<dt>favorite</dt><dd>★</dd>{{end}}
+{{with .Tags}}<dt>tags</dt><dd>{{join . ", "}}</dd>{{end}}
+<dt>sha256</dt><dd><code>{{.SHA256}}</code></dd>
+</dl>
+<p><a href="/raw/{{.SHA256}}?download">download</a></p></div>
+{{if .Edit}}<form class="edit" method="post" action="/edit">
+<input type="hidden" name="sha" value="{{.SHA256}}"><input type="hidden" name="back" value="{{.Back}}">
+<input name="tags" placeholder="tags: a, b, -c"><button name="action" value="tag">tag</button>
+` + ratingSelect + `<button name="action" value="rate">rate</button>
+{{if .Favorite}}<button name="action" value="unfavorite">unfavorite</button>{{else}}<button name="action" value="favorite">favorite</button>{{end}}
+<button name="action" value="block">block</button></form>{{end}}
+</body></html>`))
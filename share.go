@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+func init() {
+	registerCommand("share", cmdShare)
+}
+
+func cmdShare(args []string) error {
+	flags := flag.NewFlagSet("share", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory, for images named by SHA-256 prefix")
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: spotlightdl share [-outdir dir] <image|sha256>")
+	}
+
+	path := flags.Arg(0)
+	if !exists(path) {
+		cat, err := openCatalog(*outDir)
+		if err != nil {
+			return err
+		}
+		e, err := cat.lookup(*outDir, path)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(*outDir, filepath.FromSlash(e.Path))
+	}
+	if err := copyImageToClipboard(path); err != nil {
+		return fmt.Errorf("share: %w", err)
+	}
+	fmt.Printf("copied %s to the clipboard\n", path)
+	return nil
+}
+
+func imageMIME(path string) string {
+	switch fileExt(path) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type sidecar struct {
+	Title      string `json:"title,omitempty"`
+	Copyright  string `json:"copyright,omitempty"`
+	Author     string `json:"author,omitempty"`
+	License    string `json:"license,omitempty"`
+	LicenseURL string `json:"licenseUrl,omitempty"`
+	PageURL    string `json:"pageUrl,omitempty"`
+	SourceURL  string `json:"sourceUrl"`
+}
+
+// writeSidecar stores attribution next to the image as <file>.json, which
+// licenses such as CC BY-SA require to travel with the file.
+func writeSidecar(imgPath string, im spotImage) error {
+	b, err := json.MarshalIndent(sidecar{
+		Title:      im.Title,
+		Copyright:  im.Copyright,
+		Author:     im.Author,
+		License:    im.License,
+		LicenseURL: im.LicenseURL,
+		PageURL:    im.PageURL,
+		SourceURL:  im.URL,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(imgPath+".json", append(b, '\n'), 0o644)
+}
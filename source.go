@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Source is an image provider. Fetch is called once per round until a run
+// stops finding new images.
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]spotImage, error)
+}
+
+// sourceConfig carries everything a source factory may need; each source
+// picks the fields it cares about.
+type sourceConfig struct {
+	Client              *http.Client
+	Locale              string
+	Country             string
+	LocaleFallback      []string
+	UnsplashCollections string
+	UnsplashCount       int
+	WikimediaDays       int
+}
+
+var sourceRegistry = map[string]func(sourceConfig) (Source, error){}
+
+// registerSource is called from init in each source's file.
+func registerSource(name string, factory func(sourceConfig) (Source, error)) {
+	if _, dup := sourceRegistry[name]; dup {
+		panic("source registered twice: " + name)
+	}
+	sourceRegistry[name] = factory
+}
+
+func sourceNames() []string {
+	var names []string
+	for n := range sourceRegistry {
+		names = append(names, n)
+	}
+	for _, p := range findPlugins("source") {
+		if sourceRegistry[p.Name] == nil {
+			names = append(names, p.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// newSources builds the sources named in a comma-separated spec, in order.
+func newSources(spec string, cfg sourceConfig) ([]Source, error) {
+	var out []Source
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		factory, ok := sourceRegistry[name]
+		if !ok {
+			p, ok := findPlugin("source", name)
+			if !ok {
+				return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(sourceNames(), ", "))
+			}
+			out = append(out, newPluginSource(p, cfg))
+			continue
+		}
+		src, err := factory(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, src)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no source selected (available: %s)", strings.Join(sourceNames(), ", "))
+	}
+	return out, nil
+}
+
+// onceSource adapts providers whose feed doesn't change between rounds
+// (or never saturates): the batch is returned once, then nothing.
+type onceSource struct {
+	name  string
+	fetch func(ctx context.Context) ([]spotImage, error)
+	done  bool
+}
+
+func (s *onceSource) Name() string { return s.name }
+
+func (s *onceSource) Fetch(ctx context.Context) ([]spotImage, error) {
+	if s.done {
+		return nil, nil
+	}
+	imgs, err := s.fetch(ctx)
+	if err == nil {
+		s.done = true
+	}
+	return imgs, err
+}
+
+func (s *onceSource) exhausted() bool { return s.done }
+
+// allExhausted reports whether no source can produce anything new, so the
+// run can stop without waiting out the empty rounds.
+func allExhausted(srcs []Source) bool {
+	for _, s := range srcs {
+		e, ok := s.(interface{ exhausted() bool })
+		if !ok || !e.exhausted() {
+			return false
+		}
+	}
+	return true
+}
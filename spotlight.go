@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+func buildAPIURL(country, locale string) (string, error) {
+	u, err := url.Parse("https://fd.api.iris.microsoft.com/v4/api/selection")
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"placement": {"88000820"},
+		"bcnt":      {"4"},
+		"country":   {country},
+		"locale":    {locale},
+		"fmt":       {"json"},
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+
+}
+
+type (
+	root struct {
+		BatchRsp struct {
+			Items []struct {
+				Item string `json:"item"` // nested JSON string
+			} `json:"items"`
+		} `json:"batchrsp"`
+	}
+
+	adEnvelope struct {
+		Ad *ad `json:"ad"`
+	}
+
+	ad struct {
+		IconHoverText string       `json:"iconHoverText"`
+		Title         string       `json:"title"`
+		Description   string       `json:"description"`
+		Copyright     string       `json:"copyright"`
+		Landscape     *imageObject `json:"landscapeImage"`
+	}
+
+	imageObject struct {
+		Asset string `json:"asset"`
+	}
+)
+
+// emptyBeforeFallback is how many empty batches in a row make the source
+// move on to the next locale of the fallback chain.
+const emptyBeforeFallback = 3
+
+type spotlightSource struct {
+	client          *http.Client
+	country, locale string
+	fallback        []string // locales still to try, in order
+	empty           int
+}
+
+func init() {
+	registerSource("spotlight", func(cfg sourceConfig) (Source, error) {
+		s := &spotlightSource{client: cfg.Client, country: cfg.Country, locale: cfg.Locale}
+		for _, l := range cfg.LocaleFallback {
+			if l != cfg.Locale && !slices.Contains(s.fallback, l) {
+				s.fallback = append(s.fallback, l)
+			}
+		}
+		return s, nil
+	})
+}
+
+func (s *spotlightSource) Name() string { return "spotlight" }
+
+func (s *spotlightSource) Fetch(ctx context.Context) ([]spotImage, error) {
+	imgs, err := fetchOnce(ctx, s.client, s.country, s.locale)
+	if err != nil {
+		return nil, err
+	}
+	if len(imgs) > 0 {
+		s.empty = 0
+		return imgs, nil
+	}
+	// small markets often get empty batches; rather than report nothing,
+	// move down the chain and say which locale is used
+	if s.empty++; s.empty >= emptyBeforeFallback && len(s.fallback) > 0 {
+		next := s.fallback[0]
+		slog.Warn("spotlight: no images, falling back", "locale", s.locale, "fallback", next)
+		s.locale, s.country = resolveLocale(next)
+		s.fallback = s.fallback[1:]
+		s.empty = 0
+	}
+	return nil, nil
+}
+
+func fetchOnce(ctx context.Context, client *http.Client, country, locale string) ([]spotImage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	reqURL, err := buildAPIURL(country, locale)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http %d", resp.StatusCode)
+	}
+
+	var r root
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	var out []spotImage
+	for _, it := range r.BatchRsp.Items {
+		// each item is JSON inside a string
+		var env adEnvelope
+		if err := json.Unmarshal([]byte(it.Item), &env); err != nil {
+			continue
+		}
+		if env.Ad == nil || env.Ad.Landscape == nil {
+			continue
+		}
+		asset := strings.TrimSpace(env.Ad.Landscape.Asset)
+		if asset == "" || !strings.HasPrefix(asset, "https://") {
+			continue
+		}
+		out = append(out, spotImage{
+			URL:         asset,
+			FileName:    fileNameFromURL(asset),
+			Title:       firstNonEmpty(env.Ad.IconHoverText, env.Ad.Title),
+			Location:    hoverLocation(env.Ad.IconHoverText),
+			Description: env.Ad.Description,
+			Copyright:   env.Ad.Copyright,
+			Locale:      locale,
+			Published:   adPublished([]byte(it.Item)),
+		})
+	}
+	return dedupe(out), nil
+}
+
+// adDateLayouts are the forms a date in an ad comes in.
+var adDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "20060102"}
+
+// adPublished finds when an image was published in an item of the
+// selection response. The API documents no such field, and what it sends
+// has changed over the years (startTime, creativeDate, ...), so any field
+// of the ad named like a date or time counts; the earliest date that is
+// plausible wins, or none.
+func adPublished(item []byte) time.Time {
+	var env struct {
+		Ad map[string]any `json:"ad"`
+	}
+	if json.Unmarshal(item, &env) != nil {
+		return time.Time{}
+	}
+	var earliest time.Time
+	for k, v := range env.Ad {
+		s, ok := v.(string)
+		name := strings.ToLower(k)
+		if !ok || !strings.Contains(name, "date") && !strings.Contains(name, "time") {
+			continue
+		}
+		for _, layout := range adDateLayouts {
+			t, err := time.Parse(layout, strings.TrimSpace(s))
+			if err != nil {
+				continue
+			}
+			if t.Year() >= 2010 && t.Before(time.Now()) && (earliest.IsZero() || t.Before(earliest)) {
+				earliest = t.UTC()
+			}
+			break
+		}
+	}
+	return earliest
+}
+
+// hoverLocation is the first line of a hover text like "Lake Bled,
+// Slovenia\r\n© Jane Doe/Getty Images", which names the place; a
+// one-line hover text is only a title.
+func hoverLocation(hover string) string {
+	if loc, _, ok := strings.Cut(hover, "\n"); ok {
+		return strings.TrimSpace(loc)
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func sspiAuthenticator(scheme, target string) (proxyAuthenticator, error) {
+	return nil, errors.New("proxy auth without -proxy-user needs Windows SSPI; set -proxy-user and SPOTLIGHTDL_PROXY_PASSWORD")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// SSPI lets NTLM and Kerberos (via Negotiate) use the logged-on user's
+// credentials, so no password has to be configured on domain machines.
+
+var (
+	modsecur32                     = syscall.NewLazyDLL("secur32.dll")
+	procAcquireCredentialsHandleW  = modsecur32.NewProc("AcquireCredentialsHandleW")
+	procInitializeSecurityContextW = modsecur32.NewProc("InitializeSecurityContextW")
+	procCompleteAuthToken          = modsecur32.NewProc("CompleteAuthToken")
+	procFreeCredentialsHandle      = modsecur32.NewProc("FreeCredentialsHandle")
+	procDeleteSecurityContext      = modsecur32.NewProc("DeleteSecurityContext")
+	procFreeContextBuffer          = modsecur32.NewProc("FreeContextBuffer")
+)
+
+const (
+	secpkgCredOutbound      = 2
+	securityNativeDrep      = 0x10
+	iscReqAllocateMemory    = 0x100
+	iscReqConnection        = 0x800
+	secbufferToken          = 2
+	secEOK                  = 0
+	secIContinueNeeded      = 0x00090312
+	secICompleteNeeded      = 0x00090313
+	secICompleteAndContinue = 0x00090314
+)
+
+type secHandle struct {
+	lower, upper uintptr
+}
+
+type secBuffer struct {
+	size uint32
+	typ  uint32
+	buf  *byte
+}
+
+type secBufferDesc struct {
+	version uint32
+	count   uint32
+	buffers *secBuffer
+}
+
+type sspiAuth struct {
+	schemeName string
+	target     *uint16
+	cred       secHandle
+	ctx        secHandle
+	haveCtx    bool
+}
+
+func sspiAuthenticator(scheme, target string) (proxyAuthenticator, error) {
+	pkg, err := syscall.UTF16PtrFromString(scheme)
+	if err != nil {
+		return nil, err
+	}
+	t, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return nil, err
+	}
+	a := &sspiAuth{schemeName: scheme, target: t}
+	var expiry int64
+	r, _, _ := procAcquireCredentialsHandleW.Call(0, uintptr(unsafe.Pointer(pkg)), secpkgCredOutbound,
+		0, 0, 0, 0, uintptr(unsafe.Pointer(&a.cred)), uintptr(unsafe.Pointer(&expiry)))
+	if r != secEOK {
+		return nil, fmt.Errorf("sspi: AcquireCredentialsHandle(%s): 0x%x", scheme, uint32(r))
+	}
+	return a, nil
+}
+
+func (a *sspiAuth) scheme() string { return a.schemeName }
+
+func (a *sspiAuth) step(challenge []byte) ([]byte, error) {
+	var in *secBufferDesc
+	var ctxIn *secHandle
+	if a.haveCtx {
+		ctxIn = &a.ctx
+	}
+	if len(challenge) > 0 {
+		inBuf := secBuffer{size: uint32(len(challenge)), typ: secbufferToken, buf: &challenge[0]}
+		in = &secBufferDesc{count: 1, buffers: &inBuf}
+	}
+	outBuf := secBuffer{typ: secbufferToken}
+	out := secBufferDesc{count: 1, buffers: &outBuf}
+	var attrs uint32
+	var expiry int64
+	r, _, _ := procInitializeSecurityContextW.Call(
+		uintptr(unsafe.Pointer(&a.cred)), uintptr(unsafe.Pointer(ctxIn)), uintptr(unsafe.Pointer(a.target)),
+		iscReqAllocateMemory|iscReqConnection, 0, securityNativeDrep, uintptr(unsafe.Pointer(in)), 0,
+		uintptr(unsafe.Pointer(&a.ctx)), uintptr(unsafe.Pointer(&out)),
+		uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(&expiry)))
+	status := uint32(r)
+	switch status {
+	case secEOK, secIContinueNeeded:
+	case secICompleteNeeded, secICompleteAndContinue:
+		if r, _, _ := procCompleteAuthToken.Call(uintptr(unsafe.Pointer(&a.ctx)), uintptr(unsafe.Pointer(&out))); r != secEOK {
+			return nil, fmt.Errorf("sspi: CompleteAuthToken: 0x%x", uint32(r))
+		}
+	default:
+		return nil, fmt.Errorf("sspi: InitializeSecurityContext: 0x%x", status)
+	}
+	a.haveCtx = true
+	if outBuf.buf == nil {
+		return nil, nil
+	}
+	defer procFreeContextBuffer.Call(uintptr(unsafe.Pointer(outBuf.buf)))
+	return append([]byte{}, unsafe.Slice(outBuf.buf, outBuf.size)...), nil
+}
+
+func (a *sspiAuth) Close() error {
+	if a.haveCtx {
+		procDeleteSecurityContext.Call(uintptr(unsafe.Pointer(&a.ctx)))
+	}
+	procFreeCredentialsHandle.Call(uintptr(unsafe.Pointer(&a.cred)))
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand("stats", cmdStats)
+}
+
+func cmdStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	fun := flags.Bool("fun", false, "a friendlier summary with sparklines")
+	parseFlags(flags, args)
+
+	u, err := openUsage(*outDir)
+	if err != nil {
+		return err
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	if u.Runs == 0 && len(cat.Images) == 0 {
+		fmt.Println("no runs recorded yet")
+		return nil
+	}
+
+	if !*fun {
+		if len(cat.Images) > 0 {
+			printLibraryStats(*outDir, cat)
+		}
+		if u.Runs == 0 {
+			return nil
+		}
+		total := u.totals()
+		fmt.Println()
+		fmt.Printf("since      %s\n", u.Since.Local().Format("2006-01-02"))
+		fmt.Printf("runs       %d (%d successful)\n", u.Runs, u.Successes)
+		fmt.Printf("images     %d (%s)\n", total.Images, formatBytes(total.Bytes))
+		fmt.Printf("deduped    %d (%s not downloaded)\n", total.Deduped, formatBytes(total.DedupedBytes))
+		keys := monthKeys(u, 12)
+		for _, k := range keys {
+			m := u.Months[k]
+			if m == nil {
+				m = &monthUsage{}
+			}
+			fmt.Printf("%s    %d runs, %d images\n", k, m.Runs, m.Images)
+		}
+		return nil
+	}
+
+	if u.Runs == 0 {
+		fmt.Printf("The library has %s images and no runs recorded yet.\n", thousands(len(cat.Images)))
+		return nil
+	}
+	total := u.totals()
+	fmt.Printf("You've archived %s images since %s.\n", thousands(total.Images), u.Since.Local().Format("January 2006"))
+	fmt.Printf("%s runs, %d%% of them successful.\n", thousands(u.Runs), u.Successes*100/u.Runs)
+	if total.Deduped > 0 {
+		fmt.Printf("Deduplication skipped %s downloads and saved %s.\n", thousands(total.Deduped), formatBytes(total.DedupedBytes))
+	}
+	keys := monthKeys(u, 12)
+	var perMonth []int
+	for _, k := range keys {
+		if m := u.Months[k]; m != nil {
+			perMonth = append(perMonth, m.Images)
+		} else {
+			perMonth = append(perMonth, 0)
+		}
+	}
+	fmt.Printf("\nimages/month  %s  (%s .. %s)\n", sparkline(perMonth), keys[0], keys[len(keys)-1])
+	var perRun []int
+	for _, r := range u.Recent[max(0, len(u.Recent)-30):] {
+		perRun = append(perRun, r.Images)
+	}
+	fmt.Printf("last runs     %s\n", sparkline(perRun))
+	fmt.Println("\n(these numbers never leave this machine)")
+	return nil
+}
+
+// printLibraryStats describes what the catalog holds, as opposed to the
+// run counters, which also cover images pruned since.
+func printLibraryStats(outDir string, cat *catalog) {
+	var bytes, widths, heights, saved int64
+	var sized, linkedN, localesN int
+	locales := make(map[string]int)
+	months := make(map[string]int)
+	bySum := make(map[string][]*catalogEntry)
+	for _, e := range cat.Images {
+		bytes += e.Size
+		if e.Width > 0 && e.Height > 0 {
+			widths += int64(e.Width)
+			heights += int64(e.Height)
+			sized++
+		}
+		if len(e.Locales) == 0 {
+			locales["global"]++
+		}
+		for _, l := range e.Locales {
+			locales[l]++
+		}
+		// every market after the first offered the same bytes again
+		if len(e.Locales) > 1 {
+			localesN += len(e.Locales) - 1
+			saved += int64(len(e.Locales)-1) * e.Size
+		}
+		months[e.Added.Local().Format("2006-01")]++
+		bySum[e.SHA256] = append(bySum[e.SHA256], e)
+	}
+	// copies that dedupe -link turned into hard links take no room
+	for _, group := range bySum {
+		for _, e := range group[1:] {
+			if linkedCopies(outDir, group[0], e) {
+				linkedN++
+				saved += e.Size
+			}
+		}
+	}
+
+	fmt.Printf("library    %d images (%s)\n", len(cat.Images), formatBytes(bytes))
+	if sized > 0 {
+		// of the images analyze or the download has measured
+		fmt.Printf("average    %dx%d over %d measured\n", widths/int64(sized), heights/int64(sized), sized)
+	}
+	if saved > 0 {
+		fmt.Printf("saved      %s (%d repeat(s) across locales, %d hard link(s))\n", formatBytes(saved), localesN, linkedN)
+	}
+
+	fmt.Println("\nby locale")
+	keys := slices.Collect(maps.Keys(locales))
+	slices.SortFunc(keys, func(a, b string) int {
+		if d := locales[b] - locales[a]; d != 0 {
+			return d
+		}
+		return strings.Compare(a, b)
+	})
+	for _, k := range keys {
+		fmt.Printf("  %-10s %d\n", k, locales[k])
+	}
+
+	fmt.Println("\nby month added")
+	keys = slices.Sorted(maps.Keys(months))
+	for _, k := range keys {
+		fmt.Printf("  %-10s %d\n", k, months[k])
+	}
+}
+
+// monthKeys returns the last n months up to now, oldest first.
+func monthKeys(u *usageStats, n int) []string {
+	now := time.Now()
+	first := time.Date(now.Year(), now.Month()-time.Month(n-1), 1, 0, 0, 0, 0, time.UTC)
+	if s := time.Date(u.Since.Year(), u.Since.Month(), 1, 0, 0, 0, 0, time.UTC); s.After(first) {
+		first = s
+	}
+	var keys []string
+	for t := first; !t.After(now); t = t.AddDate(0, 1, 0) {
+		keys = append(keys, t.Format("2006-01"))
+	}
+	return keys
+}
+
+func sparkline(vals []int) string {
+	const bars = "▁▂▃▄▅▆▇█"
+	ticks := []rune(bars)
+	top := slices.Max(append([]int{0}, vals...))
+	var b strings.Builder
+	for _, v := range vals {
+		i := 0
+		if top > 0 {
+			i = v * (len(ticks) - 1) / top
+		}
+		b.WriteRune(ticks[i])
+	}
+	return b.String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func thousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
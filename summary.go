@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// runSummary is what `-output json` prints when a run ends.
+type runSummary struct {
+	Started    time.Time        `json:"started"`
+	Finished   time.Time        `json:"finished"`
+	OutDir     string           `json:"outdir"`
+	Stopped    string           `json:"stopped"` // saturated, exhausted, max-images, max-duration or interrupted
+	Downloaded []summaryImage   `json:"downloaded"`
+	Planned    []summaryImage   `json:"planned,omitempty"` // -dry-run
+	Skipped    []summaryImage   `json:"skipped"`
+	Failed     []summaryFailure `json:"failed"`
+}
+
+type summaryImage struct {
+	Path      string   `json:"path,omitempty"`
+	URL       string   `json:"url"`
+	SHA256    string   `json:"sha256,omitempty"`
+	Size      int64    `json:"size,omitempty"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Copyright string   `json:"copyright,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Locales   []string `json:"locales,omitempty"`
+}
+
+type summaryFailure struct {
+	URL    string `json:"url,omitempty"`
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error"`
+}
+
+func newSummaryImage(path string, im spotImage) summaryImage {
+	s := summaryImage{
+		Path:      path,
+		URL:       im.URL,
+		Title:     im.Title,
+		Copyright: im.Copyright,
+		Source:    im.Source,
+	}
+	if im.Locale != "" {
+		s.Locales = []string{im.Locale}
+	}
+	return s
+}
+
+func summaryFromEntry(path string, e *catalogEntry) summaryImage {
+	return summaryImage{
+		Path:      path,
+		URL:       e.URL,
+		SHA256:    e.SHA256,
+		Size:      e.Size,
+		Width:     e.Width,
+		Height:    e.Height,
+		Title:     e.Title,
+		Copyright: e.Copyright,
+		Source:    e.Source,
+		Locales:   e.Locales,
+	}
+}
+
+func (s *runSummary) write(w io.Writer) error {
+	s.Finished = time.Now().UTC()
+	// empty lists stay [] rather than null for the benefit of jq users
+	for _, l := range []*[]summaryImage{&s.Downloaded, &s.Skipped} {
+		if *l == nil {
+			*l = []summaryImage{}
+		}
+	}
+	if s.Failed == nil {
+		s.Failed = []summaryFailure{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
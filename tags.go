@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Tags are the user's own words for images, lower-case and stored in the
+// catalog. `tag` edits them in bulk (browse does one image at a time),
+// -xmp also writes them to the XMP sidecar as dc:subject, and -tag
+// filters list, search, rotate, the exports and the daemon's wallpaper by
+// them.
+
+func init() {
+	registerCommand("tag", cmdTag)
+}
+
+func cmdTag(args []string) error {
+	usage := errors.New("usage: spotlightdl tag add|remove|list [flags]")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "add":
+		return tagEdit("tag add", args[1:], "")
+	case "remove":
+		return tagEdit("tag remove", args[1:], "-")
+	case "list":
+		return tagList(args[1:])
+	}
+	return usage
+}
+
+// tagEdit adds or, with prefix "-", removes tags on images.
+func tagEdit(name string, args []string, prefix string) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	xmp := flags.Bool("xmp", false, "also write the tags to the image's XMP sidecar (<file>.xmp)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: spotlightdl %s [-outdir dir] [-xmp] <tag,...> <image|sha256>...\n", name)
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return fmt.Errorf("%s: need tags and at least one image", name)
+	}
+	var spec []string
+	for _, t := range splitList(flags.Arg(0)) {
+		spec = append(spec, prefix+strings.TrimPrefix(t, "-"))
+	}
+	if len(spec) == 0 {
+		return fmt.Errorf("%s: no tags given", name)
+	}
+
+	lock, err := lockLibrary(context.Background(), *outDir, name, *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	for _, ref := range flags.Args()[1:] {
+		e, err := cat.lookup(*outDir, ref)
+		if err != nil {
+			return err
+		}
+		e.Tags = editTags(e.Tags, strings.Join(spec, ","))
+		write := syncXMPTags
+		if *xmp {
+			write = writeXMPTags
+		}
+		if err := write(filepath.Join(*outDir, filepath.FromSlash(e.Path)), e.Tags); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", e.Path, firstNonEmpty(strings.Join(e.Tags, ", "), "no tags"))
+	}
+	return cat.save()
+}
+
+// tagList prints every tag with how many images have it, or the tags of
+// the images given.
+func tagList(args []string) error {
+	flags := flag.NewFlagSet("tag list", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	parseFlags(flags, args)
+
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		for _, ref := range flags.Args() {
+			e, err := cat.lookup(*outDir, ref)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s\n", e.Path, firstNonEmpty(strings.Join(e.Tags, ", "), "no tags"))
+		}
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, e := range cat.Images {
+		for _, t := range e.Tags {
+			counts[t]++
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Println("no tags yet")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, t := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(tw, "%s\t%d\n", t, counts[t])
+	}
+	return tw.Flush()
+}
+
+// tagFilter selects images by tag: a spec like "beach,mountains,-night"
+// admits images with any of the plain tags (all images if there are
+// none) and none of the ones prefixed with -.
+type tagFilter struct {
+	any, none []string
+}
+
+func parseTagFilter(spec string) tagFilter {
+	var f tagFilter
+	for _, t := range splitList(strings.ToLower(spec)) {
+		if rm, ok := strings.CutPrefix(t, "-"); ok {
+			f.none = append(f.none, rm)
+		} else {
+			f.any = append(f.any, t)
+		}
+	}
+	return f
+}
+
+func (f tagFilter) admits(tags []string) bool {
+	if len(f.any) > 0 && !slices.ContainsFunc(f.any, func(t string) bool { return slices.Contains(tags, t) }) {
+		return false
+	}
+	return !slices.ContainsFunc(f.none, func(t string) bool { return slices.Contains(tags, t) })
+}
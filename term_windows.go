@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"unsafe"
+)
+
+var (
+	procGetConsoleMode = modkernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = modkernel32.NewProc("SetConsoleMode")
+)
+
+const (
+	enableVirtualTerminalProcessing = 0x0004
+
+	enableProcessedInput       = 0x0001
+	enableLineInput            = 0x0002
+	enableEchoInput            = 0x0004
+	enableVirtualTerminalInput = 0x0200
+)
+
+// enableVT switches the console to ANSI escape handling (Windows 10+).
+func enableVT(f *os.File) bool {
+	var mode uint32
+	if r, _, _ := procGetConsoleMode.Call(f.Fd(), uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	r, _, _ := procSetConsoleMode.Call(f.Fd(), uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
+
+// makeRaw turns off line editing and echo on the console input behind f
+// and asks for VT key sequences, so arrow keys arrive as ESC [ A etc.
+func makeRaw(f *os.File) (func(), error) {
+	var mode uint32
+	if r, _, err := procGetConsoleMode.Call(f.Fd(), uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return nil, err
+	}
+	raw := mode&^(enableEchoInput|enableLineInput|enableProcessedInput) | enableVirtualTerminalInput
+	if r, _, err := procSetConsoleMode.Call(f.Fd(), uintptr(raw)); r == 0 {
+		return nil, err
+	}
+	return func() { procSetConsoleMode.Call(f.Fd(), uintptr(mode)) }, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Tombstones remember images the user got rid of, so that the next run
+// does not download them again. Deleting an image in browse or through the
+// control API leaves one, as does deleting the file by hand (noticed by
+// the next run, watch or rebuild-index), and `block` adds one for an image
+// or URL up front; so do -filter, -min-width/-min-height and -aspect for
+// an image they turn down once it is downloaded and measured. A tombstone
+// matches by URL before the download and by SHA-256 after it, so the same
+// picture from another market stays away too. They live in
+// .spotlightdl/tombstones.json and travel with the library; `unblock`
+// lifts one.
+
+type tombstone struct {
+	SHA256 string    `json:"sha256,omitempty"`
+	URL    string    `json:"url,omitempty"`
+	Path   string    `json:"path,omitempty"` // where it was, to recognize it by
+	Title  string    `json:"title,omitempty"`
+	Reason string    `json:"reason"` // deleted, blocked or filtered
+	Time   time.Time `json:"time"`
+}
+
+type tombstones []*tombstone
+
+func tombstonesPath(outDir string) string {
+	return filepath.Join(stateDir(outDir), "tombstones.json")
+}
+
+func loadTombstones(outDir string) (tombstones, error) {
+	var t tombstones
+	b, err := os.ReadFile(tombstonesPath(outDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, json.Unmarshal(b, &t)
+}
+
+func saveTombstones(outDir string, t tombstones) error {
+	if err := os.MkdirAll(stateDir(outDir), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(tombstonesPath(outDir), b)
+}
+
+// find returns the tombstone for an image's URL or content, or nil; an
+// empty url or sum matches nothing.
+func (t tombstones) find(url, sum string) *tombstone {
+	for _, ts := range t {
+		if (url != "" && ts.URL == url) || (sum != "" && ts.SHA256 == sum) {
+			return ts
+		}
+	}
+	return nil
+}
+
+// bury adds a tombstone for e, or updates the one it already has.
+func (t tombstones) bury(e *catalogEntry, reason string) tombstones {
+	// a later download is recognized by what it hashes to as downloaded
+	sum := cmp.Or(e.SourceSHA256, e.SHA256)
+	ts := t.find(e.URL, sum)
+	if ts == nil {
+		ts = &tombstone{}
+		t = append(t, ts)
+	}
+	ts.SHA256 = firstNonEmpty(sum, ts.SHA256)
+	ts.URL = firstNonEmpty(e.URL, ts.URL)
+	ts.Path = firstNonEmpty(e.Path, ts.Path)
+	ts.Title = firstNonEmpty(e.Title, ts.Title)
+	ts.Reason = reason
+	ts.Time = time.Now().UTC()
+	return t
+}
+
+// buryEntries records tombstones for images the user deleted.
+func buryEntries(outDir string, entries []*catalogEntry, reason string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	t, err := loadTombstones(outDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		t = t.bury(e, reason)
+	}
+	return saveTombstones(outDir, t)
+}
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func init() {
+	registerCommand("block", cmdBlock)
+	registerCommand("unblock", cmdUnblock)
+}
+
+func cmdBlock(args []string) error {
+	flags := flag.NewFlagSet("block", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	list := flags.Bool("list", false, "list the blocked and deleted images")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl block [-outdir dir] <image|sha256|url>...")
+		fmt.Fprintln(flags.Output(), "       spotlightdl block [-outdir dir] -list")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+
+	if *list {
+		return listTombstones(*outDir)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("block: need at least one image or URL")
+	}
+	lock, err := lockLibrary(context.Background(), *outDir, "block", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	if err := checkFrozen(*outDir, "block"); err != nil {
+		return err
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	t, err := loadTombstones(*outDir)
+	if err != nil {
+		return err
+	}
+	trash, err := loadTrash(*outDir)
+	if err != nil {
+		return err
+	}
+	var trashed bool
+	for _, ref := range flags.Args() {
+		e := cat.byURL(ref)
+		if e == nil && !strings.Contains(ref, "://") {
+			e, err = cat.lookup(*outDir, ref)
+			if err != nil && !sha256Hex.MatchString(strings.ToLower(ref)) {
+				return fmt.Errorf("block: %w", err)
+			}
+		}
+		if e == nil {
+			// not in the library (any more): block it by what was given
+			stand := &catalogEntry{URL: ref}
+			if !strings.Contains(ref, "://") {
+				stand = &catalogEntry{SHA256: strings.ToLower(ref)}
+			}
+			t = t.bury(stand, "blocked")
+			fmt.Printf("blocked %s\n", ref)
+			continue
+		}
+		t = t.bury(e, "blocked")
+		// the file goes to the trash, where prune -restore can find it
+		if trash, err = trashImage(*outDir, cat, trash, e, time.Now()); err != nil {
+			return err
+		}
+		trashed = true
+		fmt.Printf("blocked %s, moved to the trash\n", e.Path)
+	}
+	if err := saveTombstones(*outDir, t); err != nil {
+		return err
+	}
+	if !trashed {
+		return nil
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	return saveTrash(*outDir, trash)
+}
+
+func cmdUnblock(args []string) error {
+	flags := flag.NewFlagSet("unblock", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: spotlightdl unblock [-outdir dir] <path|sha256|url>...")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("unblock: need at least one image or URL")
+	}
+
+	lock, err := lockLibrary(context.Background(), *outDir, "unblock", *lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	t, err := loadTombstones(*outDir)
+	if err != nil {
+		return err
+	}
+	for _, ref := range flags.Args() {
+		n := len(t)
+		t = slices.DeleteFunc(t, func(ts *tombstone) bool {
+			return ts.URL == ref || ts.Path == filepath.ToSlash(ref) ||
+				(len(ref) >= 6 && ts.SHA256 != "" && strings.HasPrefix(ts.SHA256, strings.ToLower(ref)))
+		})
+		if len(t) == n {
+			return fmt.Errorf("unblock: %s is not blocked", ref)
+		}
+		fmt.Printf("unblocked %s; the next run may download it again\n", ref)
+	}
+	return saveTombstones(*outDir, t)
+}
+
+func listTombstones(outDir string) error {
+	t, err := loadTombstones(outDir)
+	if err != nil {
+		return err
+	}
+	if len(t) == 0 {
+		fmt.Println("nothing is blocked")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SINCE\tREASON\tSHA256\tIMAGE")
+	for _, ts := range t {
+		fmt.Fprintf(tw, "%s\t%s\t%.12s\t%s\n", ts.Time.Local().Format("2006-01-02"), ts.Reason,
+			firstNonEmpty(ts.SHA256, "-"), firstNonEmpty(ts.Path, ts.URL))
+	}
+	return tw.Flush()
+}
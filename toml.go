@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML understands the subset of TOML our config files use: tables
+// ([a] and [a.b]), key = value with strings, integers, floats, booleans
+// and arrays of those, and comments. Tables become nested maps.
+func parseTOML(src string) (map[string]any, error) {
+	root := map[string]any{}
+	cur := root
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripTOMLComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: unsupported table header %q", lineNo, line)
+			}
+			t, err := tomlTable(root, strings.TrimSpace(line[1:len(line)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			cur = t
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		val = strings.TrimSpace(val)
+		// multi-line arrays continue until the brackets balance
+		for strings.HasPrefix(val, "[") && !tomlBalanced(val) && i+1 < len(lines) {
+			i++
+			val += " " + strings.TrimSpace(stripTOMLComment(lines[i]))
+		}
+		v, rest, err := parseTOMLValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNo, key, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("line %d: %s: trailing characters %q", lineNo, key, rest)
+		}
+		if _, dup := cur[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, key)
+		}
+		cur[key] = v
+	}
+	return root, nil
+}
+
+func tomlTable(root map[string]any, name string) (map[string]any, error) {
+	t := root
+	for _, part := range strings.Split(name, ".") {
+		part = strings.Trim(strings.TrimSpace(part), `"`)
+		if part == "" {
+			return nil, fmt.Errorf("invalid table name %q", name)
+		}
+		next, ok := t[part]
+		if !ok {
+			m := map[string]any{}
+			t[part] = m
+			t = m
+			continue
+		}
+		m, ok := next.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a table", part)
+		}
+		t = m
+	}
+	return t, nil
+}
+
+func parseTOMLValue(s string) (any, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return nil, "", fmt.Errorf("missing value")
+	}
+	switch s[0] {
+	case '"':
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		v, err := strconv.Unquote(s[:end+1])
+		return v, s[end+1:], err
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case '[':
+		var arr []any
+		rest := strings.TrimLeft(s[1:], " \t")
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return arr, rest[1:], nil
+			}
+			v, r, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			arr = append(arr, v)
+			rest = strings.TrimLeft(r, " \t")
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " \t")
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("expected , or ] in array")
+			}
+		}
+	}
+	end := strings.IndexAny(s, ",] \t")
+	if end < 0 {
+		end = len(s)
+	}
+	tok, rest := s[:end], s[end:]
+	switch tok {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	clean := strings.ReplaceAll(tok, "_", "")
+	if n, err := strconv.ParseInt(clean, 10, 64); err == nil {
+		return n, rest, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, rest, nil
+	}
+	return nil, "", fmt.Errorf("unsupported value %q", tok)
+}
+
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func tomlBalanced(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// Typed accessors for decoded tables; missing keys yield the zero value.
+
+func tomlString(t map[string]any, key string) (string, error) {
+	v, ok := t[key]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: expected a string", key)
+	}
+	return s, nil
+}
+
+func tomlInt(t map[string]any, key string) (int64, error) {
+	v, ok := t[key]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%s: expected an integer", key)
+	}
+	return n, nil
+}
+
+func tomlBool(t map[string]any, key string) (bool, error) {
+	v, ok := t[key]
+	if !ok {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s: expected true or false", key)
+	}
+	return b, nil
+}
+
+func tomlStrings(t map[string]any, key string) ([]string, error) {
+	v, ok := t[key]
+	if !ok {
+		return nil, nil
+	}
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an array of strings", key)
+	}
+	out := make([]string, 0, len(arr))
+	for _, e := range arr {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an array of strings", key)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func tomlTableAt(t map[string]any, key string) (map[string]any, error) {
+	v, ok := t[key]
+	if !ok {
+		return map[string]any{}, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a table", key)
+	}
+	return m, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		src  string
+		want map[string]any
+	}{
+		{src: "", want: map[string]any{}},
+		{src: "# only a comment\n\n", want: map[string]any{}},
+		{src: `outdir = "~/Pictures/Spotlight"`, want: map[string]any{"outdir": "~/Pictures/Spotlight"}},
+		{src: `s = "tab\there \"quoted\" back\\slash \u00e9"`, want: map[string]any{"s": "tab\there \"quoted\" back\\slash é"}},
+		{src: `path = 'C:\Users\me\#not a comment'`, want: map[string]any{"path": `C:\Users\me\#not a comment`}},
+		{src: `"quoted key" = 1`, want: map[string]any{"quoted key": int64(1)}},
+		{src: "n = 1_000\nneg = -3\nf = 0.5\nyes = true\nno = false", want: map[string]any{
+			"n": int64(1000), "neg": int64(-3), "f": 0.5, "yes": true, "no": false,
+		}},
+		{src: `url = "http://x/#frag" # a comment`, want: map[string]any{"url": "http://x/#frag"}},
+		{src: `a = ["de-DE", 'en-US', 3]`, want: map[string]any{"a": []any{"de-DE", "en-US", int64(3)}}},
+		{src: "a = []", want: map[string]any{"a": []any(nil)}},
+		{src: "a = [[1, 2], [3]]", want: map[string]any{"a": []any{[]any{int64(1), int64(2)}, []any{int64(3)}}}},
+		{src: "a = [\n  \"x\", # first\n  \"]\",\n]", want: map[string]any{"a": []any{"x", "]"}}},
+		{src: "top = 1\n[fetch]\nlocale = \"de-DE\"\n[profile.work]\noutdir = \"/w\"\n[profile.\"home pc\"]\noutdir = \"/h\"", want: map[string]any{
+			"top":   int64(1),
+			"fetch": map[string]any{"locale": "de-DE"},
+			"profile": map[string]any{
+				"work":    map[string]any{"outdir": "/w"},
+				"home pc": map[string]any{"outdir": "/h"},
+			},
+		}},
+		{src: "[a.b]\nx = 1\n[a]\ny = 2", want: map[string]any{"a": map[string]any{"b": map[string]any{"x": int64(1)}, "y": int64(2)}}},
+		{src: "k = 1\r\nl = 2\r\n", want: map[string]any{"k": int64(1), "l": int64(2)}},
+	}
+	for _, tt := range tests {
+		got, err := parseTOML(tt.src)
+		if err != nil {
+			t.Errorf("parseTOML(%q): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTOML(%q) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"a = 1\nb", "line 2: expected key = value"},
+		{"a = \"open", "line 1: a: unterminated string"},
+		{"a = 'open", "line 1: a: unterminated string"},
+		{`a = "bad \q"`, "line 1: a:"},
+		{"a = 1\n\na = 2", `line 3: duplicate key "a"`},
+		{"a = 1 2", `line 1: a: trailing characters " 2"`},
+		{"a = nope", `line 1: a: unsupported value "nope"`},
+		{"a =", "line 1: a: missing value"},
+		{"x = 1\na = [1, 2", "line 2: a: expected , or ] in array"},
+		{"a = [1 2]", "line 1: a: expected , or ] in array"},
+		{"[[arr]]", `line 1: unsupported table header "[[arr]]"`},
+		{"[open", `line 1: unsupported table header "[open"`},
+		{"[a..b]", `line 1: invalid table name "a..b"`},
+		{"a = 1\n[a]", `line 2: "a" is not a table`},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML(tt.src)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("parseTOML(%q) error = %v, want %q...", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestTOMLAccessors(t *testing.T) {
+	tab, err := parseTOML("s = \"x\"\nn = 2\nb = true\nl = [\"a\", \"b\"]\nmixed = [\"a\", 1]\n[t]\nk = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := tomlString(tab, "s"); s != "x" || err != nil {
+		t.Errorf("tomlString = %q, %v", s, err)
+	}
+	if s, err := tomlString(tab, "missing"); s != "" || err != nil {
+		t.Errorf("tomlString(missing) = %q, %v", s, err)
+	}
+	if _, err := tomlString(tab, "n"); err == nil {
+		t.Error("tomlString(n) took an integer")
+	}
+	if n, err := tomlInt(tab, "n"); n != 2 || err != nil {
+		t.Errorf("tomlInt = %d, %v", n, err)
+	}
+	if b, err := tomlBool(tab, "b"); !b || err != nil {
+		t.Errorf("tomlBool = %v, %v", b, err)
+	}
+	if l, err := tomlStrings(tab, "l"); !reflect.DeepEqual(l, []string{"a", "b"}) || err != nil {
+		t.Errorf("tomlStrings = %q, %v", l, err)
+	}
+	if _, err := tomlStrings(tab, "mixed"); err == nil {
+		t.Error("tomlStrings(mixed) took a number")
+	}
+	if m, err := tomlTableAt(tab, "t"); m["k"] != int64(1) || err != nil {
+		t.Errorf("tomlTableAt = %v, %v", m, err)
+	}
+	if _, err := tomlTableAt(tab, "s"); err == nil {
+		t.Error("tomlTableAt(s) took a string")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// transportOptions collects everything that shapes the shared HTTP client.
+type transportOptions struct {
+	Proxy     string // overrides HTTP(S)_PROXY; NO_PROXY still applies
+	ProxyAuth string // "", "ntlm" or "negotiate"
+	ProxyUser string // DOMAIN\user or user@domain; empty means SSPI on Windows
+	CAFile    string // extra PEM roots, e.g. a TLS-inspecting proxy's CA
+	CADir     string // directory of *.pem/*.crt/*.cer files
+
+	UserAgent        string            // defaults to userAgent
+	From             string            // contact address for the From header
+	SourceUserAgents map[string]string // User-Agent per source name
+
+	Faults string // -fault-inject spec, see faults.go
+}
+
+func newHTTPClient(opts transportOptions) (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	account, password := opts.ProxyUser, os.Getenv("SPOTLIGHTDL_PROXY_PASSWORD")
+	if opts.Proxy != "" {
+		u, err := parseProxyURL(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		// credentials in the URL serve basic auth, or the NTLM handshake
+		if u.User != nil && account == "" && opts.ProxyAuth != "" {
+			account = u.User.Username()
+			password, _ = u.User.Password()
+		}
+		tr.Proxy = fixedProxy(u)
+	}
+	if opts.CAFile != "" || opts.CADir != "" {
+		pool, err := rootPool(opts.CAFile, opts.CADir)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	if opts.ProxyAuth != "" {
+		// validate the mode up front instead of on the first connection
+		if _, err := newProxyAuthenticator(opts.ProxyAuth, "-", "", ""); err != nil {
+			return nil, err
+		}
+		d := &connectDialer{
+			proxy:     tr.Proxy,
+			userAgent: firstNonEmpty(opts.UserAgent, userAgent),
+			auth: func(proxyHost string) (proxyAuthenticator, error) {
+				return newProxyAuthenticator(opts.ProxyAuth, account, password, proxyHost)
+			},
+			dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		}
+		tr.Proxy = nil
+		tr.DialContext = d.DialContext
+	}
+	var base http.RoundTripper = tr
+	if opts.Faults != "" {
+		plan, err := parseFaults(opts.Faults)
+		if err != nil {
+			return nil, err
+		}
+		base = &faultTransport{base: tr, plan: plan}
+	}
+	id := &identityTransport{
+		base:      base,
+		userAgent: firstNonEmpty(opts.UserAgent, userAgent),
+		from:      opts.From,
+		perSource: opts.SourceUserAgents,
+	}
+	return &http.Client{Timeout: 20 * time.Second, Transport: id}, nil
+}
+
+// identityTransport sets User-Agent and From on every request, so no call
+// site builds them itself. A request made on behalf of a source (see
+// withSource) gets that source's User-Agent if one is configured.
+type identityTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	from      string
+	perSource map[string]string
+}
+
+func (t *identityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ua := t.userAgent
+	if o, ok := t.perSource[sourceFromContext(req.Context())]; ok {
+		ua = o
+	}
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", ua)
+	if t.from != "" {
+		req.Header.Set("From", t.from)
+	}
+	return t.base.RoundTrip(req)
+}
+
+type sourceKey struct{}
+
+// withSource marks requests made with ctx as made for the named source.
+func withSource(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, name)
+}
+
+func sourceFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(sourceKey{}).(string)
+	return name
+}
+
+// parseUserAgents reads -source-user-agent values of the form name=agent.
+func parseUserAgents(specs []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, spec := range specs {
+		name, ua, ok := strings.Cut(spec, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || strings.TrimSpace(ua) == "" {
+			return nil, fmt.Errorf("-source-user-agent %q: want source=agent", spec)
+		}
+		if _, known := sourceRegistry[name]; !known {
+			return nil, fmt.Errorf("-source-user-agent: unknown source %q (available: %s)", name, strings.Join(sourceNames(), ", "))
+		}
+		out[name] = strings.TrimSpace(ua)
+	}
+	return out, nil
+}
+
+// rootPool adds the given CAs to the system roots, so public sites keep
+// working while the internal CA is trusted too.
+func rootPool(file, dir string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	var files []string
+	if file != "" {
+		files = append(files, file)
+	}
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".pem", ".crt", ".cer":
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", f)
+		}
+	}
+	return pool, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const unsplashAPI = "https://api.unsplash.com/photos/random"
+
+type unsplashPhoto struct {
+	ID             string    `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Description    string    `json:"description"`
+	AltDescription string    `json:"alt_description"`
+	URLs           struct {
+		Full string `json:"full"`
+	} `json:"urls"`
+	User struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	Location struct {
+		Name string `json:"name"`
+	} `json:"location"`
+}
+
+// unsplashKey returns the Unsplash access key from $UNSPLASH_ACCESS_KEY or,
+// failing that, from the OS keyring (service "spotlightdl", account "unsplash").
+// It is looked up once, so that -sandbox can do it before the keyring's
+// command is out of reach.
+var unsplashKey = sync.OnceValues(func() (string, error) {
+	if k := strings.TrimSpace(os.Getenv("UNSPLASH_ACCESS_KEY")); k != "" {
+		return k, nil
+	}
+	k, err := keyringLookup("spotlightdl", "unsplash")
+	if err != nil {
+		return "", errors.New("unsplash: no access key (set UNSPLASH_ACCESS_KEY or store it in the keyring)")
+	}
+	return k, nil
+})
+
+func init() {
+	registerSource("unsplash", func(cfg sourceConfig) (Source, error) {
+		key, err := unsplashKey()
+		if err != nil {
+			return nil, err
+		}
+		count := min(max(cfg.UnsplashCount, 1), 30)
+		// the random endpoint never saturates, so it is queried once per run
+		return &onceSource{name: "unsplash", fetch: func(ctx context.Context) ([]spotImage, error) {
+			return fetchUnsplash(ctx, cfg.Client, key, cfg.UnsplashCollections, count)
+		}}, nil
+	})
+}
+
+func fetchUnsplash(ctx context.Context, client *http.Client, key, collections string, count int) ([]spotImage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	u, err := url.Parse(unsplashAPI)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{
+		"orientation": {"landscape"},
+		"count":       {strconv.Itoa(count)},
+	}
+	if collections != "" {
+		q.Set("collections", collections)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Version", "v1")
+	req.Header.Set("Authorization", "Client-ID "+key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unsplash: http %d", resp.StatusCode)
+	}
+
+	var photos []unsplashPhoto
+	if err := json.NewDecoder(resp.Body).Decode(&photos); err != nil {
+		return nil, err
+	}
+
+	var out []spotImage
+	for _, p := range photos {
+		if p.ID == "" || !strings.HasPrefix(p.URLs.Full, "https://") {
+			continue
+		}
+		// the generated alt text is the title only when the photographer
+		// wrote no description
+		var alt string
+		if p.Description != "" {
+			alt = p.AltDescription
+		}
+		out = append(out, spotImage{
+			URL:         p.URLs.Full,
+			FileName:    "unsplash-" + p.ID + ".jpg",
+			Title:       firstNonEmpty(p.Description, p.AltDescription),
+			Location:    p.Location.Name,
+			Description: alt,
+			Copyright:   "Photo by " + p.User.Name + " on Unsplash",
+			Published:   p.CreatedAt,
+		})
+	}
+	return dedupe(out), nil
+}
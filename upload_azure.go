@@ -0,0 +1,162 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerUploader("azblob", newAzureUploader)
+}
+
+const azureVersion = "2021-08-06"
+
+// azureUploader puts files into an Azure Storage blob container as block
+// blobs. azblob://container/prefix takes the account from the variables
+// the Azure CLI reads: $AZURE_STORAGE_CONNECTION_STRING, or
+// $AZURE_STORAGE_ACCOUNT with $AZURE_STORAGE_KEY (signed with Shared Key)
+// or $AZURE_STORAGE_SAS_TOKEN.
+type azureUploader struct {
+	client    *http.Client
+	endpoint  *url.URL // https://<account>.blob.core.windows.net, or Azurite's
+	account   string
+	key       []byte
+	sas       url.Values
+	container string
+	prefix    string
+}
+
+func newAzureUploader(u *url.URL, client *http.Client) (Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("no container; want azblob://container/prefix")
+	}
+	a := &azureUploader{client: cmp.Or(client, http.DefaultClient), container: u.Host, prefix: strings.Trim(u.Path, "/")}
+	conn := parseAzureConnectionString(os.Getenv("AZURE_STORAGE_CONNECTION_STRING"))
+	a.account = cmp.Or(conn["AccountName"], os.Getenv("AZURE_STORAGE_ACCOUNT"))
+	if a.account == "" {
+		return nil, errors.New("set AZURE_STORAGE_CONNECTION_STRING, or AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN")
+	}
+	if key := cmp.Or(conn["AccountKey"], os.Getenv("AZURE_STORAGE_KEY")); key != "" {
+		var err error
+		if a.key, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return nil, errors.New("the storage account key is not base64")
+		}
+	} else if sas := cmp.Or(conn["SharedAccessSignature"], os.Getenv("AZURE_STORAGE_SAS_TOKEN")); sas != "" {
+		var err error
+		if a.sas, err = url.ParseQuery(strings.TrimPrefix(sas, "?")); err != nil {
+			return nil, fmt.Errorf("invalid SAS token: %w", err)
+		}
+	} else {
+		return nil, errors.New("set AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN for the account")
+	}
+
+	endpoint := conn["BlobEndpoint"]
+	if endpoint == "" {
+		endpoint = cmp.Or(conn["DefaultEndpointsProtocol"], "https") + "://" + a.account + ".blob." + cmp.Or(conn["EndpointSuffix"], "core.windows.net")
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil || ep.Host == "" {
+		return nil, fmt.Errorf("invalid blob endpoint %q", endpoint)
+	}
+	a.endpoint = &url.URL{Scheme: ep.Scheme, Host: ep.Host, Path: strings.TrimSuffix(ep.Path, "/")}
+	return a, nil
+}
+
+// parseAzureConnectionString splits "AccountName=x;AccountKey=y;..." into
+// its settings.
+func parseAzureConnectionString(s string) map[string]string {
+	m := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func (a *azureUploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	u := *a.endpoint
+	u.Path += "/" + a.container + "/" + path.Join(a.prefix, f.Key)
+	if a.sas != nil {
+		u.RawQuery = a.sas.Encode()
+	}
+	body, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = f.Size
+	req.Header.Set("Content-Type", uploadContentType(f.Key))
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	req.Header.Set("X-Ms-Version", azureVersion)
+	req.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	if a.key != nil {
+		a.sign(req)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", uploadStatus(resp)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// sign adds the Shared Key authorization of the Blob service.
+func (a *azureUploader) sign(req *http.Request) {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var ms []string
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			ms = append(ms, k+":"+strings.Join(v, ","))
+		}
+	}
+	slices.Sort(ms)
+	resource := "/" + a.account + req.URL.EscapedPath()
+	q := req.URL.Query()
+	for _, k := range slices.Sorted(maps.Keys(q)) {
+		resource += "\n" + strings.ToLower(k) + ":" + strings.Join(q[k], ",")
+	}
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, sent as x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(ms, "\n"),
+		resource,
+	}, "\n")
+	m := hmac.New(sha256.New, a.key)
+	m.Write([]byte(toSign))
+	req.Header.Set("Authorization", "SharedKey "+a.account+":"+base64.StdEncoding.EncodeToString(m.Sum(nil)))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerUploader("gs", newGCSUploader)
+}
+
+// gcsUploader puts files into a Google Cloud Storage bucket through the
+// JSON API. gs://bucket/prefix finds its credentials the way Google's
+// client libraries do: the file named by $GOOGLE_APPLICATION_CREDENTIALS,
+// else the one `gcloud auth application-default login` writes. Both
+// service account keys and user credentials work.
+// $STORAGE_EMULATOR_HOST sends the uploads to an emulator, without
+// credentials.
+type gcsUploader struct {
+	client *http.Client
+	base   string // scheme and host of the API
+	bucket string
+	prefix string
+	creds  *gcsCredentials
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// gcsCredentials is a credentials file: a service account key or the
+// application default credentials of a user.
+type gcsCredentials struct {
+	Type         string `json:"type"` // service_account or authorized_user
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+func newGCSUploader(u *url.URL, client *http.Client) (Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("no bucket; want gs://bucket/prefix")
+	}
+	g := &gcsUploader{
+		client: cmp.Or(client, http.DefaultClient),
+		base:   "https://storage.googleapis.com",
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+	}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		g.base = strings.TrimSuffix(host, "/")
+		return g, nil
+	}
+	file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if file == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		if env := os.Getenv("CLOUDSDK_CONFIG"); env != "" {
+			file = filepath.Join(env, "application_default_credentials.json")
+		} else {
+			file = filepath.Join(dir, "gcloud", "application_default_credentials.json")
+		}
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("no credentials; set GOOGLE_APPLICATION_CREDENTIALS to a service account key, or run gcloud auth application-default login")
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.creds = &gcsCredentials{}
+	if err := json.Unmarshal(b, g.creds); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if g.creds.Type != "service_account" && g.creds.Type != "authorized_user" {
+		return nil, fmt.Errorf("%s: unsupported credentials type %q", file, g.creds.Type)
+	}
+	return g, nil
+}
+
+func (g *gcsUploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	q := url.Values{"uploadType": {"media"}, "name": {path.Join(g.prefix, f.Key)}}
+	u := g.base + "/upload/storage/v1/b/" + url.PathEscape(g.bucket) + "/o?" + q.Encode()
+	body, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = f.Size
+	req.Header.Set("Content-Type", uploadContentType(f.Key))
+	if g.creds != nil {
+		token, err := g.accessToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", uploadStatus(resp)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// accessToken returns an OAuth access token, fetching a new one when the
+// last is about to expire.
+func (g *gcsUploader) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Until(g.expires) > time.Minute {
+		return g.token, nil
+	}
+	form := url.Values{}
+	tokenURI := cmp.Or(g.creds.TokenURI, "https://oauth2.googleapis.com/token")
+	if g.creds.Type == "service_account" {
+		assertion, err := g.creds.jwt(time.Now())
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	} else {
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", g.creds.ClientID)
+		form.Set("client_secret", g.creds.ClientSecret)
+		form.Set("refresh_token", g.creds.RefreshToken)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting an access token: %w", uploadStatus(resp))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("getting an access token: %w", err)
+	}
+	g.token, g.expires = tok.AccessToken, time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second)
+	return g.token, nil
+}
+
+// jwt makes the signed assertion a service account trades for an access
+// token.
+func (c *gcsCredentials) jwt(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", errors.New("the service account key has no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("service account key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("the service account key is not an RSA key")
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   c.ClientEmail,
+		"scope": gcsScope,
+		"aud":   cmp.Or(c.TokenURI, "https://oauth2.googleapis.com/token"),
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerUploader("immich", newImmichUploader)
+}
+
+// immichUploader adds the images to an Immich server, in an album of their
+// own. immich://host/Spotlight talks to https://host (or ?server=, e.g.
+// http://nas:2283) with the API key in $SPOTLIGHTDL_IMMICH_API_KEY and
+// puts the images into the album named by the path, creating it. Each
+// asset gets the image's title, location and credit as its description,
+// its publication date as the date taken, and its rating and favorite
+// mark. Sidecars stay behind: Immich has no use for the .json and writes
+// its own .xmp.
+type immichUploader struct {
+	client *http.Client
+	server *url.URL
+	key    string
+	album  string
+
+	mu      sync.Mutex
+	albumID string
+}
+
+func newImmichUploader(u *url.URL, client *http.Client) (Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("no host; want immich://host/album")
+	}
+	im := &immichUploader{
+		client: cmp.Or(client, http.DefaultClient),
+		server: &url.URL{Scheme: "https", Host: u.Host},
+		key:    os.Getenv("SPOTLIGHTDL_IMMICH_API_KEY"),
+		album:  cmp.Or(strings.Trim(u.Path, "/"), "Spotlight"),
+	}
+	if server := u.Query().Get("server"); server != "" {
+		s, err := url.Parse(server)
+		if err != nil || s.Host == "" || (s.Scheme != "http" && s.Scheme != "https") {
+			return nil, fmt.Errorf("invalid server %q", server)
+		}
+		im.server = &url.URL{Scheme: s.Scheme, Host: s.Host, Path: strings.TrimSuffix(s.Path, "/")}
+	}
+	if im.key == "" {
+		return nil, errors.New("set SPOTLIGHTDL_IMMICH_API_KEY to an API key (Account Settings > API Keys)")
+	}
+	return im, nil
+}
+
+// call sends a request to the API and decodes the JSON answer into out,
+// if given.
+func (im *immichUploader) call(ctx context.Context, method, p, contentType string, body io.Reader, out any) error {
+	u := *im.server
+	u.Path += "/api" + p
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", im.key)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := im.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return uploadStatus(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (im *immichUploader) callJSON(ctx context.Context, method, p string, in, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return im.call(ctx, method, p, "application/json", bytes.NewReader(b), out)
+}
+
+// albumIDFor finds the album by its name or creates it.
+func (im *immichUploader) albumIDFor(ctx context.Context) (string, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.albumID != "" {
+		return im.albumID, nil
+	}
+	var albums []struct {
+		ID   string `json:"id"`
+		Name string `json:"albumName"`
+	}
+	if err := im.call(ctx, http.MethodGet, "/albums", "", nil, &albums); err != nil {
+		return "", fmt.Errorf("listing albums: %w", err)
+	}
+	for _, a := range albums {
+		if a.Name == im.album {
+			im.albumID = a.ID
+			return a.ID, nil
+		}
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	in := map[string]string{"albumName": im.album, "description": "Windows Spotlight images"}
+	if err := im.callJSON(ctx, http.MethodPost, "/albums", in, &created); err != nil {
+		return "", fmt.Errorf("creating album %q: %w", im.album, err)
+	}
+	im.albumID = created.ID
+	return created.ID, nil
+}
+
+func (im *immichUploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	if ext := path.Ext(f.Key); ext == ".json" || ext == ".xmp" {
+		return "", nil
+	}
+	albumID, err := im.albumIDFor(ctx)
+	if err != nil {
+		return "", err
+	}
+	e := f.Image
+	taken := imageDate(e)
+	modified := e.Added
+	if fi, err := os.Stat(f.Path); err == nil {
+		modified = fi.ModTime()
+	}
+
+	// the multipart body is written as it is sent, so that videos are
+	// not read into memory
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(func() error {
+			for _, field := range [][2]string{
+				{"deviceAssetId", "spotlightdl-" + f.Key},
+				{"deviceId", "spotlightdl"},
+				{"fileCreatedAt", taken.Format(time.RFC3339)},
+				{"fileModifiedAt", modified.Format(time.RFC3339)},
+				{"isFavorite", strconv.FormatBool(e.Favorite)},
+			} {
+				if err := mw.WriteField(field[0], field[1]); err != nil {
+					return err
+				}
+			}
+			w, err := mw.CreateFormFile("assetData", path.Base(f.Key))
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(f.Path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, err := io.Copy(w, file); err != nil {
+				return err
+			}
+			return mw.Close()
+		}())
+	}()
+	var asset struct {
+		ID     string `json:"id"`
+		Status string `json:"status"` // created or duplicate
+	}
+	err = im.call(ctx, http.MethodPost, "/assets", mw.FormDataContentType(), pr, &asset)
+	pr.Close()
+	if err != nil {
+		return "", err
+	}
+
+	meta := map[string]any{
+		"description":      strings.Join(nonEmpty(e.Title, e.Location, e.Description, e.Copyright), "\n"),
+		"dateTimeOriginal": taken.Format(time.RFC3339),
+		"isFavorite":       e.Favorite,
+	}
+	if e.Rating > 0 {
+		meta["rating"] = e.Rating
+	}
+	if err := im.callJSON(ctx, http.MethodPut, "/assets/"+asset.ID, meta, nil); err != nil {
+		return "", fmt.Errorf("setting the description: %w", err)
+	}
+	// an asset in the album already is reported per asset, not as an
+	// error
+	if err := im.callJSON(ctx, http.MethodPut, "/albums/"+albumID+"/assets", map[string][]string{"ids": {asset.ID}}, nil); err != nil {
+		return "", fmt.Errorf("adding to album: %w", err)
+	}
+	return asset.ID, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+func init() {
+	registerUploader("nextcloud", newNextcloudUploader)
+}
+
+// nextcloudUploader puts the images into a Nextcloud folder, a subfolder
+// per month (Wallpapers/2024-03/...), through Nextcloud's WebDAV API with
+// the checks of the webdav target: a file of the same size already there
+// is skipped, one changed there is left alone.
+//
+// nextcloud://user@host/Wallpapers logs in with an app password from
+// $SPOTLIGHTDL_NEXTCLOUD_PASSWORD. ?server= gives the server's address
+// when it is not https://host, e.g. http://nas:8080/nextcloud. ?albums=1
+// also adds each image to a Photos album per month.
+type nextcloudUploader struct {
+	client     *http.Client
+	server     *url.URL
+	folder     string
+	user, pass string
+	albums     bool
+
+	mu   sync.Mutex
+	dav  *webdavUploader // set once logged in
+	id   string          // user ID, which the login name need not be
+	made map[string]bool // albums known to exist
+}
+
+func newNextcloudUploader(u *url.URL, client *http.Client) (Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("no host; want nextcloud://user@host/folder")
+	}
+	n := &nextcloudUploader{
+		client: cmp.Or(client, http.DefaultClient),
+		server: &url.URL{Scheme: "https", Host: u.Host},
+		folder: strings.Trim(u.Path, "/"),
+		user:   cmp.Or(u.User.Username(), os.Getenv("SPOTLIGHTDL_NEXTCLOUD_USER")),
+		pass:   os.Getenv("SPOTLIGHTDL_NEXTCLOUD_PASSWORD"),
+		albums: u.Query().Get("albums") == "1",
+		made:   make(map[string]bool),
+	}
+	if server := u.Query().Get("server"); server != "" {
+		s, err := url.Parse(server)
+		if err != nil || s.Host == "" || (s.Scheme != "http" && s.Scheme != "https") {
+			return nil, fmt.Errorf("invalid server %q", server)
+		}
+		n.server = &url.URL{Scheme: s.Scheme, Host: s.Host, Path: strings.TrimSuffix(s.Path, "/")}
+	}
+	if n.user == "" || n.pass == "" {
+		return nil, errors.New("set the user in the URL and an app password in SPOTLIGHTDL_NEXTCLOUD_PASSWORD")
+	}
+	return n, nil
+}
+
+// login asks the OCS API who the user is, which checks the app password
+// and gives the user ID the WebDAV paths are under.
+func (n *nextcloudUploader) login(ctx context.Context) (*webdavUploader, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.dav != nil {
+		return n.dav, nil
+	}
+	u := *n.server
+	u.Path += "/ocs/v2.php/cloud/user"
+	u.RawQuery = "format=json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(n.user, n.pass)
+	req.Header.Set("OCS-APIRequest", "true")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, &uploadStatusError{Status: resp.StatusCode, Message: "login failed; create an app password under Settings > Security"}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logging in: %w", uploadStatus(resp))
+	}
+	var ocs struct {
+		OCS struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"ocs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ocs); err != nil || ocs.OCS.Data.ID == "" {
+		return nil, fmt.Errorf("logging in: %s does not look like a Nextcloud server", n.server)
+	}
+	n.id = ocs.OCS.Data.ID
+	base := *n.server
+	base.Path = strings.TrimSuffix(path.Join(base.Path, "/remote.php/dav/files", n.id, n.folder), "/")
+	n.dav = &webdavUploader{client: n.client, base: &base, user: n.user, pass: n.pass, made: make(map[string]bool)}
+	return n.dav, nil
+}
+
+func (n *nextcloudUploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	dav, err := n.login(ctx)
+	if err != nil {
+		return "", err
+	}
+	month := imageDate(f.Image).Format("2006-01")
+	key := f.Key
+	f.Key = month + "/" + path.Base(f.Key)
+	version, err := dav.Upload(ctx, f)
+	if err != nil {
+		return "", err
+	}
+	if ext := path.Ext(key); n.albums && ext != ".json" && ext != ".xmp" {
+		// a failure leaves the file unrecorded; the next run finds it in
+		// place and tries the album again
+		if err := n.addToAlbum(ctx, dav, month, f.Key); err != nil {
+			return "", fmt.Errorf("adding to album: %w", err)
+		}
+	}
+	return version, nil
+}
+
+// addToAlbum copies an uploaded file into the month's album of the Photos
+// app, creating the album first.
+func (n *nextcloudUploader) addToAlbum(ctx context.Context, dav *webdavUploader, month, key string) error {
+	name := "Spotlight"
+	if n.folder != "" {
+		name = path.Base(n.folder)
+	}
+	album := *n.server
+	album.Path += "/remote.php/dav/photos/" + n.id + "/albums/" + name + " " + month
+	n.mu.Lock()
+	made := n.made[month]
+	n.mu.Unlock()
+	if !made {
+		resp, err := dav.do(ctx, "MKCOL", album.String()+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusCreated, http.StatusMethodNotAllowed:
+		case http.StatusNotFound, http.StatusConflict:
+			return &uploadStatusError{Status: resp.StatusCode, Message: "no albums; is the Photos app enabled?"}
+		default:
+			return uploadStatus(resp)
+		}
+		n.mu.Lock()
+		n.made[month] = true
+		n.mu.Unlock()
+	}
+	album.Path += "/" + path.Base(key)
+	resp, err := dav.do(ctx, "COPY", dav.url(key), nil, http.Header{"Destination": {album.String()}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		// in the album already
+	default:
+		return uploadStatus(resp)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerUploader("s3", newS3Uploader)
+}
+
+// s3Uploader puts files into an S3 bucket, or anything speaking the S3
+// API such as MinIO, signing requests with AWS Signature Version 4.
+//
+// s3://bucket/prefix takes its credentials and region from the usual AWS
+// variables; ?endpoint=http://minio:9000 (or $AWS_ENDPOINT_URL_S3) points
+// it elsewhere, in which case the bucket goes in the path rather than the
+// host name, as MinIO expects. ?region= overrides the region.
+type s3Uploader struct {
+	client    *http.Client
+	endpoint  *url.URL
+	pathStyle bool
+	bucket    string
+	prefix    string
+	region    string
+	keyID     string
+	secret    string
+	token     string
+}
+
+func newS3Uploader(u *url.URL, client *http.Client) (Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("no bucket; want s3://bucket/prefix")
+	}
+	s := &s3Uploader{
+		client: client,
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+		region: cmp.Or(u.Query().Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		keyID:  os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:  os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.keyID == "" || s.secret == "" {
+		return nil, errors.New("set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	endpoint := cmp.Or(u.Query().Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if endpoint == "" {
+		s.endpoint = &url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com"}
+		return s, nil
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil || ep.Host == "" || (ep.Scheme != "http" && ep.Scheme != "https") {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	s.endpoint = &url.URL{Scheme: ep.Scheme, Host: ep.Host, Path: strings.TrimSuffix(ep.Path, "/")}
+	s.pathStyle = true
+	return s, nil
+}
+
+func (s *s3Uploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	key := path.Join(s.prefix, f.Key)
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path += "/" + s.bucket + "/" + key
+	} else {
+		u.Path += "/" + key
+	}
+	u.RawPath = awsEscape(u.Path, true)
+
+	body, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = f.Size
+	req.Header.Set("Content-Type", uploadContentType(f.Key))
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+	signAWSv4(req, s.keyID, s.secret, s.region, "s3", f.SHA256, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", uploadStatus(resp)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// signAWSv4 adds the Authorization header of AWS Signature Version 4,
+// signing the host and every header already set on req. payloadHash is
+// the hex SHA-256 of the body.
+func signAWSv4(req *http.Request, keyID, secret, region, service, payloadHash string, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	values := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		values[strings.ToLower(k)] = strings.Join(strings.Fields(strings.Join(v, ",")), " ")
+	}
+	names := slices.Sorted(maps.Keys(values))
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + values[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	// the path is encoded as SigV4 wants, whatever escaping the URL has
+	request := strings.Join([]string{req.Method, awsEscape(req.URL.Path, true), awsCanonicalQuery(req.URL.Query()),
+		canonical.String(), signed, payloadHash}, "\n")
+
+	scope := stamp[:8] + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{stamp[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, as
+// Signature Version 4 wants.
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && keepSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsCanonicalQuery(q url.Values) string {
+	var parts []string
+	for k, vs := range q {
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k, false)+"="+awsEscape(v, false))
+		}
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, "&")
+}
+
+// uploadContentType is the media type of an image or sidecar.
+func uploadContentType(key string) string {
+	switch {
+	case strings.HasSuffix(key, ".json"):
+		return "application/json"
+	case strings.HasSuffix(key, ".xmp"):
+		return "application/rdf+xml"
+	}
+	return imageMIME(key)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+)
+
+func init() {
+	registerFeature(&feature{
+		name:  "sftp",
+		desc:  "sftp:// and scp:// upload targets (OpenSSH sftp)",
+		built: true,
+		check: lookTool("sftp"),
+	})
+	registerUploader("sftp", newSFTPUploader)
+	registerUploader("scp", newSFTPUploader)
+}
+
+// sftpUploader copies files to a server over SSH by driving OpenSSH's
+// sftp in batch mode, so it authenticates the way ssh does: with the keys
+// in ~/.ssh, the agent, and whatever ~/.ssh/config says for the host.
+// There is no password prompt; ?key= or $SPOTLIGHTDL_SSH_KEY names a key
+// to use instead. sftp://user@host/srv/wallpapers is an absolute path,
+// sftp://user@host/~/wallpapers one below the home directory. scp:// is
+// taken to mean the same, as scp itself speaks SFTP nowadays.
+//
+// Each file goes to <file>.part and is renamed over the file when
+// complete, so a broken transfer never leaves half an image in place.
+type sftpUploader struct {
+	dest string // [user@]host
+	port string
+	key  string
+	dir  string // remote directory; relative ones are below the home directory
+
+	mu   sync.Mutex
+	made map[string]bool // directories known to exist
+}
+
+func newSFTPUploader(u *url.URL, _ *http.Client) (Uploader, error) {
+	if err := requireFeature("sftp"); err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("no host; want sftp://user@host/path")
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, errors.New("passwords are not supported; use a key (see ?key=)")
+	}
+	s := &sftpUploader{
+		dest: u.Hostname(),
+		port: u.Port(),
+		key:  u.Query().Get("key"),
+		made: make(map[string]bool),
+	}
+	if s.key == "" {
+		s.key = os.Getenv("SPOTLIGHTDL_SSH_KEY")
+	}
+	if name := u.User.Username(); name != "" {
+		s.dest = name + "@" + s.dest
+	}
+	switch dir := strings.TrimSuffix(u.Path, "/"); {
+	case dir == "/~":
+	case strings.HasPrefix(dir, "/~/"):
+		s.dir = dir[len("/~/"):]
+	default:
+		s.dir = dir
+	}
+	return s, nil
+}
+
+// sftpQuote quotes a path for an sftp batch file, escaping what sftp would
+// otherwise take as a glob.
+func sftpQuote(p string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range p {
+		if strings.ContainsRune(`"\*?[]`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (s *sftpUploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	remote := f.Key
+	if s.dir != "" {
+		remote = path.Join(s.dir, f.Key)
+	}
+
+	var batch strings.Builder
+	var dirs []string
+	s.mu.Lock()
+	for d := path.Dir(remote); d != "." && d != "/" && !s.made[d]; d = path.Dir(d) {
+		dirs = append(dirs, d)
+	}
+	s.mu.Unlock()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// a leading - lets the batch go on when the directory exists
+		fmt.Fprintf(&batch, "-mkdir %s\n", sftpQuote(dirs[i]))
+	}
+	fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(f.Path), sftpQuote(remote+".part"))
+	// sftp renames with posix-rename where the server offers it, which
+	// replaces the old file
+	fmt.Fprintf(&batch, "rename %s %s\n", sftpQuote(remote+".part"), sftpQuote(remote))
+
+	args := []string{"-b", "-", "-o", "BatchMode=yes", "-o", "ConnectTimeout=30"}
+	if s.port != "" {
+		args = append(args, "-P", s.port)
+	}
+	if s.key != "" {
+		args = append(args, "-i", s.key, "-o", "IdentitiesOnly=yes")
+	}
+	cmd := exec.CommandContext(ctx, "sftp", append(args, "--", s.dest)...)
+	cmd.Stdin = strings.NewReader(batch.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.ReplaceAll(strings.TrimSpace(stderr.String()), "\n", "; "); msg != "" {
+			return "", fmt.Errorf("sftp: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("sftp: %v", err)
+	}
+	s.mu.Lock()
+	for _, d := range dirs {
+		s.made[d] = true
+	}
+	s.mu.Unlock()
+	return "", nil
+}
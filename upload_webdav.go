@@ -0,0 +1,281 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func init() {
+	registerUploader("webdav", newWebDAVUploader)
+	registerUploader("webdavs", newWebDAVUploader)
+}
+
+// webdavChunk is the size of the pieces large files are sent in, so that
+// a broken connection costs one piece rather than the file.
+const webdavChunk = 4 << 20
+
+// webdavUploader mirrors the library to a WebDAV share, such as
+// Nextcloud's or a Synology's. webdavs://user@host/path uses HTTPS,
+// webdav:// plain HTTP; the password comes from
+// $SPOTLIGHTDL_WEBDAV_PASSWORD.
+//
+// Files are written with If-Match on the version uploaded last (or
+// If-None-Match: * for new ones), so a file someone changed on the share
+// is never overwritten. Files larger than webdavChunk go to <file>.part
+// in pieces with Content-Range and are moved into place when complete; a
+// later attempt resumes the part where the last one broke off. Servers
+// that do not take ranges get the file in one go.
+type webdavUploader struct {
+	client     *http.Client
+	base       *url.URL
+	user, pass string
+
+	mu       sync.Mutex
+	made     map[string]bool // collections known to exist
+	noRanges bool
+}
+
+func newWebDAVUploader(u *url.URL, client *http.Client) (Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("no host; want webdavs://user@host/path")
+	}
+	scheme := "http"
+	if u.Scheme == "webdavs" {
+		scheme = "https"
+	}
+	d := &webdavUploader{
+		client: cmp.Or(client, http.DefaultClient),
+		base:   &url.URL{Scheme: scheme, Host: u.Host, Path: strings.TrimSuffix(u.Path, "/")},
+		user:   cmp.Or(u.User.Username(), os.Getenv("SPOTLIGHTDL_WEBDAV_USER")),
+		made:   make(map[string]bool),
+	}
+	d.pass, _ = u.User.Password()
+	d.pass = cmp.Or(os.Getenv("SPOTLIGHTDL_WEBDAV_PASSWORD"), d.pass)
+	return d, nil
+}
+
+// url returns the URL of a path below the base.
+func (d *webdavUploader) url(p string) string {
+	u := *d.base
+	if p != "" {
+		u.Path += "/" + p
+	}
+	return u.String()
+}
+
+func (d *webdavUploader) do(ctx context.Context, method, u string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	// the transport takes the length from the request, not the header
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		req.ContentLength = n
+	}
+	if d.user != "" {
+		req.SetBasicAuth(d.user, d.pass)
+	}
+	return d.client.Do(req)
+}
+
+// mkcol creates the collection at p, a path on the server, and those it
+// lies in as needed.
+func (d *webdavUploader) mkcol(ctx context.Context, p string) error {
+	d.mu.Lock()
+	made := d.made[p]
+	d.mu.Unlock()
+	if made || p == "/" || p == "" {
+		return nil
+	}
+	u := *d.base
+	u.Path = p + "/"
+	for try := 0; ; try++ {
+		resp, err := d.do(ctx, "MKCOL", u.String(), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// 405: it exists already; 409: its parent does not
+		if resp.StatusCode == http.StatusConflict && try == 0 {
+			if err := d.mkcol(ctx, path.Dir(p)); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("creating %s: %w", u.String(), uploadStatus(resp))
+		}
+		break
+	}
+	d.mu.Lock()
+	d.made[p] = true
+	d.mu.Unlock()
+	return nil
+}
+
+// stat returns the size and ETag of a file on the share, or -1 if there
+// is none.
+func (d *webdavUploader) stat(ctx context.Context, p string) (int64, string, error) {
+	resp, err := d.do(ctx, http.MethodHead, d.url(p), nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, resp.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return -1, "", nil
+	}
+	return 0, "", uploadStatus(resp)
+}
+
+const webdavConflict = "changed on the server since the last upload; delete it there or move it away to upload it again"
+
+func (d *webdavUploader) Upload(ctx context.Context, f uploadFile) (string, error) {
+	if err := d.mkcol(ctx, path.Dir(path.Join(d.base.Path, f.Key))); err != nil {
+		return "", err
+	}
+	size, etag, err := d.stat(ctx, f.Key)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case size >= 0 && f.Version == "" && size == f.Size:
+		// put there by an earlier mirror or by hand: taken as uploaded
+		return etag, nil
+	case size >= 0 && f.Version == "":
+		return "", &uploadStatusError{Status: http.StatusPreconditionFailed, Message: "a different file of that name is on the server already"}
+	case size >= 0 && etag != f.Version:
+		return "", &uploadStatusError{Status: http.StatusPreconditionFailed, Message: webdavConflict}
+	}
+
+	header := http.Header{}
+	if size >= 0 {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	d.mu.Lock()
+	chunked := f.Size > webdavChunk && !d.noRanges
+	d.mu.Unlock()
+	if chunked {
+		switch err := d.putChunked(ctx, f); {
+		case errors.Is(err, errNoRanges):
+			d.mu.Lock()
+			d.noRanges = true
+			d.mu.Unlock()
+		case err != nil:
+			return "", err
+		default:
+			// the part is complete; move it over the file, which no one
+			// may have touched in the meantime
+			move := http.Header{"Destination": {d.url(f.Key)}, "Overwrite": {"F"}}
+			if size >= 0 {
+				move.Set("Overwrite", "T")
+				move.Set("If", "<"+d.url(f.Key)+"> (["+etag+"])")
+			}
+			resp, err := d.do(ctx, "MOVE", d.url(f.Key+".part"), nil, move)
+			if err != nil {
+				return "", err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+				return "", uploadStatus(resp)
+			}
+			_, etag, err := d.stat(ctx, f.Key)
+			return etag, err
+		}
+	}
+
+	body, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	header.Set("Content-Type", uploadContentType(f.Key))
+	header.Set("Content-Length", strconv.FormatInt(f.Size, 10))
+	resp, err := d.do(ctx, http.MethodPut, d.url(f.Key), body, header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusPreconditionFailed:
+		return "", &uploadStatusError{Status: resp.StatusCode, Message: webdavConflict}
+	default:
+		return "", uploadStatus(resp)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+	_, etag, err = d.stat(ctx, f.Key)
+	return etag, err
+}
+
+var errNoRanges = errors.New("the server does not take partial uploads")
+
+// putChunked writes f to <key>.part piece by piece, continuing a part an
+// earlier attempt left.
+func (d *webdavUploader) putChunked(ctx context.Context, f uploadFile) error {
+	part := f.Key + ".part"
+	have, _, err := d.stat(ctx, part)
+	if err != nil {
+		return err
+	}
+	if have < 0 || have > f.Size {
+		have = 0
+	}
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for off := have; off < f.Size; {
+		n := min(int64(webdavChunk), f.Size-off)
+		header := http.Header{
+			"Content-Range":  {fmt.Sprintf("bytes %d-%d/%d", off, off+n-1, f.Size)},
+			"Content-Length": {strconv.FormatInt(n, 10)},
+		}
+		resp, err := d.do(ctx, http.MethodPut, d.url(part), io.NewSectionReader(file, off, n), header)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		case http.StatusBadRequest, http.StatusNotImplemented, http.StatusRequestedRangeNotSatisfiable, http.StatusForbidden:
+			if off == have {
+				return errNoRanges
+			}
+			return uploadStatus(resp)
+		default:
+			return uploadStatus(resp)
+		}
+		off += n
+	}
+	// a server that ignored Content-Range kept only the last piece
+	if got, _, err := d.stat(ctx, part); err != nil {
+		return err
+	} else if got != f.Size {
+		if resp, err := d.do(ctx, http.MethodDelete, d.url(part), nil, nil); err == nil {
+			resp.Body.Close()
+		}
+		return errNoRanges
+	}
+	return nil
+}
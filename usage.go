@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// usageStats are purely local counters kept next to the catalog. They are
+// never sent anywhere; `stats` is the only reader.
+type usageStats struct {
+	path      string
+	legacy    string                 // where older versions kept it, removed on save
+	Since     time.Time              `json:"since"`
+	Runs      int                    `json:"runs"`
+	Successes int                    `json:"successes"`
+	Seconds   float64                `json:"seconds"` // total duration of successful runs
+	Months    map[string]*monthUsage `json:"months"`  // keyed by YYYY-MM, kept forever
+	Recent    []*runRecord           `json:"recent"`  // the last maxRecentRuns runs
+}
+
+type monthUsage struct {
+	Runs         int   `json:"runs"`
+	Images       int   `json:"images"`
+	Bytes        int64 `json:"bytes"`
+	Deduped      int   `json:"deduped"`
+	DedupedBytes int64 `json:"dedupedBytes"`
+	APICalls     int   `json:"apiCalls"`
+	Errors       int   `json:"errors"`
+}
+
+type runRecord struct {
+	Start   time.Time `json:"start"`
+	Seconds float64   `json:"seconds"`
+	Images  int       `json:"images"`
+	Deduped int       `json:"deduped"`
+	OK      bool      `json:"ok"`
+	Error   string    `json:"error,omitempty"` // why the run was aborted
+}
+
+const maxRecentRuns = 500
+
+func openUsage(outDir string) (*usageStats, error) {
+	u := &usageStats{path: filepath.Join(localStateDir(outDir), "stats.json")}
+	b, err := os.ReadFile(u.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if legacy := filepath.Join(stateDir(outDir), "stats.json"); legacy != u.path {
+			u.legacy = legacy
+			b, err = os.ReadFile(legacy)
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *usageStats) save() error {
+	if err := os.MkdirAll(filepath.Dir(u.path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(u.path, b); err != nil {
+		return err
+	}
+	if u.legacy != "" {
+		os.Remove(u.legacy)
+		u.legacy = ""
+	}
+	return nil
+}
+
+func (u *usageStats) month(t time.Time) *monthUsage {
+	if u.Months == nil {
+		u.Months = map[string]*monthUsage{}
+	}
+	key := t.Format("2006-01")
+	m := u.Months[key]
+	if m == nil {
+		m = &monthUsage{}
+		u.Months[key] = m
+	}
+	return m
+}
+
+// startRun counts a run up front, so runs that die half-way still show
+// up as unsuccessful.
+func (u *usageStats) startRun() *runRecord {
+	now := time.Now().UTC()
+	if u.Since.IsZero() {
+		u.Since = now
+	}
+	u.Runs++
+	u.month(now).Runs++
+	r := &runRecord{Start: now}
+	u.Recent = append(u.Recent, r)
+	if len(u.Recent) > maxRecentRuns {
+		u.Recent = u.Recent[len(u.Recent)-maxRecentRuns:]
+	}
+	return r
+}
+
+func (u *usageStats) downloaded(r *runRecord, size int64) {
+	m := u.month(r.Start)
+	m.Images++
+	m.Bytes += size
+	r.Images++
+}
+
+// deduped records an image that was already in the library, i.e. a
+// download that did not have to happen.
+func (u *usageStats) deduped(r *runRecord, size int64) {
+	m := u.month(r.Start)
+	m.Deduped++
+	m.DedupedBytes += size
+	r.Deduped++
+}
+
+// apiCall counts a request to a source's API.
+func (u *usageStats) apiCall(r *runRecord) {
+	u.month(r.Start).APICalls++
+}
+
+// failed counts a failed API call or download.
+func (u *usageStats) failed(r *runRecord) {
+	u.month(r.Start).Errors++
+}
+
+func (u *usageStats) finishRun(r *runRecord) {
+	r.OK = true
+	r.Seconds = time.Since(r.Start).Seconds()
+	u.Successes++
+	u.Seconds += r.Seconds
+}
+
+// abortRun records the error that ended a run early.
+func (u *usageStats) abortRun(r *runRecord, err error) {
+	r.Seconds = time.Since(r.Start).Seconds()
+	r.Error = err.Error()
+}
+
+// totals sums the monthly counters.
+func (u *usageStats) totals() monthUsage {
+	var t monthUsage
+	for _, m := range u.Months {
+		t.Runs += m.Runs
+		t.Images += m.Images
+		t.Bytes += m.Bytes
+		t.Deduped += m.Deduped
+		t.DedupedBytes += m.DedupedBytes
+		t.APICalls += m.APICalls
+		t.Errors += m.Errors
+	}
+	return t
+}
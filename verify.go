@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// verify checks the library against the catalog: every file must be
+// there, hash to the SHA-256 recorded when it was downloaded, and decode
+// as a whole, which catches the truncated files a full disk or a killed
+// copy leaves behind. Hard links in other markets' folders must still be
+// the same file. -redownload fetches bad files again from their URL.
+
+func init() {
+	registerCommand("verify", cmdVerify)
+}
+
+func cmdVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	lockWait := flags.Duration("lock-wait", 0, "when another run is working on -outdir, wait this long for it instead of failing")
+	redownload := flags.Bool("redownload", false, "download missing and damaged images again from their URL")
+	noDecode := flags.Bool("no-decode", false, "only compare hashes, without decoding each image")
+	parseFlags(flags, args)
+
+	if *redownload {
+		lock, err := lockLibrary(context.Background(), *outDir, "verify", *lockWait)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	if len(cat.Images) == 0 {
+		fmt.Println("the catalog is empty")
+		return nil
+	}
+
+	type problem struct {
+		e    *catalogEntry
+		what string
+		link bool // only a hard link is off
+	}
+	var bad []problem
+	tty := isTerminal(os.Stdout)
+	for i, e := range cat.Images {
+		if tty {
+			fmt.Printf("\rverifying %d/%d %s", i+1, len(cat.Images), bar(float64(i+1)/float64(len(cat.Images)), 30))
+		}
+		if what := verifyImage(*outDir, e, !*noDecode); what != "" {
+			bad = append(bad, problem{e, what, false})
+		} else if rel := staleLink(*outDir, e); rel != "" {
+			bad = append(bad, problem{e, "the hard link " + rel + " is a file of its own", true})
+		}
+	}
+	if tty {
+		fmt.Println()
+	}
+	for _, p := range bad {
+		fmt.Printf("%s: %s\n", p.e.Path, p.what)
+	}
+	if len(bad) == 0 {
+		fmt.Printf("all %d images are intact\n", len(cat.Images))
+		return nil
+	}
+	if !*redownload {
+		return fmt.Errorf("verify: %d of %d images are missing or damaged; -redownload fetches them again", len(bad), len(cat.Images))
+	}
+
+	client, err := newHTTPClient(transportOptions{})
+	if err != nil {
+		return err
+	}
+	var fixed int
+	for _, p := range bad {
+		e := p.e
+		if p.link {
+			relink(*outDir, e)
+			fmt.Printf("%s: linked again\n", e.Path)
+			fixed++
+			continue
+		}
+		if e.URL == "" {
+			fmt.Printf("%s: no URL to download it from\n", e.Path)
+			continue
+		}
+		changed, err := fetchAgain(context.Background(), client, *outDir, e, !*noDecode)
+		if err != nil {
+			fmt.Printf("%s: %v\n", e.Path, err)
+			continue
+		}
+		if changed {
+			fmt.Printf("%s: downloaded again; the source has changed it since\n", e.Path)
+		} else {
+			fmt.Printf("%s: downloaded again\n", e.Path)
+		}
+		fixed++
+	}
+	if err := cat.save(); err != nil {
+		return err
+	}
+	if fixed < len(bad) {
+		return fmt.Errorf("verify: repaired %d of %d images", fixed, len(bad))
+	}
+	fmt.Printf("repaired %d images\n", fixed)
+	return nil
+}
+
+// fetchAgain fetches an image's file again from its URL. If the source
+// serves different bytes by now, the new file is kept when it is a whole
+// image, and the entry records it; changed says so.
+func fetchAgain(ctx context.Context, client *http.Client, outDir string, e *catalogEntry, strict bool) (changed bool, err error) {
+	path := filepath.Join(outDir, filepath.FromSlash(e.Path))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	sum, err := download(withSource(ctx, e.Source), client, e.URL, path, strict, nil)
+	if err != nil {
+		return false, fmt.Errorf("download failed: %w", err)
+	}
+	if sum == e.SourceSHA256 && !e.Published.IsZero() {
+		// the same download as before, which -exif-date then dated
+		if ok, err := setEXIFDate(path, e.Published); err == nil && ok {
+			sum, _, _ = hashFile(path)
+		}
+	}
+	if sum == e.SHA256 {
+		relink(outDir, e)
+		return false, nil
+	}
+	if what := verifyImage(outDir, &catalogEntry{Path: e.Path, SHA256: sum}, true); what != "" {
+		return false, fmt.Errorf("downloaded again, but %s", what)
+	}
+	e.SHA256, e.SourceSHA256 = sum, ""
+	if fi, err := os.Stat(path); err == nil {
+		e.Size = fi.Size()
+	}
+	e.Width, e.Height, _ = imageSize(path)
+	e.PHash, e.Palette, e.Brightness = "", nil, 0
+	// the links in other markets' folders are still the old file
+	relink(outDir, e)
+	return true, nil
+}
+
+// damaged returns what is wrong with an image's file if it went bad since
+// it was recorded: it no longer hashes to its SHA-256 and does not decode
+// either. A file that changed but still decodes was most likely edited on
+// purpose and is left alone, as is a missing one.
+func damaged(outDir string, e *catalogEntry) string {
+	what := verifyImage(outDir, e, false)
+	if what == "" || what == "missing" {
+		return ""
+	}
+	if err := checkImage(filepath.Join(outDir, filepath.FromSlash(e.Path)), true); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// verifyImage returns what is wrong with an image's file, or "".
+func verifyImage(outDir string, e *catalogEntry, decode bool) string {
+	path := filepath.Join(outDir, filepath.FromSlash(e.Path))
+	sum, _, err := hashFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "missing"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if sum != e.SHA256 {
+		return "checksum mismatch, the file changed since it was recorded"
+	}
+	if !decode {
+		return ""
+	}
+	// formats and JPEG features this build cannot decode are taken on
+	// trust
+	var unsupported jpeg.UnsupportedError
+	if _, err := decodeImage(path); err != nil && !errors.Is(err, image.ErrFormat) && !errors.As(err, &unsupported) {
+		return "does not decode: " + err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+//go:build video
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	registerFeature(&feature{
+		name:  "video",
+		desc:  "slideshow video export (ffmpeg)",
+		tag:   "video",
+		built: true,
+		check: lookTool("ffmpeg"),
+	})
+}
+
+// exportVideo renders images as a 1080p slideshow, perSlide seconds each.
+func exportVideo(images []string, dst string, perSlide float64) error {
+	if err := requireFeature("video"); err != nil {
+		return err
+	}
+	list, err := os.CreateTemp("", "spotlightdl-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	for _, im := range images {
+		abs, err := filepath.Abs(im)
+		if err != nil {
+			list.Close()
+			return err
+		}
+		fmt.Fprintf(list, "file '%s'\nduration %g\n", strings.ReplaceAll(abs, "'", `'\''`), perSlide)
+	}
+	if err := list.Close(); err != nil {
+		return err
+	}
+	out, err := exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "concat", "-safe", "0",
+		"-i", list.Name(), "-vf", "scale=1920:1080:force_original_aspect_ratio=decrease,pad=1920:1080:(ow-iw)/2:(oh-ih)/2,format=yuv420p",
+		"-r", "30", dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !video
+
+package main
+
+func init() {
+	registerFeature(&feature{name: "video", desc: "slideshow video export (ffmpeg)", tag: "video"})
+}
+
+func exportVideo(images []string, dst string, perSlide float64) error {
+	return requireFeature("video")
+}
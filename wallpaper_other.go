@@ -0,0 +1,58 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// setWallpaper sets the desktop background with the tools the desktop
+// ships: osascript on macOS; gsettings (GNOME and friends),
+// plasma-apply-wallpaperimage (KDE), swaymsg or feh elsewhere.
+func setWallpaper(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	run := func(name string, args ...string) error {
+		out, err := exec.Command(name, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	if runtime.GOOS == "darwin" {
+		script := `tell application "System Events" to tell every desktop to set picture to POSIX file "` + appleScriptQuote(abs) + `"`
+		return run("osascript", "-e", script)
+	}
+
+	desktop := strings.ToLower(os.Getenv("XDG_CURRENT_DESKTOP"))
+	switch {
+	case strings.Contains(desktop, "kde"):
+		return run("plasma-apply-wallpaperimage", abs)
+	case os.Getenv("SWAYSOCK") != "":
+		return run("swaymsg", "output * bg "+shellQuote(abs)+" fill")
+	}
+	if _, err := exec.LookPath("gsettings"); err == nil {
+		uri := (&url.URL{Scheme: "file", Path: abs}).String()
+		for _, key := range []string{"picture-uri", "picture-uri-dark"} {
+			// picture-uri-dark only exists on newer GNOME
+			err := run("gsettings", "set", "org.gnome.desktop.background", key, uri)
+			if err != nil && key == "picture-uri" {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, err := exec.LookPath("feh"); err == nil {
+		return run("feh", "--bg-fill", abs)
+	}
+	return errors.New("no supported wallpaper tool found (gsettings, plasma-apply-wallpaperimage, swaymsg, feh)")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	moduser32                 = syscall.NewLazyDLL("user32.dll")
+	procSystemParametersInfoW = moduser32.NewProc("SystemParametersInfoW")
+)
+
+const (
+	spiSetDeskWallpaper = 0x0014
+	spifUpdateIniFile   = 0x01
+	spifSendChange      = 0x02
+)
+
+func setWallpaper(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	p, err := syscall.UTF16PtrFromString(abs)
+	if err != nil {
+		return err
+	}
+	r, _, err := procSystemParametersInfoW.Call(spiSetDeskWallpaper, 0, uintptr(unsafe.Pointer(p)), spifUpdateIniFile|spifSendChange)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
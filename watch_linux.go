@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE
+
+// watchDir calls changed whenever something under dir (except hidden
+// directories such as the state directory) is created, written, moved or
+// deleted. It uses inotify and adds watches for new subdirectories.
+func watchDir(dir string, changed func()) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	defer syscall.Close(fd)
+
+	dirs := make(map[int]string)
+	add := func(root string) error {
+		return filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if p != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			wd, err := syscall.InotifyAddWatch(fd, p, inotifyMask)
+			if err != nil {
+				return os.NewSyscallError("inotify_add_watch", err)
+			}
+			dirs[wd] = p
+			return nil
+		})
+	}
+	if err := add(dir); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return os.NewSyscallError("read", err)
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := strings.TrimRight(string(buf[off+syscall.SizeofInotifyEvent:off+syscall.SizeofInotifyEvent+int(ev.Len)]), "\x00")
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+			if ev.Mask&syscall.IN_ISDIR != 0 && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				if parent, ok := dirs[int(ev.Wd)]; ok && !strings.HasPrefix(name, ".") {
+					add(filepath.Join(parent, name))
+				}
+			}
+		}
+		changed()
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+
+package main
+
+import "time"
+
+// watchDir polls: without inotify or ReadDirectoryChangesW it simply
+// reports a possible change every few seconds, and the caller's rescan
+// only hashes files whose size or mtime moved.
+func watchDir(dir string, changed func()) error {
+	for {
+		time.Sleep(10 * time.Second)
+		changed()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fileListDirectory           = 0x0001
+	fileNotifyChangeFileName    = 0x0001
+	fileNotifyChangeDirName     = 0x0002
+	fileNotifyChangeSize        = 0x0008
+	fileNotifyChangeLastWrite   = 0x0010
+	fileNotifyInformationHeader = 12 // NextEntryOffset, Action, FileNameLength
+)
+
+// watchDir calls changed whenever something under dir, outside the state
+// directory, is created, written, renamed or deleted
+// (ReadDirectoryChangesW on the whole tree).
+func watchDir(dir string, changed func()) error {
+	p, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(p, fileListDirectory,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	buf := make([]byte, 64<<10)
+	mask := uint32(fileNotifyChangeFileName | fileNotifyChangeDirName | fileNotifyChangeSize | fileNotifyChangeLastWrite)
+	for {
+		var n uint32
+		if err := syscall.ReadDirectoryChanges(h, &buf[0], uint32(len(buf)), true, mask, &n, nil, 0); err != nil {
+			return err
+		}
+		if n == 0 {
+			// the buffer overflowed; assume anything changed
+			changed()
+			continue
+		}
+		relevant := false
+		for off := uint32(0); ; {
+			next := *(*uint32)(unsafe.Pointer(&buf[off]))
+			nameLen := *(*uint32)(unsafe.Pointer(&buf[off+8]))
+			name := syscall.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&buf[off+fileNotifyInformationHeader])), nameLen/2))
+			if !strings.HasPrefix(name, ".") {
+				relevant = true
+			}
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+		if relevant {
+			changed()
+		}
+	}
+}
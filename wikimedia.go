@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const wikimediaFeedAPI = "https://api.wikimedia.org/feed/v1/wikipedia/en/featured/"
+
+type wikimediaFeed struct {
+	Image *struct {
+		Title    string `json:"title"`
+		FilePage string `json:"file_page"`
+		Image    struct {
+			Source string `json:"source"`
+			Width  int    `json:"width"`
+			Height int    `json:"height"`
+		} `json:"image"`
+		Artist struct {
+			Text string `json:"text"`
+		} `json:"artist"`
+		Credit struct {
+			Text string `json:"text"`
+		} `json:"credit"`
+		License struct {
+			Type string `json:"type"`
+			URL  string `json:"url"`
+		} `json:"license"`
+		Description struct {
+			Text string `json:"text"`
+		} `json:"description"`
+	} `json:"image"`
+}
+
+func init() {
+	registerSource("wikimedia", func(cfg sourceConfig) (Source, error) {
+		days := max(cfg.WikimediaDays, 1)
+		return &onceSource{name: "wikimedia", fetch: func(ctx context.Context) ([]spotImage, error) {
+			return fetchWikimedia(ctx, cfg.Client, days)
+		}}, nil
+	})
+}
+
+// fetchWikimedia returns the Commons picture of the day for the last days
+// (today included), keeping only landscape images.
+func fetchWikimedia(ctx context.Context, client *http.Client, days int) ([]spotImage, error) {
+	var out []spotImage
+	now := time.Now().UTC()
+	for d := 0; d < days; d++ {
+		im, err := fetchWikimediaDay(ctx, client, now.AddDate(0, 0, -d))
+		if err != nil {
+			return nil, err
+		}
+		if im != nil {
+			out = append(out, *im)
+		}
+	}
+	return dedupe(out), nil
+}
+
+func fetchWikimediaDay(ctx context.Context, client *http.Client, day time.Time) (*spotImage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wikimediaFeedAPI+day.Format("2006/01/02"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("wikimedia: http %d", resp.StatusCode)
+	}
+
+	var f wikimediaFeed
+	if err := json.NewDecoder(resp.Body).Decode(&f); err != nil {
+		return nil, err
+	}
+	p := f.Image
+	if p == nil || !strings.HasPrefix(p.Image.Source, "https://") || p.Image.Width <= p.Image.Height {
+		return nil, nil
+	}
+	title := strings.TrimSuffix(strings.TrimPrefix(p.Title, "File:"), fileExt(p.Title))
+	return &spotImage{
+		URL:        p.Image.Source,
+		FileName:   "potd-" + day.Format("2006-01-02") + fileExt(p.Image.Source),
+		Title:      firstNonEmpty(p.Description.Text, title),
+		Copyright:  firstNonEmpty(p.Credit.Text, p.Artist.Text),
+		Author:     strings.TrimSpace(p.Artist.Text),
+		License:    p.License.Type,
+		LicenseURL: p.License.URL,
+		PageURL:    p.FilePage,
+		Published:  day,
+	}, nil
+}
+
+func fileExt(name string) string {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 || strings.ContainsAny(name[i:], "/?") {
+		return ".jpg"
+	}
+	return strings.ToLower(name[i:])
+}
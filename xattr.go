@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+// -xattr writes an image's title, copyright and source URL into extended
+// attributes of the file, user.spotlightdl.title and so on. Linux and
+// macOS keep them with the file through renames, moves and copies that
+// preserve them (cp -a, rsync -X, Finder), so the metadata travels
+// without a sidecar that can be left behind. getfattr -d and xattr -l
+// show them.
+
+const xattrPrefix = "user.spotlightdl."
+
+var errNoXattr = errors.New("-xattr is only supported on Linux and macOS")
+
+// xattrValues are the attributes for e, by name without the prefix; empty
+// ones are left out.
+func xattrValues(e *catalogEntry) map[string]string {
+	v := make(map[string]string)
+	for name, s := range map[string]string{"title": e.Title, "copyright": e.Copyright, "url": e.URL} {
+		if s != "" {
+			v[name] = s
+		}
+	}
+	return v
+}
+
+// writeXattrs sets the attributes for e on the file at path.
+func writeXattrs(path string, e *catalogEntry) error {
+	if !xattrSupported {
+		return errNoXattr
+	}
+	v := xattrValues(e)
+	for _, name := range slices.Sorted(maps.Keys(v)) {
+		if err := setXattr(path, xattrPrefix+name, v[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
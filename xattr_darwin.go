@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const xattrSupported = true
+
+// setXattr uses the xattr tool macOS ships, as the syscall package has no
+// setxattr for it.
+func setXattr(path, name, value string) error {
+	out, err := exec.Command("xattr", "-w", name, value, path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("xattr: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const xattrSupported = true
+
+func setXattr(path, name, value string) error {
+	if err := syscall.Setxattr(path, name, []byte(value), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
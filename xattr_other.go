@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package main
+
+const xattrSupported = false
+
+func setXattr(path, name, value string) error { return errNoXattr }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	registerCommand("xmp", cmdXMP)
+}
+
+const xmpNS = "http://ns.adobe.com/xap/1.0/"
+
+var (
+	xmpRatingAttr = regexp.MustCompile(`xmp:Rating="-?\d+"`)
+	xmpRatingElem = regexp.MustCompile(`<xmp:Rating>-?\d+</xmp:Rating>`)
+)
+
+// xmpSidecarPath follows the darktable/digiKam convention of appending
+// .xmp to the full image name.
+func xmpSidecarPath(imgPath string) string {
+	return imgPath + ".xmp"
+}
+
+// syncXMPRating updates the rating in an image's XMP sidecar if it has
+// one, so that photo managers reading it see ratings made elsewhere.
+func syncXMPRating(imgPath string, rating int) error {
+	if !exists(xmpSidecarPath(imgPath)) {
+		return nil
+	}
+	return writeXMPRating(imgPath, rating)
+}
+
+// writeXMPRating sets xmp:Rating in the image's XMP sidecar, creating a
+// minimal one if there is none and leaving everything else in place.
+func writeXMPRating(imgPath string, rating int) error {
+	path := xmpSidecarPath(imgPath)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return writeFileAtomic(path, []byte(fmt.Sprintf(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="%s" xmp:Rating="%d"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`, xmpNS, rating)))
+	}
+	if err != nil {
+		return err
+	}
+
+	doc := string(b)
+	switch {
+	case xmpRatingAttr.MatchString(doc):
+		doc = xmpRatingAttr.ReplaceAllString(doc, fmt.Sprintf(`xmp:Rating="%d"`, rating))
+	case xmpRatingElem.MatchString(doc):
+		doc = xmpRatingElem.ReplaceAllString(doc, fmt.Sprintf(`<xmp:Rating>%d</xmp:Rating>`, rating))
+	default:
+		i := strings.Index(doc, "<rdf:Description")
+		if i < 0 {
+			return fmt.Errorf("%s: no rdf:Description to add the rating to", path)
+		}
+		attr := fmt.Sprintf(` xmp:Rating="%d"`, rating)
+		if !strings.Contains(doc, `xmlns:xmp=`) {
+			attr = ` xmlns:xmp="` + xmpNS + `"` + attr
+		}
+		i += len("<rdf:Description")
+		doc = doc[:i] + attr + doc[i:]
+	}
+	return writeFileAtomic(path, []byte(doc))
+}
+
+const dcNS = "http://purl.org/dc/elements/1.1/"
+
+var xmpSubject = regexp.MustCompile(`(?s)\s*<dc:subject>.*?</dc:subject>`)
+
+// syncXMPTags updates the keywords in an image's XMP sidecar if it has
+// one.
+func syncXMPTags(imgPath string, tags []string) error {
+	if !exists(xmpSidecarPath(imgPath)) {
+		return nil
+	}
+	return writeXMPTags(imgPath, tags)
+}
+
+// writeXMPTags sets dc:subject, the keywords photo managers show, in the
+// image's XMP sidecar, creating a minimal one if there is none.
+func writeXMPTags(imgPath string, tags []string) error {
+	path := xmpSidecarPath(imgPath)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		b = []byte(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`)
+	} else if err != nil {
+		return err
+	}
+
+	doc := xmpSubject.ReplaceAllString(string(b), "")
+	if len(tags) > 0 {
+		i := strings.Index(doc, "<rdf:Description")
+		if i < 0 {
+			return fmt.Errorf("%s: no rdf:Description to add the tags to", path)
+		}
+		end := i + strings.IndexByte(doc[i:], '>')
+		if end < i {
+			return fmt.Errorf("%s: malformed rdf:Description", path)
+		}
+		start, selfClosing := strings.CutSuffix(doc[i:end], "/")
+		start = strings.TrimRight(start, " ")
+		if !strings.Contains(start, "xmlns:dc=") {
+			start += ` xmlns:dc="` + dcNS + `"`
+		}
+		var bag strings.Builder
+		bag.WriteString("\n   <dc:subject>\n    <rdf:Bag>\n")
+		for _, t := range tags {
+			fmt.Fprintf(&bag, "     <rdf:li>%s</rdf:li>\n", xmlEscape(t))
+		}
+		bag.WriteString("    </rdf:Bag>\n   </dc:subject>")
+		if selfClosing {
+			// <rdf:Description .../> gets a body
+			bag.WriteString("\n  </rdf:Description>")
+		}
+		doc = doc[:i] + start + ">" + bag.String() + doc[end+1:]
+	}
+	return writeFileAtomic(path, []byte(doc))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xmpDocument is a complete XMP sidecar for an image: its title,
+// description, credit, keywords, rating and date, in the properties
+// photo managers read.
+func xmpDocument(e *catalogEntry) []byte {
+	var b strings.Builder
+	alt := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "   <%s>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n    </rdf:Alt>\n   </%[1]s>\n", name, xmlEscape(value))
+		}
+	}
+	b.WriteString(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="` + dcNS + `"
+    xmlns:xmp="` + xmpNS + `"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:Iptc4xmpCore="http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/"`)
+	if e.Rating > 0 {
+		fmt.Fprintf(&b, "\n    xmp:Rating=\"%d\"", e.Rating)
+	}
+	fmt.Fprintf(&b, "\n    photoshop:DateCreated=\"%s\"", imageDate(e).Format("2006-01-02T15:04:05Z07:00"))
+	if e.Location != "" {
+		fmt.Fprintf(&b, "\n    Iptc4xmpCore:Location=\"%s\"", xmlEscape(e.Location))
+	}
+	b.WriteString(">\n")
+	alt("dc:title", e.Title)
+	alt("dc:description", e.Description)
+	alt("dc:rights", e.Copyright)
+	if len(e.Tags) > 0 {
+		b.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+		for _, t := range e.Tags {
+			fmt.Fprintf(&b, "     <rdf:li>%s</rdf:li>\n", xmlEscape(t))
+		}
+		b.WriteString("    </rdf:Bag>\n   </dc:subject>\n")
+	}
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>\n")
+	return []byte(b.String())
+}
+
+// writeXMPSidecar gives an image a full XMP sidecar. One that is there
+// already may hold edits from a photo manager, so only its rating and
+// keywords are brought up to date.
+func writeXMPSidecar(imgPath string, e *catalogEntry) error {
+	if !exists(xmpSidecarPath(imgPath)) {
+		return writeFileAtomic(xmpSidecarPath(imgPath), xmpDocument(e))
+	}
+	if err := writeXMPRating(imgPath, e.Rating); err != nil {
+		return err
+	}
+	return writeXMPTags(imgPath, e.Tags)
+}
+
+// cmdXMP writes XMP sidecars for the images downloaded before -xmp was
+// on, or rewrites them all with -force.
+func cmdXMP(args []string) error {
+	flags := flag.NewFlagSet("xmp", flag.ExitOnError)
+	outDir := flags.String("outdir", ".", "library directory")
+	force := flags.Bool("force", false, "replace existing sidecars, dropping edits made in other programs")
+	parseFlags(flags, args)
+	if flags.NArg() > 0 {
+		return errors.New("usage: spotlightdl xmp [-outdir dir] [-force]")
+	}
+	cat, err := openCatalog(*outDir)
+	if err != nil {
+		return err
+	}
+	var written int
+	for _, e := range cat.Images {
+		p := filepath.Join(*outDir, filepath.FromSlash(e.Path))
+		if !exists(p) || (exists(xmpSidecarPath(p)) && !*force) {
+			continue
+		}
+		if err := writeFileAtomic(xmpSidecarPath(p), xmpDocument(e)); err != nil {
+			return err
+		}
+		written++
+	}
+	fmt.Printf("wrote %d sidecars\n", written)
+	return nil
+}